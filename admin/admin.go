@@ -0,0 +1,138 @@
+// Package admin serves the API to look at the agents of every app group
+// and to pause, resume or trigger them, e.g. during the maintenance of an
+// app group, without restarting the exporter.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/exporter"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PATH_PREFIX = "/admin/app_groups"
+
+	ACTION_PAUSE   = "pause"
+	ACTION_RESUME  = "resume"
+	ACTION_TRIGGER = "trigger"
+)
+
+// Manager is what the API needs from the exporter manager.
+type Manager interface {
+	Statuses() []exporter.AppGroupStatus
+	Status(clusterName string) (exporter.AppGroupStatus, bool)
+	Controls(clusterName string) ([]*exporter.AgentControl, bool)
+}
+
+type handler struct {
+	manager Manager
+	token   string
+}
+
+// NewHandler serves, to requests with the bearer token:
+//   - GET /admin/app_groups, the app groups and the status of their agents
+//   - POST /admin/app_groups/{cluster_name}/{action}, the action applied to
+//     every agent of the app group
+//   - POST /admin/app_groups/{cluster_name}/{probe}/{action}, the action
+//     applied to one agent, e.g. push or elasticsearch
+//
+// where action is pause, resume or trigger. POST returns the status of the
+// app group.
+func NewHandler(manager Manager, token string) http.Handler {
+	return &handler{manager: manager, token: token}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	parts := []string{}
+	for _, p := range strings.Split(strings.TrimPrefix(r.URL.Path, PATH_PREFIX), "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.manager.Statuses())
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		h.apply(w, parts[0], "", parts[1])
+	case len(parts) == 3 && r.Method == http.MethodPost:
+		h.apply(w, parts[0], parts[1], parts[2])
+	case len(parts) <= 3:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// apply runs the action on the agents of the app group, all of them when
+// probe is empty.
+func (h *handler) apply(w http.ResponseWriter, clusterName, probe, action string) {
+	if action != ACTION_PAUSE && action != ACTION_RESUME && action != ACTION_TRIGGER {
+		writeError(w, http.StatusBadRequest, "Unknown action, expected pause, resume or trigger")
+		return
+	}
+	controls, ok := h.manager.Controls(clusterName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown app group")
+		return
+	}
+
+	found := false
+	for _, c := range controls {
+		if probe != "" && c.Probe() != probe {
+			continue
+		}
+		found = true
+		switch action {
+		case ACTION_PAUSE:
+			c.Pause()
+		case ACTION_RESUME:
+			c.Resume()
+		case ACTION_TRIGGER:
+			c.Trigger()
+		}
+		logging.For(clusterName, c.Probe()).WithField("action", action).Info("Applied action from the admin API")
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "Unknown probe")
+		return
+	}
+
+	status, ok := h.manager.Status(clusterName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown app group")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("Failed to write admin response, error: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/exporter"
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+type fakeManager struct {
+	controls []*exporter.AgentControl
+}
+
+func (f *fakeManager) Statuses() []exporter.AppGroupStatus {
+	status, _ := f.Status("lama")
+	return []exporter.AppGroupStatus{status}
+}
+
+func (f *fakeManager) Status(clusterName string) (exporter.AppGroupStatus, bool) {
+	if clusterName != "lama" {
+		return exporter.AppGroupStatus{}, false
+	}
+	status := exporter.AppGroupStatus{ClusterName: "lama"}
+	for _, c := range f.controls {
+		status.Agents = append(status.Agents, c.Status())
+	}
+	return status, true
+}
+
+func (f *fakeManager) Controls(clusterName string) ([]*exporter.AgentControl, bool) {
+	if clusterName != "lama" {
+		return nil, false
+	}
+	return f.controls, true
+}
+
+func do(h http.Handler, method, path, token string) (*httptest.ResponseRecorder, exporter.AppGroupStatus) {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var status exporter.AppGroupStatus
+	json.Unmarshal(w.Body.Bytes(), &status)
+	return w, status
+}
+
+func TestHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().SetProbePaused("lama", gomock.Any(), gomock.Any()).AnyTimes()
+	push := exporter.NewAgentControl("lama", o11y.PROBE_PUSH, mr)
+	es := exporter.NewAgentControl("lama", o11y.PROBE_ELASTICSEARCH, mr)
+	h := NewHandler(&fakeManager{controls: []*exporter.AgentControl{push, es}}, "s3cret")
+
+	w, _ := do(h, "GET", "/admin/app_groups", "s3cret")
+	var statuses []exporter.AppGroupStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); w.Code != http.StatusOK || err != nil || len(statuses[0].Agents) != 2 {
+		t.Errorf("Should list app groups, got: %d %s", w.Code, w.Body.String())
+	}
+
+	w, status := do(h, "POST", "/admin/app_groups/lama/push/pause", "s3cret")
+	if w.Code != http.StatusOK || !status.Agents[0].Paused || status.Agents[1].Paused {
+		t.Errorf("Should pause push only, got: %d %s", w.Code, w.Body.String())
+	}
+
+	w, status = do(h, "POST", "/admin/app_groups/lama/pause", "s3cret")
+	if w.Code != http.StatusOK || !status.Agents[0].Paused || !status.Agents[1].Paused {
+		t.Errorf("Should pause every agent, got: %d %s", w.Code, w.Body.String())
+	}
+
+	do(h, "POST", "/admin/app_groups/lama/elasticsearch/trigger", "s3cret")
+	if !es.ShouldRun() || push.ShouldRun() {
+		t.Errorf("Should trigger elasticsearch only")
+	}
+
+	w, status = do(h, "POST", "/admin/app_groups/lama/resume", "s3cret")
+	if w.Code != http.StatusOK || status.Agents[0].Paused || status.Agents[1].Paused {
+		t.Errorf("Should resume every agent, got: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_errors(t *testing.T) {
+	cases := []struct {
+		method, path, token string
+		code                int
+	}{
+		{"GET", "/admin/app_groups", "", http.StatusUnauthorized},
+		{"GET", "/admin/app_groups", "wrong", http.StatusUnauthorized},
+		{"POST", "/admin/app_groups", "s3cret", http.StatusMethodNotAllowed},
+		{"GET", "/admin/app_groups/lama/pause", "s3cret", http.StatusMethodNotAllowed},
+		{"POST", "/admin/app_groups/lama/stop", "s3cret", http.StatusBadRequest},
+		{"POST", "/admin/app_groups/unta/pause", "s3cret", http.StatusNotFound},
+		{"POST", "/admin/app_groups/lama/kibana/pause", "s3cret", http.StatusNotFound},
+		{"POST", "/admin/app_groups/lama/push/pause/now", "s3cret", http.StatusNotFound},
+	}
+
+	h := NewHandler(&fakeManager{}, "s3cret")
+	for _, c := range cases {
+		if w, _ := do(h, c.method, c.path, c.token); w.Code != c.code {
+			t.Errorf("%s %s should respond %d, got: %d %s", c.method, c.path, c.code, w.Code, w.Body.String())
+		}
+	}
+
+	if w, _ := do(NewHandler(&fakeManager{}, ""), "GET", "/admin/app_groups", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Should refuse every request without token, got: %d", w.Code)
+	}
+}
@@ -1,48 +1,161 @@
 package appgroup
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/redact"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
 	"github.com/Jeffail/gabs/v2"
 	log "github.com/sirupsen/logrus"
 )
 
 type AppGroup interface {
-	RefreshMetadata() error
+	RefreshMetadata(ctx context.Context) error
 	GetName() string
 	GetClusterName() string
 	GetSecret() string
-	GetListES() ([]string, error)
-	GetListKafka() ([]string, error)
-	GetKibanaHost() (string, error)
+	GetCapacity() string
+	GetStatus() string
+	GetEnvironment() string
+	GetLogRetentionDays() int
+	GetTPS() float64
+	GetMaxTPS() float64
+	GetApps() []App
+	GetLabels() map[string]string
+	GetRouterURL() string
+	GetEndpoints() Endpoints
+	GetMetadata() Metadata
+	GetListES(ctx context.Context) ([]string, error)
+	GetListKafka(ctx context.Context) ([]string, error)
+	GetKibanaHost(ctx context.Context) (string, error)
+}
+
+type App struct {
+	Name   string  `json:"name"`
+	TPS    float64 `json:"tps"`
+	MaxTPS float64 `json:"max_tps"`
+}
+
+// Metadata is what BaritoMarket tells about an app group, saved along the
+// state so app groups restored from it are probed with their router, apps
+// and labels before their first refresh.
+type Metadata struct {
+	Name               string            `json:"name,omitempty"`
+	Capacity           string            `json:"capacity,omitempty"`
+	Status             string            `json:"status,omitempty"`
+	Environment        string            `json:"environment,omitempty"`
+	LogRetentionDays   int               `json:"log_retention_days,omitempty"`
+	Apps               []App             `json:"apps,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	RouterURL          string            `json:"router_url,omitempty"`
+	ConsulHosts        []string          `json:"consul_hosts,omitempty"`
+	ConsulServiceNames map[string]string `json:"consul_service_names,omitempty"`
+}
+
+// Endpoints take precedence over the ones discovered from consul, for app
+// groups defined statically.
+type Endpoints struct {
+	Elasticsearch []string
+	Kibana        string
+	Kafka         []string
+}
+
+func (e Endpoints) IsEmpty() bool {
+	return len(e.Elasticsearch) == 0 && e.Kibana == "" && len(e.Kafka) == 0
+}
+
+// SameConfig tells whether a and b are probed alike: same secret, router
+// and static endpoints. Metadata refreshed by the agents isn't compared.
+func SameConfig(a, b AppGroup) bool {
+	return a.GetSecret() == b.GetSecret() &&
+		a.GetRouterURL() == b.GetRouterURL() &&
+		reflect.DeepEqual(a.GetEndpoints(), b.GetEndpoints())
 }
 
 type appGroup struct {
-	name               string
 	clusterName        string
-	consulHosts        []string
-	consulServiceNames map[string]string
 	baritoMarketHost   string
 	baritoMarketToken  string
+	baritoMarketHeader string
 	secret             string
+	endpoints          Endpoints
+	marketRetryPolicy  retry.Policy
+	consulRetryPolicy  retry.Policy
+	upstreams          *retry.Upstreams
+
+	// metadata, refreshed by an agent while the others read it
+	mu                 sync.RWMutex
+	name               string
+	consulHosts        []string
+	consulServiceNames map[string]string
+	capacity           string
+	status             string
+	environment        string
+	logRetentionDays   int
+	tps                float64
+	maxTPS             float64
+	apps               []App
+	labels             map[string]string
+	routerURL          string
 }
 
-func NewAppGroup(clusterName, secret string, cfg *config.Config) *appGroup {
+func NewAppGroup(clusterName, secret string, cfg *config.Config, upstreams *retry.Upstreams) *appGroup {
+	redact.Register(secret)
 	return &appGroup{
-		clusterName:       clusterName,
-		secret:            secret,
-		baritoMarketHost:  cfg.BaritoMarketHost,
-		baritoMarketToken: cfg.BaritoMarketToken,
+		clusterName:        clusterName,
+		secret:             secret,
+		baritoMarketHost:   cfg.BaritoMarketHost,
+		baritoMarketToken:  cfg.BaritoMarketToken,
+		baritoMarketHeader: cfg.BaritoMarketTokenHeader,
+		marketRetryPolicy:  marketRetryPolicy(cfg),
+		consulRetryPolicy:  retry.NewPolicy(cfg.ConsulRetries, cfg.ConsulRetryBackoff, cfg.ConsulRetryStatusCodes),
+		upstreams:          upstreams,
 	}
 }
 
+// NewAppGroupWithMetadata restores an app group saved along the state.
+func NewAppGroupWithMetadata(clusterName, secret string, md Metadata, cfg *config.Config, upstreams *retry.Upstreams) *appGroup {
+	a := NewAppGroup(clusterName, secret, cfg, upstreams)
+	a.name = md.Name
+	a.capacity = md.Capacity
+	a.status = md.Status
+	a.environment = md.Environment
+	a.logRetentionDays = md.LogRetentionDays
+	a.apps = md.Apps
+	a.labels = md.Labels
+	a.routerURL = md.RouterURL
+	a.consulHosts = md.ConsulHosts
+	a.consulServiceNames = md.ConsulServiceNames
+	return a
+}
+
+func marketRetryPolicy(cfg *config.Config) retry.Policy {
+	return retry.NewPolicy(cfg.BaritoMarketRetries, cfg.BaritoMarketRetryBackoff, cfg.BaritoMarketRetryStatusCodes)
+}
+
+func NewStaticAppGroup(clusterName, secret string, endpoints Endpoints, cfg *config.Config, upstreams *retry.Upstreams) *appGroup {
+	a := NewAppGroup(clusterName, secret, cfg, upstreams)
+	a.endpoints = endpoints
+	return a
+}
+
 func (a *appGroup) GetName() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.name
 }
 
@@ -54,21 +167,146 @@ func (a *appGroup) GetSecret() string {
 	return a.secret
 }
 
-func (a *appGroup) RefreshMetadata() error {
-	rawJson, err := fetchAppgroupMetadata(a.clusterName, a.baritoMarketHost, a.baritoMarketToken)
+func (a *appGroup) GetCapacity() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.capacity
+}
+
+func (a *appGroup) GetStatus() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.status
+}
+
+func (a *appGroup) GetEnvironment() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.environment
+}
+
+func (a *appGroup) GetLogRetentionDays() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.logRetentionDays
+}
+
+func (a *appGroup) GetTPS() float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.tps
+}
+
+func (a *appGroup) GetMaxTPS() float64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.maxTPS
+}
+
+func (a *appGroup) GetApps() []App {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.apps
+}
+
+func (a *appGroup) GetLabels() map[string]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.labels
+}
+
+func (a *appGroup) logger() *log.Entry {
+	return log.WithField(logging.FIELD_APP_GROUP, a.clusterName)
+}
+
+// GetRouterURL returns the router advertised by BaritoMarket for the app
+// group, if any.
+func (a *appGroup) GetRouterURL() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.routerURL
+}
+
+func (a *appGroup) GetMetadata() Metadata {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return Metadata{
+		Name:               a.name,
+		Capacity:           a.capacity,
+		Status:             a.status,
+		Environment:        a.environment,
+		LogRetentionDays:   a.logRetentionDays,
+		Apps:               a.apps,
+		Labels:             a.labels,
+		RouterURL:          a.routerURL,
+		ConsulHosts:        a.consulHosts,
+		ConsulServiceNames: a.consulServiceNames,
+	}
+}
+
+// GetEndpoints returns the static endpoints of the app group, empty when
+// discovered from consul.
+func (a *appGroup) GetEndpoints() Endpoints {
+	return a.endpoints
+}
+
+func (a *appGroup) RefreshMetadata(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "RefreshMetadata")
+	span.SetAttribute("app_group", a.clusterName)
+	defer func() { span.End(err) }()
+
+	var rawJson []byte
+	err = a.upstreams.For(o11y.UPSTREAM_BARITO_MARKET).Do(a.baritoMarketHost, a.marketRetryPolicy, func() error {
+		var err error
+		rawJson, err = fetchAppgroupMetadata(ctx, a.clusterName, a.baritoMarketHost, a.baritoMarketToken, a.baritoMarketHeader)
+		return err
+	})
 	if err != nil {
+		// app group with static endpoints can be probed without BaritoMarket
+		if !a.endpoints.IsEmpty() {
+			a.logger().WithError(err).Debug("Failed to fetch metadata, using static endpoints")
+			return nil
+		}
 		return err
 	}
 	g, err := gabs.ParseJSON(rawJson)
 	if err != nil {
 		return err
 	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	// get name
 	name, ok := g.Path("name").Data().(string)
 	if ok {
 		a.name = name
 	}
 
+	a.parseAttributes(g)
+
+	// get throughput & quota, for the app group and each of its apps
+	if tps, ok := g.Path("tps").Data().(float64); ok {
+		a.tps = tps
+	}
+	if maxTPS, ok := g.Path("max_tps").Data().(float64); ok {
+		a.maxTPS = maxTPS
+	}
+	if g.Exists("apps") {
+		apps := []App{}
+		for _, v := range g.Path("apps").Children() {
+			appName, ok := v.Path("name").Data().(string)
+			if !ok {
+				continue
+			}
+			app := App{Name: appName}
+			app.TPS, _ = v.Path("tps").Data().(float64)
+			app.MaxTPS, _ = v.Path("max_tps").Data().(float64)
+			apps = append(apps, app)
+		}
+		a.apps = apps
+	}
+
 	// get consul_hosts
 	consulHosts := []string{}
 	for _, v := range g.Path("consul_hosts").Children() {
@@ -94,49 +332,86 @@ func (a *appGroup) RefreshMetadata() error {
 	return nil
 }
 
-func (a *appGroup) GetListES() ([]string, error) {
-	if len(a.consulHosts) == 0 {
-		log.Errorf("Can't fetch ES, no consul to contacted to")
+// parseAttributes reads the attributes found both on the profile and on the
+// profile index of BaritoMarket. a.mu must be held.
+func (a *appGroup) parseAttributes(g *gabs.Container) {
+	// get capacity, status, environment & retention
+	if capacity, ok := g.Path("capacity").Data().(string); ok {
+		a.capacity = capacity
+	}
+	if status, ok := g.Path("status").Data().(string); ok {
+		a.status = status
+	}
+	if environment, ok := g.Path("environment").Data().(string); ok {
+		a.environment = environment
+	}
+	if retention, ok := g.Path("log_retention_days").Data().(float64); ok {
+		a.logRetentionDays = int(retention)
+	}
+	if routerURL, ok := g.Path("router_url").Data().(string); ok {
+		a.routerURL = routerURL
+	}
+
+	// get labels
+	if g.Exists("labels") {
+		labels := map[string]string{}
+		for k, v := range g.Path("labels").ChildrenMap() {
+			if vString, ok := v.Data().(string); ok {
+				labels[k] = vString
+			}
+		}
+		a.labels = labels
+	}
+}
+
+func (a *appGroup) GetListES(ctx context.Context) ([]string, error) {
+	if len(a.endpoints.Elasticsearch) > 0 {
+		return withScheme(a.endpoints.Elasticsearch), nil
+	}
+
+	consulHosts, consulServiceNames := a.consul()
+	if len(consulHosts) == 0 {
+		a.logger().Error("Can't fetch ES, no consul to contacted to")
 		return nil, errors.New("Can't fetch ES, no consul to contacted to")
 	}
 
-	serviceName, ok := a.consulServiceNames["elasticsearch"]
+	serviceName, ok := consulServiceNames["elasticsearch"]
 	if !ok {
-		log.Errorf("Can't find elasticsearch service name")
+		a.logger().Error("Can't find elasticsearch service name")
 		return nil, errors.New("Can't find elasticsearch service name")
 	}
-	for _, consul := range a.consulHosts {
-		listES, err := fetchConsulServices(consul, serviceName)
+	for _, consul := range consulHosts {
+		listES, err := a.fetchConsulServices(ctx, consul, serviceName)
 		if err != nil {
-			log.Errorf("Failed to fetch elasticsearch, error: %v", err)
+			a.logger().WithField(logging.FIELD_ENDPOINT, consul).WithError(err).Error("Failed to fetch elasticsearch")
 			continue
 		}
 
-		for i := 0; i < len(listES); i++ {
-			if !strings.HasPrefix(listES[i], "http") {
-				listES[i] = "http://" + listES[i]
-			}
-		}
-		return listES, nil
+		return withScheme(listES), nil
 	}
 	return nil, errors.New("No ES found")
 }
 
-func (a *appGroup) GetListKafka() ([]string, error) {
-	if len(a.consulHosts) == 0 {
-		log.Errorf("Can't fetch Kafka, no consul to contacted to")
+func (a *appGroup) GetListKafka(ctx context.Context) ([]string, error) {
+	if len(a.endpoints.Kafka) > 0 {
+		return a.endpoints.Kafka, nil
+	}
+
+	consulHosts, consulServiceNames := a.consul()
+	if len(consulHosts) == 0 {
+		a.logger().Error("Can't fetch Kafka, no consul to contacted to")
 		return nil, errors.New("Can't fetch Kafka, no consul to contacted to")
 	}
 
-	serviceName, ok := a.consulServiceNames["kafka"]
+	serviceName, ok := consulServiceNames["kafka"]
 	if !ok {
-		log.Errorf("Can't find kafka service name")
+		a.logger().Error("Can't find kafka service name")
 		return nil, errors.New("Can't find kafka service name")
 	}
-	for _, consul := range a.consulHosts {
-		listKafka, err := fetchConsulServices(consul, serviceName)
+	for _, consul := range consulHosts {
+		listKafka, err := a.fetchConsulServices(ctx, consul, serviceName)
 		if err != nil {
-			log.Errorf("Failed to fetch kafka, error: %v", err)
+			a.logger().WithField(logging.FIELD_ENDPOINT, consul).WithError(err).Error("Failed to fetch kafka")
 			continue
 		}
 		return listKafka, nil
@@ -144,36 +419,76 @@ func (a *appGroup) GetListKafka() ([]string, error) {
 	return nil, errors.New("No Kafka found")
 }
 
-func (a *appGroup) GetKibanaHost() (string, error) {
-	if len(a.consulHosts) == 0 {
-		log.Errorf("Can't fetch kibana, no consul to contacted to")
+func (a *appGroup) GetKibanaHost(ctx context.Context) (string, error) {
+	if a.endpoints.Kibana != "" {
+		return withScheme([]string{a.endpoints.Kibana})[0], nil
+	}
+
+	consulHosts, consulServiceNames := a.consul()
+	if len(consulHosts) == 0 {
+		a.logger().Error("Can't fetch kibana, no consul to contacted to")
 		return "", errors.New("Can't fetch kibana, no consul to contacted to")
 	}
 
-	serviceName, ok := a.consulServiceNames["kibana"]
+	serviceName, ok := consulServiceNames["kibana"]
 	if !ok {
-		log.Errorf("Can't find kibana service name")
+		a.logger().Error("Can't find kibana service name")
 		return "", errors.New("Can't find kibana service name")
 	}
-	for _, consul := range a.consulHosts {
-		kibanaHost, err := fetchConsulServices(consul, serviceName)
+	for _, consul := range consulHosts {
+		kibanaHost, err := a.fetchConsulServices(ctx, consul, serviceName)
 		if err != nil || len(kibanaHost) == 0 {
-			log.Errorf("Failed to fetch kibana, error: %v", err)
+			a.logger().WithField(logging.FIELD_ENDPOINT, consul).WithError(err).Error("Failed to fetch kibana")
 			continue
 		}
-		for i := 0; i < len(kibanaHost); i++ {
-			if !strings.HasPrefix(kibanaHost[i], "http") {
-				kibanaHost[i] = "http://" + kibanaHost[i]
-			}
-		}
-		return kibanaHost[0], nil
+		return withScheme(kibanaHost)[0], nil
 	}
 	return "", errors.New("No Kibana found")
 }
 
-func fetchConsulServices(consulHost, serviceName string) ([]string, error) {
+func (a *appGroup) consul() ([]string, map[string]string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.consulHosts, a.consulServiceNames
+}
+
+func withScheme(hosts []string) []string {
+	result := make([]string, len(hosts))
+	for i, host := range hosts {
+		if !strings.HasPrefix(host, "http") {
+			host = "http://" + host
+		}
+		result[i] = host
+	}
+	return result
+}
+
+// fetchConsulServices shares a breaker per consul host with every other app
+// group using it.
+func (a *appGroup) fetchConsulServices(ctx context.Context, consulHost, serviceName string) ([]string, error) {
+	return FetchConsulServices(ctx, a.upstreams, consulHost, serviceName, a.consulRetryPolicy)
+}
+
+// FetchConsulServices returns the address:port of the healthy instances of
+// serviceName, sharing the consul breaker with the app groups.
+func FetchConsulServices(ctx context.Context, upstreams *retry.Upstreams, consulHost, serviceName string, policy retry.Policy) (hosts []string, err error) {
+	ctx, span := tracing.Start(ctx, "fetchConsulServices")
+	span.SetAttribute("consul.host", consulHost)
+	span.SetAttribute("consul.service", serviceName)
+	defer func() { span.End(err) }()
+
+	err = upstreams.For(o11y.UPSTREAM_CONSUL).Do(consulHost, policy, func() error {
+		var err error
+		hosts, err = fetchConsulServices(ctx, consulHost, serviceName)
+		return err
+	})
+	return hosts, err
+}
+
+func fetchConsulServices(ctx context.Context, consulHost, serviceName string) ([]string, error) {
 	var c = &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout:   5 * time.Second,
+		Transport: tracing.NewTransport(nil),
 	}
 
 	if !strings.HasPrefix(consulHost, "http") {
@@ -185,14 +500,17 @@ func fetchConsulServices(consulHost, serviceName string) ([]string, error) {
 	if err != nil {
 		return nil, errors.New("failed to create request")
 	}
+	req = req.WithContext(ctx)
 
 	resp, err := c.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("Got response status %d when fetch service %q from consul %q", resp.StatusCode, serviceName, consulHost)
+		err = fmt.Errorf("Failed to fetch service %q from consul %q: %w", serviceName, consulHost, &retry.StatusError{StatusCode: resp.StatusCode})
 		return nil, err
 	}
 
@@ -217,25 +535,29 @@ func fetchConsulServices(consulHost, serviceName string) ([]string, error) {
 	return hosts, nil
 }
 
-func fetchAppgroupMetadata(clusterName, baritoMarketHost, accessToken string) ([]byte, error) {
+func fetchAppgroupMetadata(ctx context.Context, clusterName, baritoMarketHost, accessToken, accessTokenHeader string) ([]byte, error) {
 	var c = &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: tracing.NewTransport(nil),
 	}
 
-	url := fmt.Sprintf("%s/api/v2/profile_by_cluster_name?cluster_name=%s&access_token=%s", baritoMarketHost, clusterName, accessToken)
+	url := fmt.Sprintf("%s/api/v2/profile_by_cluster_name?cluster_name=%s", baritoMarketHost, clusterName)
 	req, err := http.NewRequest("GET", url, strings.NewReader(""))
 	if err != nil {
 		return []byte(""), errors.New("failed to create request")
 	}
+	req = req.WithContext(ctx)
+	setMarketToken(req, accessToken, accessTokenHeader)
 
 	resp, err := c.Do(req)
 	if err != nil {
-		return []byte(""), err
+		return []byte(""), redact.Error(err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("Got response status %d", resp.StatusCode)
-		log.Debugf("Request fetch metadata got status: %d, appGroup: %q", resp.StatusCode, clusterName)
+		err = &retry.StatusError{StatusCode: resp.StatusCode}
+		log.WithField(logging.FIELD_APP_GROUP, clusterName).Debugf("Request fetch metadata got status: %d", resp.StatusCode)
 		return []byte(""), err
 	}
 
@@ -247,42 +569,215 @@ func fetchAppgroupMetadata(clusterName, baritoMarketHost, accessToken string) ([
 	return body, nil
 }
 
-func GetListAppGroups(cfg config.Config) ([]*appGroup, error) {
+// GetListAppGroups walks the BaritoMarket profile index. The next page is
+// taken from the Link header, the X-Total-Pages header or the "meta" of the
+// body when BaritoMarket provides them, otherwise listing stops on the first
+// page smaller than the first one. On error, the app groups of the pages
+// fetched so far are returned along with it.
+func GetListAppGroups(cfg config.Config, upstreams *retry.Upstreams) ([]*appGroup, error) {
 	result := []*appGroup{}
+	c := &http.Client{
+		Timeout: cfg.BaritoMarketTimeout,
+	}
 
-	maxPage := 100
-	page := 1
-	for {
-		url := fmt.Sprintf("%s%s?page=%d&access_token=%s", cfg.BaritoMarketHost, cfg.BaritoMarketProfileIndexPath, page, cfg.BaritoMarketToken)
-		resp, err := http.Get(url)
+	pageSize := 0
+	url := profileIndexURL(cfg, 1)
+	for page := 1; ; page++ {
+		p, err := fetchProfileIndexPage(c, url, &cfg, upstreams)
 		if err != nil {
-			return nil, err
+			return result, fmt.Errorf("Failed to fetch page %d: %v", page, err)
 		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+		result = append(result, p.appGroups...)
+
+		if page == 1 {
+			pageSize = p.size
 		}
+		if cfg.BaritoMarketMaxPages > 0 && page >= cfg.BaritoMarketMaxPages {
+			log.Warnf("Stop listing app groups after reaching max page: %d", page)
+			break
+		}
+
+		if p.hasLink {
+			if p.nextURL == "" {
+				break
+			}
+			url = p.nextURL
+			continue
+		}
+		if p.totalPages > 0 && page >= p.totalPages {
+			break
+		}
+		if p.totalPages == 0 && (p.size == 0 || p.size < pageSize) {
+			break
+		}
+		url = profileIndexURL(cfg, page+1)
+	}
+
+	return result, nil
+}
+
+func profileIndexURL(cfg config.Config, page int) string {
+	return fmt.Sprintf("%s%s?page=%d", cfg.BaritoMarketHost, cfg.BaritoMarketProfileIndexPath, page)
+}
+
+// setMarketToken sends the token in the configured header, or else as the
+// access_token query param. The header keeps it out of logged URLs and
+// proxy logs.
+func setMarketToken(req *http.Request, token, header string) {
+	if header != "" {
+		req.Header.Set(header, token)
+		return
+	}
+	q := req.URL.Query()
+	q.Set("access_token", token)
+	req.URL.RawQuery = q.Encode()
+}
+
+type profileIndexPage struct {
+	appGroups  []*appGroup
+	size       int
+	hasLink    bool
+	nextURL    string
+	totalPages int
+}
+
+// fetchProfileIndexPage retries on network errors, the configured statuses
+// and unreadable bodies, waiting longer after each attempt.
+func fetchProfileIndexPage(c *http.Client, url string, cfg *config.Config, upstreams *retry.Upstreams) (*profileIndexPage, error) {
+	var p *profileIndexPage
+	err := upstreams.For(o11y.UPSTREAM_BARITO_MARKET).Do(cfg.BaritoMarketHost, marketRetryPolicy(cfg), func() error {
+		var err error
+		p, err = doFetchProfileIndexPage(c, url, cfg, upstreams)
+		return err
+	})
+	return p, err
+}
+
+func doFetchProfileIndexPage(c *http.Client, url string, cfg *config.Config, upstreams *retry.Upstreams) (*profileIndexPage, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.New("failed to create request")
+	}
+	setMarketToken(req, cfg.BaritoMarketToken, cfg.BaritoMarketTokenHeader)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, redact.Error(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &retry.StatusError{StatusCode: resp.StatusCode}
+	}
 
-		jsonParsed, err := gabs.ParseJSON(body)
+	p := &profileIndexPage{}
+	if link := resp.Header.Get("Link"); link != "" {
+		p.hasLink = true
+		p.nextURL = nextLink(link)
+	}
+	if totalPages, err := strconv.Atoi(resp.Header.Get("X-Total-Pages")); err == nil {
+		p.totalPages = totalPages
+	}
+
+	err = decodeProfileIndex(json.NewDecoder(resp.Body), func(item []byte) {
+		p.size++
+		g, err := gabs.ParseJSON(item)
 		if err != nil {
-			return nil, err
+			return
 		}
+		clusterName, clusterNameOk := g.Path("cluster_name").Data().(string)
+		appgroupSecret, appGroupSecretOk := g.Path("app_group_secret").Data().(string)
+		if clusterNameOk && appGroupSecretOk {
+			aG := NewAppGroup(clusterName, appgroupSecret, cfg, upstreams)
+			aG.mu.Lock()
+			aG.parseAttributes(g)
+			aG.mu.Unlock()
+			p.appGroups = append(p.appGroups, aG)
+		}
+	}, func(totalPages int) {
+		p.totalPages = totalPages
+	})
+	if err != nil {
+		// a truncated or non json body, e.g. an error page from a proxy, may
+		// succeed on retry
+		return nil, retry.Retryable(err)
+	}
+	return p, nil
+}
+
+// decodeProfileIndex streams either a plain array of profiles, or an object
+// holding them under "data" with pagination under "meta", one profile at a
+// time so a large index is never held in memory as a whole.
+func decodeProfileIndex(d *json.Decoder, onItem func([]byte), onTotalPages func(int)) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
 
-		for _, c := range jsonParsed.Children() {
-			clusterName, clusterNameOk := c.Path("cluster_name").Data().(string)
-			appgroupSecret, appGroupSecretOk := c.Path("app_group_secret").Data().(string)
-			if clusterNameOk && appGroupSecretOk {
-				result = append(result, NewAppGroup(clusterName, appgroupSecret, &cfg))
+	switch t {
+	case json.Delim('['):
+		return decodeArray(d, onItem)
+	case json.Delim('{'):
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "data":
+				if t, err := d.Token(); err != nil || t != json.Delim('[') {
+					return errors.New("Expected an array of profiles under data")
+				}
+				if err := decodeArray(d, onItem); err != nil {
+					return err
+				}
+			case "meta":
+				var meta struct {
+					TotalPages int `json:"total_pages"`
+				}
+				if err := d.Decode(&meta); err != nil {
+					return err
+				}
+				if meta.TotalPages > 0 {
+					onTotalPages(meta.TotalPages)
+				}
+			default:
+				var skip json.RawMessage
+				if err := d.Decode(&skip); err != nil {
+					return err
+				}
 			}
 		}
+		_, err := d.Token()
+		return err
+	}
+	return fmt.Errorf("Unexpected profile index token: %v", t)
+}
 
-		if len(jsonParsed.Children()) < 10 || page >= maxPage {
-			break
+func decodeArray(d *json.Decoder, onItem func([]byte)) error {
+	for d.More() {
+		var item json.RawMessage
+		if err := d.Decode(&item); err != nil {
+			return err
 		}
-
-		page++
+		onItem(item)
 	}
+	_, err := d.Token()
+	return err
+}
 
-	return result, nil
+// nextLink returns the rel="next" URL of a Link header, if any.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.Replace(strings.TrimSpace(param), " ", "", -1) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(parts[0]), "<>")
+			}
+		}
+	}
+	return ""
 }
@@ -1,6 +1,7 @@
 package appgroup
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
 )
@@ -25,6 +27,18 @@ func TestRefreshMetadata(t *testing.T) {
 		resp := `
 		{
 			"name": "SomeAppgroup",
+			"capacity": "small",
+			"status": "ACTIVE",
+			"environment": "production",
+			"log_retention_days": 14,
+			"labels": { "team": "core" },
+			"router_url": "https://router-jkt.example.com",
+			"tps": 50,
+			"max_tps": 100,
+			"apps": [
+			  { "name": "app-1", "tps": 20, "max_tps": 40 },
+			  { "name": "app-2", "tps": 30, "max_tps": 60 }
+			],
 			"consul_hosts": [ "one", "two", "three" ],
 			"meta": {
 			  "service_names": { "elasticsearch": "elasticsearch" } }
@@ -40,13 +54,25 @@ func TestRefreshMetadata(t *testing.T) {
 	expectedAppGroup := appGroup{
 		clusterName:        "lama",
 		name:               "SomeAppgroup",
+		capacity:           "small",
+		status:             "ACTIVE",
+		environment:        "production",
+		logRetentionDays:   14,
+		labels:             map[string]string{"team": "core"},
+		routerURL:          "https://router-jkt.example.com",
+		tps:                50,
+		maxTPS:             100,
 		consulHosts:        []string{"one", "two", "three"},
 		consulServiceNames: map[string]string{"elasticsearch": "elasticsearch"},
 		baritoMarketHost:   srv.URL,
 		baritoMarketToken:  "ABC12345",
+		apps: []App{
+			{Name: "app-1", TPS: 20, MaxTPS: 40},
+			{Name: "app-2", TPS: 30, MaxTPS: 60},
+		},
 	}
 
-	err := aG.RefreshMetadata()
+	err := aG.RefreshMetadata(context.Background())
 	if err != nil {
 		t.Errorf("Should not return error, got: %v", err)
 	}
@@ -65,8 +91,55 @@ func TestRefreshMetadata(t *testing.T) {
 		t.Errorf("Should called barito market at with query:\n%v\ngot:\n%v", expectedQuery, queryCalled)
 	}
 
-	if !reflect.DeepEqual(aG, expectedAppGroup) {
-		t.Errorf("Failed to parse metadata, want:\n%+v, got:\n%+v", expectedAppGroup, aG)
+	if !reflect.DeepEqual(&aG, &expectedAppGroup) {
+		t.Errorf("Failed to parse metadata, want:\n%+v, got:\n%+v", &expectedAppGroup, &aG)
+	}
+}
+
+func TestNewAppGroupWithMetadata(t *testing.T) {
+	md := Metadata{
+		Name:               "SomeAppgroup",
+		Status:             "ACTIVE",
+		Labels:             map[string]string{"team": "core"},
+		RouterURL:          "https://router-jkt.example.com",
+		Apps:               []App{{Name: "app-1"}},
+		ConsulHosts:        []string{"one"},
+		ConsulServiceNames: map[string]string{"elasticsearch": "elasticsearch"},
+	}
+
+	aG := NewAppGroupWithMetadata("lama", "ABC", md, &config.Config{}, nil)
+	if got := aG.GetMetadata(); !reflect.DeepEqual(got, md) {
+		t.Errorf("Should restore metadata, want:\n%+v, got:\n%+v", md, got)
+	}
+	if aG.GetRouterURL() != md.RouterURL || aG.GetLabels()["team"] != "core" {
+		t.Errorf("Should probe with restored metadata before the first refresh")
+	}
+}
+
+// TestRefreshMetadata_concurrent is meant to be run with -race.
+func TestRefreshMetadata_concurrent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name": "SomeAppgroup", "status": "ACTIVE", "labels": {"team": "core"}, "consul_hosts": ["one"]}`))
+	}))
+	defer srv.Close()
+
+	aG := NewAppGroup("lama", "ABC", &config.Config{BaritoMarketHost: srv.URL}, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			aG.RefreshMetadata(context.Background())
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		aG.GetMetadata()
+		aG.GetStatus()
+		aG.GetLabels()
+	}
+	<-done
+
+	if aG.GetName() != "SomeAppgroup" {
+		t.Errorf("Should refresh metadata, got name: %q", aG.GetName())
 	}
 }
 
@@ -90,7 +163,7 @@ func TestGetListES(t *testing.T) {
 		consulServiceNames: map[string]string{"elasticsearch": "elasticsearch"},
 	}
 
-	listES, err := aG.GetListES()
+	listES, err := aG.GetListES(context.Background())
 	if err != nil {
 		t.Fatalf("Should not return error, got: %v", err)
 	}
@@ -125,7 +198,7 @@ func TestGetKibanaHost(t *testing.T) {
 		consulServiceNames: map[string]string{"kibana": "kibana"},
 	}
 
-	kibanaHost, err := aG.GetKibanaHost()
+	kibanaHost, err := aG.GetKibanaHost(context.Background())
 	if err != nil {
 		t.Fatalf("Should not return error, got: %v", err)
 	}
@@ -161,7 +234,7 @@ func TestGetListKafka(t *testing.T) {
 		consulServiceNames: map[string]string{"kafka": "kafka"},
 	}
 
-	kafkaHosts, err := aG.GetListKafka()
+	kafkaHosts, err := aG.GetListKafka(context.Background())
 	if err != nil {
 		t.Fatalf("Should not return error, got: %v", err)
 	}
@@ -194,7 +267,7 @@ func TestGetListAppGroups(t *testing.T) {
 		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 		if page == 1 {
 			for i := 1; i <= 10; i++ {
-				bodyList = append(bodyList, fmt.Sprintf(`{"cluster_name": "%d", "app_group_secret": "abc"}`, i))
+				bodyList = append(bodyList, fmt.Sprintf(`{"cluster_name": "%d", "app_group_secret": "abc", "status": "ACTIVE"}`, i))
 			}
 		}
 
@@ -213,7 +286,7 @@ func TestGetListAppGroups(t *testing.T) {
 		BaritoMarketProfileIndexPath: "/api/v2/profile_index",
 	}
 
-	appGroups, err := GetListAppGroups(cfg)
+	appGroups, err := GetListAppGroups(cfg, nil)
 	if err != nil {
 		t.Fatalf("Should not return error, got: %v", err)
 	}
@@ -225,4 +298,126 @@ func TestGetListAppGroups(t *testing.T) {
 	if len(appGroups) != 12 {
 		t.Fatalf("Should return 12 appgroups, got: %d", len(appGroups))
 	}
+
+	if appGroups[0].GetStatus() != "ACTIVE" {
+		t.Errorf("Should parse attributes from profile index, got status: %q", appGroups[0].GetStatus())
+	}
+}
+
+func TestGetListAppGroups_pagination(t *testing.T) {
+	cases := map[string]func(w http.ResponseWriter, r *http.Request, page int){
+		"link header": func(w http.ResponseWriter, r *http.Request, page int) {
+			if page < 3 {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=%d>; rel="next", <http://%s%s?page=3>; rel="last"`, r.Host, r.URL.Path, page+1, r.Host, r.URL.Path))
+			} else {
+				w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?page=1>; rel="first"`, r.Host, r.URL.Path))
+			}
+			fmt.Fprintf(w, `[{"cluster_name": "%d", "app_group_secret": "abc"}]`, page)
+		},
+		"total pages header": func(w http.ResponseWriter, r *http.Request, page int) {
+			w.Header().Set("X-Total-Pages", "3")
+			fmt.Fprintf(w, `[{"cluster_name": "%d", "app_group_secret": "abc"}]`, page)
+		},
+		"meta": func(w http.ResponseWriter, r *http.Request, page int) {
+			fmt.Fprintf(w, `{"data": [{"cluster_name": "%d", "app_group_secret": "abc"}], "meta": {"total_pages": 3}}`, page)
+		},
+	}
+
+	for name, handler := range cases {
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			handler(w, r, page)
+		}))
+
+		cfg := config.Config{
+			BaritoMarketHost:             srv.URL,
+			BaritoMarketProfileIndexPath: "/api/v2/profile_index",
+		}
+		appGroups, err := GetListAppGroups(cfg, nil)
+		srv.Close()
+
+		if err != nil {
+			t.Fatalf("%s: should not return error, got: %v", name, err)
+		}
+		if len(appGroups) != 3 || requests != 3 {
+			t.Errorf("%s: should fetch 3 pages of 1 app group, got: %d app groups in %d requests", name, len(appGroups), requests)
+		}
+	}
+}
+
+func TestGetListAppGroups_retryAndPartialResult(t *testing.T) {
+	requests := map[int]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		requests[page]++
+		switch {
+		case page == 1 && requests[page] == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case page == 1:
+			w.Header().Set("X-Total-Pages", "2")
+			w.Write([]byte(`[{"cluster_name": "lama", "app_group_secret": "abc"}]`))
+		default:
+			w.Write([]byte(`<html>Bad Gateway</html>`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		BaritoMarketHost:             srv.URL,
+		BaritoMarketProfileIndexPath: "/api/v2/profile_index",
+		BaritoMarketRetries:          1,
+		BaritoMarketRetryBackoff:     time.Millisecond,
+	}
+	appGroups, err := GetListAppGroups(cfg, nil)
+	if err == nil {
+		t.Fatalf("Should return error when a page can't be parsed")
+	}
+	if len(appGroups) != 1 || appGroups[0].GetClusterName() != "lama" {
+		t.Errorf("Should return app groups of the fetched pages, got: %+v", appGroups)
+	}
+	if requests[1] != 2 || requests[2] != 2 {
+		t.Errorf("Should retry each page once, got: %v", requests)
+	}
+}
+
+func TestBaritoMarketTokenInHeader(t *testing.T) {
+	requests := []*http.Request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.URL.Path == "/api/v2/profile_index" {
+			w.Header().Set("X-Total-Pages", "1")
+			w.Write([]byte(`[{"cluster_name": "lama", "app_group_secret": "abc"}]`))
+			return
+		}
+		w.Write([]byte(`{"name": "lama"}`))
+	}))
+	defer srv.Close()
+
+	cfg := config.Config{
+		BaritoMarketHost:             srv.URL,
+		BaritoMarketToken:            "ABC007",
+		BaritoMarketTokenHeader:      "X-Access-Token",
+		BaritoMarketProfileIndexPath: "/api/v2/profile_index",
+	}
+	appGroups, err := GetListAppGroups(cfg, nil)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	if err := appGroups[0].RefreshMetadata(context.Background()); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Should make 2 requests, got: %d", len(requests))
+	}
+	for _, r := range requests {
+		if r.URL.Query().Get("access_token") != "" {
+			t.Errorf("Should not send token in query string, got: %q", r.URL.String())
+		}
+		if r.Header.Get("X-Access-Token") != "ABC007" {
+			t.Errorf("Should send token in header, got: %q", r.Header.Get("X-Access-Token"))
+		}
+	}
 }
@@ -0,0 +1,130 @@
+package appgroup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	log "github.com/sirupsen/logrus"
+)
+
+// Filter decides which app groups are probed, by cluster name and by
+// attributes from BaritoMarket: status, environment, capacity and
+// label.<name>.
+type Filter struct {
+	includeName       *regexp.Regexp
+	excludeName       *regexp.Regexp
+	includeAttributes map[string][]string
+	excludeAttributes map[string][]string
+}
+
+// NewFilter parses the name regexes, empty means no constraint, and the
+// attribute lists, formatted as "status=ACTIVE,environment=production". An
+// app group is included when it matches every included attribute, any of
+// the values given for the same attribute, and excluded when it matches any
+// of the excluded attributes.
+func NewFilter(includeName, excludeName, includeAttributes, excludeAttributes string) (*Filter, error) {
+	f := &Filter{}
+
+	var err error
+	if includeName != "" {
+		if f.includeName, err = regexp.Compile(includeName); err != nil {
+			return nil, fmt.Errorf("Invalid include regex %q: %v", includeName, err)
+		}
+	}
+	if excludeName != "" {
+		if f.excludeName, err = regexp.Compile(excludeName); err != nil {
+			return nil, fmt.Errorf("Invalid exclude regex %q: %v", excludeName, err)
+		}
+	}
+	if f.includeAttributes, err = parseAttributeList(includeAttributes); err != nil {
+		return nil, err
+	}
+	if f.excludeAttributes, err = parseAttributeList(excludeAttributes); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseAttributeList(s string) (map[string][]string, error) {
+	result := map[string][]string{}
+	for _, pair := range splitList(strings.Replace(s, ",", ";", -1)) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid attribute %q, should be name=value", pair)
+		}
+		result[kv[0]] = append(result[kv[0]], kv[1])
+	}
+	return result, nil
+}
+
+func (f *Filter) Match(aG AppGroup) bool {
+	name := aG.GetClusterName()
+	if f.includeName != nil && !f.includeName.MatchString(name) {
+		return false
+	}
+	if f.excludeName != nil && f.excludeName.MatchString(name) {
+		return false
+	}
+	for attribute, values := range f.includeAttributes {
+		if !contains(values, attributeValue(aG, attribute)) {
+			return false
+		}
+	}
+	for attribute, values := range f.excludeAttributes {
+		if contains(values, attributeValue(aG, attribute)) {
+			return false
+		}
+	}
+	return true
+}
+
+func attributeValue(aG AppGroup, attribute string) string {
+	switch attribute {
+	case "status":
+		return aG.GetStatus()
+	case "environment":
+		return aG.GetEnvironment()
+	case "capacity":
+		return aG.GetCapacity()
+	}
+	if strings.HasPrefix(attribute, "label.") {
+		return aG.GetLabels()[strings.TrimPrefix(attribute, "label.")]
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type filteredSource struct {
+	source Source
+	filter *Filter
+}
+
+// NewFilteredSource applies the filter on every listing, so a change of
+// attributes on BaritoMarket is picked up on the next reconciliation.
+func NewFilteredSource(source Source, filter *Filter) *filteredSource {
+	return &filteredSource{source: source, filter: filter}
+}
+
+func (f *filteredSource) ListAppGroups() ([]AppGroup, error) {
+	appGroups, err := f.source.ListAppGroups()
+
+	result := []AppGroup{}
+	for _, aG := range appGroups {
+		if f.filter.Match(aG) {
+			result = append(result, aG)
+		} else {
+			log.WithField(logging.FIELD_APP_GROUP, aG.GetClusterName()).Debug("Skip filtered out app group")
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,60 @@
+package appgroup
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	lama := &appGroup{clusterName: "lama-prod", status: "ACTIVE", environment: "production", labels: map[string]string{"team": "core"}}
+	unta := &appGroup{clusterName: "unta-staging", status: "ACTIVE", environment: "staging", labels: map[string]string{"team": "payment"}}
+	kuda := &appGroup{clusterName: "kuda-prod", status: "INACTIVE", environment: "production"}
+
+	cases := []struct {
+		name                                                           string
+		includeName, excludeName, includeAttributes, excludeAttributes string
+		expected                                                       map[string]bool
+	}{
+		{"no filter", "", "", "", "", map[string]bool{"lama-prod": true, "unta-staging": true, "kuda-prod": true}},
+		{"include name", "-prod$", "", "", "", map[string]bool{"lama-prod": true, "kuda-prod": true}},
+		{"exclude name", "", "^lama", "", "", map[string]bool{"unta-staging": true, "kuda-prod": true}},
+		{"include attributes", "", "", "status=ACTIVE,environment=production,environment=staging", "", map[string]bool{"lama-prod": true, "unta-staging": true}},
+		{"exclude label", "", "", "", "label.team=payment,status=INACTIVE", map[string]bool{"lama-prod": true}},
+	}
+
+	for _, c := range cases {
+		f, err := NewFilter(c.includeName, c.excludeName, c.includeAttributes, c.excludeAttributes)
+		if err != nil {
+			t.Fatalf("%s: should not return error, got: %v", c.name, err)
+		}
+		for _, aG := range []*appGroup{lama, unta, kuda} {
+			if got := f.Match(aG); got != c.expected[aG.clusterName] {
+				t.Errorf("%s: Match(%q) should return %v, got: %v", c.name, aG.clusterName, c.expected[aG.clusterName], got)
+			}
+		}
+	}
+}
+
+func TestFilter_invalid(t *testing.T) {
+	if _, err := NewFilter("(", "", "", ""); err == nil {
+		t.Errorf("Should return error on invalid regex")
+	}
+	if _, err := NewFilter("", "", "status", ""); err == nil {
+		t.Errorf("Should return error on invalid attribute")
+	}
+}
+
+func TestFilteredSource(t *testing.T) {
+	source := &fakeSource{appGroups: []AppGroup{
+		&appGroup{clusterName: "lama", status: "ACTIVE"},
+		&appGroup{clusterName: "unta", status: "INACTIVE"},
+	}}
+	f, _ := NewFilter("", "", "status=ACTIVE", "")
+
+	appGroups, err := NewFilteredSource(source, f).ListAppGroups()
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	if len(appGroups) != 1 || appGroups[0].GetClusterName() != "lama" {
+		t.Errorf("Should only return lama, got: %+v", appGroups)
+	}
+}
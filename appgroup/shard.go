@@ -0,0 +1,81 @@
+package appgroup
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Shard tells which app groups this replica owns. Ownership uses rendezvous
+// hashing: each app group goes to the peer with the highest hash of peer and
+// cluster name, so adding or removing a peer only moves the app groups it
+// owns or takes over. The hash must mix every byte, cluster names often
+// only differ by their last characters.
+type Shard struct {
+	peers []string
+	self  string
+}
+
+func NewShard(peers []string, self string) (*Shard, error) {
+	if len(peers) == 0 {
+		return nil, errors.New("Shard needs at least one peer")
+	}
+	for _, p := range peers {
+		if p == self {
+			return &Shard{peers: peers, self: self}, nil
+		}
+	}
+	return nil, fmt.Errorf("Shard self %q is not part of peers %v", self, peers)
+}
+
+// NewIndexShard is a shard whose peers are the replica indexes, e.g. the
+// ordinal of a StatefulSet pod.
+func NewIndexShard(index, count int) (*Shard, error) {
+	if count < 1 || index < 0 || index >= count {
+		return nil, fmt.Errorf("Invalid replica index %d for replica count %d", index, count)
+	}
+	peers := []string{}
+	for i := 0; i < count; i++ {
+		peers = append(peers, strconv.Itoa(i))
+	}
+	return NewShard(peers, strconv.Itoa(index))
+}
+
+func (s *Shard) Owns(clusterName string) bool {
+	return s.owner(clusterName) == s.self
+}
+
+func (s *Shard) owner(clusterName string) string {
+	var owner string
+	var max uint64
+	for _, p := range s.peers {
+		h := sha256.Sum256([]byte(p + "\x00" + clusterName))
+		if sum := binary.BigEndian.Uint64(h[:8]); owner == "" || sum > max {
+			owner, max = p, sum
+		}
+	}
+	return owner
+}
+
+type shardedSource struct {
+	source Source
+	shard  *Shard
+}
+
+func NewShardedSource(source Source, shard *Shard) *shardedSource {
+	return &shardedSource{source: source, shard: shard}
+}
+
+func (s *shardedSource) ListAppGroups() ([]AppGroup, error) {
+	appGroups, err := s.source.ListAppGroups()
+
+	result := []AppGroup{}
+	for _, aG := range appGroups {
+		if s.shard.Owns(aG.GetClusterName()) {
+			result = append(result, aG)
+		}
+	}
+	return result, err
+}
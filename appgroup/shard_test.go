@@ -0,0 +1,66 @@
+package appgroup
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShard_eachAppGroupHasOneOwner(t *testing.T) {
+	// names sharing a prefix, only differing by their last characters
+	names := []string{}
+	for i := 0; i < 1000; i++ {
+		names = append(names, fmt.Sprintf("haryo-%d", i))
+	}
+
+	for count := 2; count <= 5; count++ {
+		shards := []*Shard{}
+		for i := 0; i < count; i++ {
+			s, err := NewIndexShard(i, count)
+			if err != nil {
+				t.Fatalf("Should not return error, got: %v", err)
+			}
+			shards = append(shards, s)
+		}
+
+		owned := make([]int, count)
+		for _, name := range names {
+			owners := 0
+			for j, s := range shards {
+				if s.Owns(name) {
+					owners++
+					owned[j]++
+				}
+			}
+			if owners != 1 {
+				t.Fatalf("%q should have exactly one owner, got: %d", name, owners)
+			}
+		}
+
+		for j, n := range owned {
+			if fair := len(names) / count; n < fair*3/4 {
+				t.Errorf("Shard %d of %d should own a fair part of %d app groups, got: %d", j, count, len(names), n)
+			}
+		}
+	}
+}
+
+func TestShard_addingPeerOnlyMovesToNewPeer(t *testing.T) {
+	before, _ := NewShard([]string{"a", "b"}, "a")
+	after, _ := NewShard([]string{"a", "b", "c"}, "a")
+
+	for i := 0; i < 300; i++ {
+		name := fmt.Sprintf("app-group-%d", i)
+		if prev, next := before.owner(name), after.owner(name); prev != next && next != "c" {
+			t.Errorf("%q should stay on %q or move to the new peer, got: %q", name, prev, next)
+		}
+	}
+}
+
+func TestShard_invalid(t *testing.T) {
+	if _, err := NewIndexShard(3, 3); err == nil {
+		t.Errorf("Should return error when index is out of range")
+	}
+	if _, err := NewShard([]string{"a", "b"}, "c"); err == nil {
+		t.Errorf("Should return error when self is not a peer")
+	}
+}
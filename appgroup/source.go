@@ -0,0 +1,240 @@
+package appgroup
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"gopkg.in/yaml.v3"
+)
+
+// Source lists the app groups to probe. A source may return a partial list
+// along with an error, callers should use what they get.
+type Source interface {
+	ListAppGroups() ([]AppGroup, error)
+}
+
+type marketSource struct {
+	cfg            *config.Config
+	upstreams      *retry.Upstreams
+	metricRecorder o11y.MetricRecorder
+}
+
+func NewMarketSource(cfg *config.Config, upstreams *retry.Upstreams, mR o11y.MetricRecorder) *marketSource {
+	return &marketSource{cfg: cfg, upstreams: upstreams, metricRecorder: mR}
+}
+
+// ListAppGroups may return the app groups of the pages fetched before an
+// error, along with it.
+func (m *marketSource) ListAppGroups() ([]AppGroup, error) {
+	appGroups, err := GetListAppGroups(*m.cfg, m.upstreams)
+
+	result := []AppGroup{}
+	for _, aG := range appGroups {
+		result = append(result, aG)
+	}
+	m.metricRecorder.SetDiscoveredAppGroups(o11y.DISCOVERY_SOURCE_BARITO_MARKET, len(result))
+
+	if err != nil {
+		m.metricRecorder.IncreaseDiscoveryFailed(o11y.DISCOVERY_SOURCE_BARITO_MARKET)
+		return result, fmt.Errorf("Failed to get list app group from BaritoMarket: %v", err)
+	}
+	m.metricRecorder.IncreaseDiscoverySuccess(o11y.DISCOVERY_SOURCE_BARITO_MARKET)
+	return result, nil
+}
+
+type staticEntry struct {
+	ClusterName   string   `yaml:"cluster_name"`
+	Secret        string   `yaml:"secret"`
+	Elasticsearch []string `yaml:"elasticsearch"`
+	Kibana        string   `yaml:"kibana"`
+	Kafka         []string `yaml:"kafka"`
+}
+
+type fileSource struct {
+	path      string
+	cfg       *config.Config
+	upstreams *retry.Upstreams
+}
+
+// NewFileSource reads app groups from a YAML file (.yaml/.yml), a list of
+// cluster_name, secret and optional elasticsearch, kibana & kafka endpoints,
+// or else from a CSV file with the same columns where lists are separated
+// by ";". The file is read on every call so it can be edited at runtime.
+func NewFileSource(path string, cfg *config.Config, upstreams *retry.Upstreams) *fileSource {
+	return &fileSource{path: path, cfg: cfg, upstreams: upstreams}
+}
+
+func (f *fileSource) ListAppGroups() ([]AppGroup, error) {
+	body, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []staticEntry
+	switch filepath.Ext(f.path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(body, &entries)
+	default:
+		entries, err = parseCSV(string(body))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %v", f.path, err)
+	}
+
+	result := []AppGroup{}
+	for _, e := range entries {
+		if e.ClusterName == "" || e.Secret == "" {
+			return nil, fmt.Errorf("Failed to parse %q: cluster_name and secret are mandatory", f.path)
+		}
+		endpoints := Endpoints{Elasticsearch: e.Elasticsearch, Kibana: e.Kibana, Kafka: e.Kafka}
+		result = append(result, NewStaticAppGroup(e.ClusterName, e.Secret, endpoints, f.cfg, f.upstreams))
+	}
+	return result, nil
+}
+
+func parseCSV(body string) ([]staticEntry, error) {
+	r := csv.NewReader(strings.NewReader(body))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []staticEntry{}
+	for _, record := range records {
+		if len(record) < 2 {
+			return nil, errors.New("each line should have at least cluster_name and secret")
+		}
+		e := staticEntry{ClusterName: record[0], Secret: record[1]}
+		if len(record) > 2 {
+			e.Elasticsearch = splitList(record[2])
+		}
+		if len(record) > 3 {
+			e.Kibana = record[3]
+		}
+		if len(record) > 4 {
+			e.Kafka = splitList(record[4])
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func splitList(s string) []string {
+	result := []string{}
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+type envSource struct {
+	value     string
+	cfg       *config.Config
+	upstreams *retry.Upstreams
+}
+
+// NewEnvSource parses app groups from "cluster_name:secret" pairs separated
+// by comma.
+func NewEnvSource(value string, cfg *config.Config, upstreams *retry.Upstreams) *envSource {
+	return &envSource{value: value, cfg: cfg, upstreams: upstreams}
+}
+
+func (e *envSource) ListAppGroups() ([]AppGroup, error) {
+	result := []AppGroup{}
+	for _, pair := range splitList(strings.Replace(e.value, ",", ";", -1)) {
+		s := strings.SplitN(pair, ":", 2)
+		if len(s) != 2 || s[0] == "" || s[1] == "" {
+			return nil, fmt.Errorf("Invalid app group %q, should be cluster_name:secret", pair)
+		}
+		result = append(result, NewAppGroup(s[0], s[1], e.cfg, e.upstreams))
+	}
+	return result, nil
+}
+
+type mergedSource struct {
+	sources []Source
+}
+
+// NewMergedSource lists app groups from every source, an app group found in
+// several sources is taken from the last one, so sources should be ordered
+// from the least to the most specific.
+func NewMergedSource(sources ...Source) *mergedSource {
+	return &mergedSource{sources: sources}
+}
+
+func (m *mergedSource) ListAppGroups() ([]AppGroup, error) {
+	order := []string{}
+	byName := map[string]AppGroup{}
+	errs := []string{}
+	for _, source := range m.sources {
+		appGroups, err := source.ListAppGroups()
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, aG := range appGroups {
+			if _, ok := byName[aG.GetClusterName()]; !ok {
+				order = append(order, aG.GetClusterName())
+			}
+			byName[aG.GetClusterName()] = aG
+		}
+	}
+
+	result := []AppGroup{}
+	for _, name := range order {
+		result = append(result, byName[name])
+	}
+	if len(errs) > 0 {
+		return result, errors.New(strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+type cachedSource struct {
+	source Source
+
+	mu       sync.Mutex
+	lastList []AppGroup
+}
+
+// NewCachedSource completes the result of source with its last successful
+// result when it fails, starting with initial, so an outage doesn't drop its
+// app groups.
+func NewCachedSource(source Source, initial []AppGroup) *cachedSource {
+	return &cachedSource{source: source, lastList: initial}
+}
+
+func (c *cachedSource) ListAppGroups() ([]AppGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	appGroups, err := c.source.ListAppGroups()
+	if err != nil {
+		partial := &staticSource{appGroups: appGroups}
+		result, _ := NewMergedSource(&staticSource{appGroups: c.lastList}, partial).ListAppGroups()
+		return result, err
+	}
+	c.lastList = appGroups
+	return appGroups, nil
+}
+
+type staticSource struct {
+	appGroups []AppGroup
+}
+
+func (s *staticSource) ListAppGroups() ([]AppGroup, error) {
+	return s.appGroups, nil
+}
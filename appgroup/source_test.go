@@ -0,0 +1,197 @@
+package appgroup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+)
+
+type fakeSource struct {
+	appGroups []AppGroup
+	err       error
+}
+
+func (f *fakeSource) ListAppGroups() ([]AppGroup, error) {
+	return f.appGroups, f.err
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileSource(t *testing.T) {
+	cfg := &config.Config{BaritoMarketHost: "http://market"}
+	expected := []AppGroup{
+		NewStaticAppGroup("lama", "ABC", Endpoints{
+			Elasticsearch: []string{"10.0.0.1:9200", "10.0.0.2:9200"},
+			Kibana:        "10.0.0.3:5601",
+		}, cfg, nil),
+		NewStaticAppGroup("unta", "DEF", Endpoints{}, cfg, nil),
+	}
+
+	files := map[string]string{
+		"app_groups.yaml": `
+- cluster_name: lama
+  secret: ABC
+  elasticsearch: ["10.0.0.1:9200", "10.0.0.2:9200"]
+  kibana: 10.0.0.3:5601
+- cluster_name: unta
+  secret: DEF
+`,
+		"app_groups.csv": `# cluster_name,secret,elasticsearch,kibana,kafka
+lama,ABC,10.0.0.1:9200;10.0.0.2:9200,10.0.0.3:5601
+unta,DEF
+`,
+	}
+
+	for name, content := range files {
+		path := writeFile(t, name, content)
+		defer os.RemoveAll(filepath.Dir(path))
+
+		appGroups, err := NewFileSource(path, cfg, nil).ListAppGroups()
+		if err != nil {
+			t.Fatalf("Should not return error for %q, got: %v", name, err)
+		}
+		if !reflect.DeepEqual(appGroups, expected) {
+			t.Errorf("Invalid app groups from %q, want:\n%+v\ngot:\n%+v", name, expected, appGroups)
+		}
+	}
+}
+
+func TestFileSource_missingSecret(t *testing.T) {
+	path := writeFile(t, "app_groups.csv", "lama,\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := NewFileSource(path, &config.Config{}, nil).ListAppGroups()
+	if err == nil {
+		t.Errorf("Should return error when secret is missing")
+	}
+}
+
+func TestFileSource_cachedWhileEdited(t *testing.T) {
+	path := writeFile(t, "app_groups.yaml", "- cluster_name: lama\n  secret: ABC\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	source := NewCachedSource(NewFileSource(path, &config.Config{}, nil), nil)
+	source.ListAppGroups()
+
+	// half written
+	if err := ioutil.WriteFile(path, []byte("- cluster_name: lama\n  secret: [ABC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	appGroups, err := source.ListAppGroups()
+	if err == nil || len(appGroups) != 1 || appGroups[0].GetClusterName() != "lama" {
+		t.Errorf("Should keep the app groups of the last read, got: %v, %v", appGroups, err)
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	cfg := &config.Config{}
+	appGroups, err := NewEnvSource("lama:ABC, unta:DEF", cfg, nil).ListAppGroups()
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+
+	expected := []AppGroup{NewAppGroup("lama", "ABC", cfg, nil), NewAppGroup("unta", "DEF", cfg, nil)}
+	if !reflect.DeepEqual(appGroups, expected) {
+		t.Errorf("Invalid app groups, want:\n%+v\ngot:\n%+v", expected, appGroups)
+	}
+
+	if _, err := NewEnvSource("lama", cfg, nil).ListAppGroups(); err == nil {
+		t.Errorf("Should return error when secret is missing")
+	}
+}
+
+func TestMergedSource(t *testing.T) {
+	cfg := &config.Config{}
+	market := &fakeSource{appGroups: []AppGroup{NewAppGroup("lama", "ABC", cfg, nil), NewAppGroup("unta", "DEF", cfg, nil)}}
+	static := &fakeSource{appGroups: []AppGroup{NewAppGroup("unta", "XYZ", cfg, nil), NewAppGroup("kuda", "GHI", cfg, nil)}}
+
+	appGroups, err := NewMergedSource(market, static).ListAppGroups()
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	expected := []AppGroup{NewAppGroup("lama", "ABC", cfg, nil), NewAppGroup("unta", "XYZ", cfg, nil), NewAppGroup("kuda", "GHI", cfg, nil)}
+	if !reflect.DeepEqual(appGroups, expected) {
+		t.Errorf("Later source should take precedence, want:\n%+v\ngot:\n%+v", expected, appGroups)
+	}
+
+	market.err = errors.New("market is down")
+	market.appGroups = nil
+	appGroups, err = NewMergedSource(market, static).ListAppGroups()
+	if err == nil {
+		t.Errorf("Should return error when a source failed")
+	}
+	if len(appGroups) != 2 {
+		t.Errorf("Should still return app groups of other sources, got: %+v", appGroups)
+	}
+}
+
+func TestCachedSource(t *testing.T) {
+	cfg := &config.Config{}
+	initial := []AppGroup{NewAppGroup("lama", "ABC", cfg, nil)}
+	source := &fakeSource{err: errors.New("market is down")}
+	cached := NewCachedSource(source, initial)
+
+	appGroups, err := cached.ListAppGroups()
+	if err == nil || !reflect.DeepEqual(appGroups, initial) {
+		t.Errorf("Should return initial app groups along with the error, got: %+v, %v", appGroups, err)
+	}
+
+	source.err = nil
+	source.appGroups = []AppGroup{NewAppGroup("unta", "DEF", cfg, nil)}
+	cached.ListAppGroups()
+
+	last := source.appGroups
+	source.err = errors.New("market is down")
+	source.appGroups = nil
+	appGroups, _ = cached.ListAppGroups()
+	if !reflect.DeepEqual(appGroups, last) {
+		t.Errorf("Should return last successful app groups, want:\n%+v\ngot:\n%+v", last, appGroups)
+	}
+
+	// partial result completes the cache
+	source.appGroups = []AppGroup{NewAppGroup("unta", "XYZ", cfg, nil), NewAppGroup("kuda", "GHI", cfg, nil)}
+	appGroups, _ = cached.ListAppGroups()
+	if !reflect.DeepEqual(appGroups, source.appGroups) {
+		t.Errorf("Should merge partial result with last successful app groups, want:\n%+v\ngot:\n%+v", source.appGroups, appGroups)
+	}
+}
+
+func TestStaticEndpoints(t *testing.T) {
+	aG := NewStaticAppGroup("lama", "ABC", Endpoints{
+		Elasticsearch: []string{"10.0.0.1:9200"},
+		Kibana:        "https://10.0.0.3:5601",
+		Kafka:         []string{"10.0.0.4:9092"},
+	}, &config.Config{BaritoMarketHost: "http://127.0.0.1:1"}, nil)
+
+	if err := aG.RefreshMetadata(context.Background()); err != nil {
+		t.Errorf("Failed metadata refresh should be ignored when endpoints are static, got: %v", err)
+	}
+
+	listES, _ := aG.GetListES(context.Background())
+	if !reflect.DeepEqual(listES, []string{"http://10.0.0.1:9200"}) {
+		t.Errorf("Invalid List ES, got: %v", listES)
+	}
+	kibanaHost, _ := aG.GetKibanaHost(context.Background())
+	if kibanaHost != "https://10.0.0.3:5601" {
+		t.Errorf("Invalid Kibana Host, got: %v", kibanaHost)
+	}
+	listKafka, _ := aG.GetListKafka(context.Background())
+	if !reflect.DeepEqual(listKafka, []string{"10.0.0.4:9092"}) {
+		t.Errorf("Invalid List Kafka, got: %v", listKafka)
+	}
+}
@@ -1,44 +1,219 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	BaritoMarketHost             string
 	BaritoMarketToken            string
+	BaritoMarketTokenHeader      string
 	baritoMarketHost             string
 	ProduceURL                   string
+	ProduceSingleURL             string
+	ProduceModes                 []string
+	ProduceRouters               []string
+	ProduceBatchPath             string
+	ProduceSinglePath            string
+	ProduceRouterConsulHost      string
+	ProduceRouterConsulService   string
+	ProduceRouterConsulScheme    string
+	ProduceRouterRefreshInterval time.Duration
+	ProduceRouterFromMarket      bool
 	ProduceAppPrefix             string
 	BaritoMarketProfileIndexPath string
+	BaritoMarketTimeout          time.Duration
+	BaritoMarketMaxPages         int
+	BaritoMarketRetries          int
+	BaritoMarketRetryBackoff     time.Duration
+	BaritoMarketRetryStatusCodes []int
 	ProduceInterval              time.Duration
 	ProduceTimeout               time.Duration
 	ProduceTimeField             string
+	ProduceBatchSize             int
+	ProduceMessageSize           int
+	ProduceStaticFields          map[string]string
+	ProduceTemplateFields        map[string]string
+	ProduceRetries               int
+	ProduceRetryBackoff          time.Duration
+	ProduceRetryStatusCodes      []int
 	ESProbeInterval              time.Duration
 	ESProbeTimeout               time.Duration
+	ESProbeRetries               int
+	ESProbeRetryBackoff          time.Duration
+	ESProbeRetryStatusCodes      []int
+	ESProbeLookback              time.Duration
+	ESProbeIndexAlias            string
+	ESProbeIndexDateFormat       string
+	ESProbeVersionRefresh        time.Duration
+	ESProbeUsername              string
+	ESProbePassword              string
+	AppFreshnessChecksFile       string
+	IntegrityCheckEnabled        bool
+	SequenceCheckEnabled         bool
+	SequenceCheckWindow          time.Duration
+	SequenceCheckDelay           time.Duration
 	KibanaProbeInterval          time.Duration
 	KibanaProbeTimeout           time.Duration
+	KibanaProbeRetries           int
+	KibanaProbeRetryBackoff      time.Duration
+	KibanaProbeRetryStatusCodes  []int
+	ConsulRetries                int
+	ConsulRetryBackoff           time.Duration
+	ConsulRetryStatusCodes       []int
+	CircuitBreakerThreshold      int
+	CircuitBreakerCooldown       time.Duration
 	DeleteTopicInterval          time.Duration
+	MetadataInterval             time.Duration
+	NotifierSlackWebhookURLs     []string
+	NotifierWebhookURLs          []string
+	NotifierFailureThreshold     int
+	NotifierDelayThreshold       time.Duration
+	NotifierTimeout              time.Duration
+	SLOEnabled                   bool
+	SLOWindows                   []time.Duration
+	SLOObjective                 float64
+	SLOFreshnessThreshold        time.Duration
+	StateFile                    string
+	StateSaveInterval            time.Duration
+	ShutdownTimeout              time.Duration
+	BaritoMarketDiscoveryEnabled bool
+	StaticAppGroupsFile          string
+	StaticAppGroups              string
+	DiscoveryInterval            time.Duration
+	AppGroupIncludeRegex         string
+	AppGroupExcludeRegex         string
+	AppGroupIncludeAttributes    string
+	AppGroupExcludeAttributes    string
+	ShardReplicaIndex            int
+	ShardReplicaCount            int
+	ShardPeers                   []string
+	ShardSelf                    string
+	TracingEndpoint              string
+	TracingServiceName           string
+	TracingFlushInterval         time.Duration
+	TracingQueueSize             int
+	TracingTimeout               time.Duration
+	LogLevel                     string
+	LogFormat                    string
+	LogSampleBurst               int
+	LogSampleInterval            time.Duration
+	AdminToken                   string
 }
 
-func NewConfig() *Config {
-	return &Config{
+// NewConfig fails when a secret file set in a _FILE env can't be read,
+// rather than silently falling back to the env or the default.
+func NewConfig() (*Config, error) {
+	var fileErr error
+	envOrFile := func(envName, defaultValue string) string {
+		v, err := envOrFileString(envName, defaultValue)
+		if err != nil && fileErr == nil {
+			fileErr = err
+		}
+		return v
+	}
+
+	cfg := &Config{
 		BaritoMarketHost:             envOrDefaultString("BARITO_MARKET_HOST", "https://barito.golabs.io"),
-		BaritoMarketToken:            envOrDefaultString("BARITO_MARKET_TOKEN", ""),
+		BaritoMarketToken:            envOrFile("BARITO_MARKET_TOKEN", ""),
+		BaritoMarketTokenHeader:      envOrDefaultString("BARITO_MARKET_TOKEN_HEADER", ""),
 		BaritoMarketProfileIndexPath: envOrDefaultString("BARITO_MARKET_PROFILE_INDEX_PATH", "/api/v2/profile_index"),
+		BaritoMarketTimeout:          time.Duration(envOrDefaultInt("BARITO_MARKET_TIMEOUT", 10)) * time.Second,
+		BaritoMarketMaxPages:         envOrDefaultInt("BARITO_MARKET_MAX_PAGES", 1000),
+		BaritoMarketRetries:          envOrDefaultInt("BARITO_MARKET_RETRIES", 3),
+		BaritoMarketRetryBackoff:     time.Duration(envOrDefaultInt("BARITO_MARKET_RETRY_BACKOFF_MS", 1000)) * time.Millisecond,
+		BaritoMarketRetryStatusCodes: envOrDefaultIntSlice("BARITO_MARKET_RETRY_STATUS_CODES", []int{429, 500, 502, 503, 504}),
 		ProduceURL:                   envOrDefaultString("PRODUCE_URL", "https://barito-router.golabs.io/produce_batch"),
+		ProduceSingleURL:             envOrDefaultString("PRODUCE_SINGLE_URL", "https://barito-router.golabs.io/produce"),
+		ProduceModes:                 envOrDefaultStringSlice("PRODUCE_MODES", []string{"batch"}),
+		ProduceRouters:               envOrDefaultStringSlice("PRODUCE_ROUTERS", []string{}),
+		ProduceBatchPath:             envOrDefaultString("PRODUCE_BATCH_PATH", "/produce_batch"),
+		ProduceSinglePath:            envOrDefaultString("PRODUCE_SINGLE_PATH", "/produce"),
+		ProduceRouterConsulHost:      envOrDefaultString("PRODUCE_ROUTER_CONSUL_HOST", ""),
+		ProduceRouterConsulService:   envOrDefaultString("PRODUCE_ROUTER_CONSUL_SERVICE", "barito-router"),
+		ProduceRouterConsulScheme:    envOrDefaultString("PRODUCE_ROUTER_CONSUL_SCHEME", "http"),
+		ProduceRouterRefreshInterval: time.Duration(envOrDefaultInt("PRODUCE_ROUTER_REFRESH_INTERVAL", 300)) * time.Second,
+		ProduceRouterFromMarket:      envOrDefaultBool("PRODUCE_ROUTER_FROM_BARITO_MARKET", false),
 		ProduceAppPrefix:             envOrDefaultString("PRODUCE_APP_PREFIX", "barito-prober"),
 		ProduceInterval:              time.Duration(envOrDefaultInt("PRODUCE_INTERVAL_SECOND", 30)) * time.Second,
 		ProduceTimeout:               time.Duration(envOrDefaultInt("PRODUCE_TIMEOUT", 10)) * time.Second,
 		ProduceTimeField:             envOrDefaultString("PRODUCE_TIME_FIELD", "barito_trace_time"),
+		ProduceBatchSize:             envOrDefaultInt("PRODUCE_BATCH_SIZE", 1),
+		ProduceMessageSize:           envOrDefaultInt("PRODUCE_MESSAGE_SIZE", 0),
+		ProduceStaticFields:          envOrDefaultMap("PRODUCE_STATIC_FIELDS"),
+		ProduceTemplateFields:        envOrDefaultMap("PRODUCE_TEMPLATE_FIELDS"),
+		ProduceRetries:               envOrDefaultInt("PRODUCE_RETRIES", 2),
+		ProduceRetryBackoff:          time.Duration(envOrDefaultInt("PRODUCE_RETRY_BACKOFF_MS", 500)) * time.Millisecond,
+		ProduceRetryStatusCodes:      envOrDefaultIntSlice("PRODUCE_RETRY_STATUS_CODES", []int{429, 502, 503, 504}),
 		ESProbeInterval:              time.Duration(envOrDefaultInt("ES_PROBE_INTERVAL", 30)) * time.Second,
 		ESProbeTimeout:               time.Duration(envOrDefaultInt("ES_PROBE_TIMEOUT", 10)) * time.Second,
+		ESProbeRetries:               envOrDefaultInt("ES_PROBE_RETRIES", 2),
+		ESProbeRetryBackoff:          time.Duration(envOrDefaultInt("ES_PROBE_RETRY_BACKOFF_MS", 500)) * time.Millisecond,
+		ESProbeRetryStatusCodes:      envOrDefaultIntSlice("ES_PROBE_RETRY_STATUS_CODES", []int{429, 502, 503, 504}),
+		ESProbeLookback:              time.Duration(envOrDefaultInt("ES_PROBE_LOOKBACK", 3600)) * time.Second,
+		ESProbeIndexAlias:            envOrDefaultString("ES_PROBE_INDEX_ALIAS", ""),
+		ESProbeIndexDateFormat:       envOrDefaultString("ES_PROBE_INDEX_DATE_FORMAT", "2006.01.02"),
+		ESProbeVersionRefresh:        time.Duration(envOrDefaultInt("ES_PROBE_VERSION_REFRESH_INTERVAL", 3600)) * time.Second,
+		ESProbeUsername:              envOrDefaultString("ES_PROBE_USERNAME", ""),
+		ESProbePassword:              envOrFile("ES_PROBE_PASSWORD", ""),
+		AppFreshnessChecksFile:       envOrDefaultString("APP_FRESHNESS_CHECKS_FILE", ""),
+		IntegrityCheckEnabled:        envOrDefaultBool("INTEGRITY_CHECK_ENABLED", true),
+		SequenceCheckEnabled:         envOrDefaultBool("SEQUENCE_CHECK_ENABLED", true),
+		SequenceCheckWindow:          time.Duration(envOrDefaultInt("SEQUENCE_CHECK_WINDOW", 600)) * time.Second,
+		SequenceCheckDelay:           time.Duration(envOrDefaultInt("SEQUENCE_CHECK_DELAY", 60)) * time.Second,
 		KibanaProbeInterval:          time.Duration(envOrDefaultInt("KIBANA_PROBE_INTERVAL", 60)) * time.Second,
 		KibanaProbeTimeout:           time.Duration(envOrDefaultInt("KIBANA_PROBE_TIMEOUT", 30)) * time.Second,
+		KibanaProbeRetries:           envOrDefaultInt("KIBANA_PROBE_RETRIES", 2),
+		KibanaProbeRetryBackoff:      time.Duration(envOrDefaultInt("KIBANA_PROBE_RETRY_BACKOFF_MS", 500)) * time.Millisecond,
+		KibanaProbeRetryStatusCodes:  envOrDefaultIntSlice("KIBANA_PROBE_RETRY_STATUS_CODES", []int{429, 502, 503, 504}),
+		ConsulRetries:                envOrDefaultInt("CONSUL_RETRIES", 3),
+		ConsulRetryBackoff:           time.Duration(envOrDefaultInt("CONSUL_RETRY_BACKOFF_MS", 200)) * time.Millisecond,
+		ConsulRetryStatusCodes:       envOrDefaultIntSlice("CONSUL_RETRY_STATUS_CODES", []int{429, 500, 502, 503, 504}),
+		CircuitBreakerThreshold:      envOrDefaultInt("CIRCUIT_BREAKER_THRESHOLD", 5),
+		CircuitBreakerCooldown:       time.Duration(envOrDefaultInt("CIRCUIT_BREAKER_COOLDOWN", 60)) * time.Second,
 		DeleteTopicInterval:          time.Duration(envOrDefaultInt("DELETE_TOPIC_INTERVAL", 3600)) * time.Second,
+		MetadataInterval:             time.Duration(envOrDefaultInt("METADATA_INTERVAL", 300)) * time.Second,
+		NotifierSlackWebhookURLs:     splitList(envOrFile("NOTIFIER_SLACK_WEBHOOK_URLS", "")),
+		NotifierWebhookURLs:          splitList(envOrFile("NOTIFIER_WEBHOOK_URLS", "")),
+		NotifierFailureThreshold:     envOrDefaultInt("NOTIFIER_FAILURE_THRESHOLD", 3),
+		NotifierDelayThreshold:       time.Duration(envOrDefaultInt("NOTIFIER_DELAY_THRESHOLD", 600)) * time.Second,
+		NotifierTimeout:              time.Duration(envOrDefaultInt("NOTIFIER_TIMEOUT", 10)) * time.Second,
+		SLOEnabled:                   envOrDefaultBool("SLO_ENABLED", true),
+		SLOWindows:                   envOrDefaultDurationSlice("SLO_WINDOWS", []time.Duration{time.Hour, 24 * time.Hour, 30 * 24 * time.Hour}),
+		SLOObjective:                 envOrDefaultFloat("SLO_OBJECTIVE", 0.99),
+		SLOFreshnessThreshold:        time.Duration(envOrDefaultInt("SLO_FRESHNESS_THRESHOLD", 300)) * time.Second,
+		StateFile:                    envOrDefaultString("STATE_FILE", ""),
+		StateSaveInterval:            time.Duration(envOrDefaultInt("STATE_SAVE_INTERVAL", 60)) * time.Second,
+		ShutdownTimeout:              time.Duration(envOrDefaultInt("SHUTDOWN_TIMEOUT", 30)) * time.Second,
+		BaritoMarketDiscoveryEnabled: envOrDefaultBool("BARITO_MARKET_DISCOVERY_ENABLED", true),
+		StaticAppGroupsFile:          envOrDefaultString("STATIC_APP_GROUPS_FILE", ""),
+		StaticAppGroups:              envOrDefaultString("STATIC_APP_GROUPS", ""),
+		DiscoveryInterval:            time.Duration(envOrDefaultInt("DISCOVERY_INTERVAL", 300)) * time.Second,
+		AppGroupIncludeRegex:         envOrDefaultString("APP_GROUP_INCLUDE_REGEX", ""),
+		AppGroupExcludeRegex:         envOrDefaultString("APP_GROUP_EXCLUDE_REGEX", ""),
+		AppGroupIncludeAttributes:    envOrDefaultString("APP_GROUP_INCLUDE_ATTRIBUTES", ""),
+		AppGroupExcludeAttributes:    envOrDefaultString("APP_GROUP_EXCLUDE_ATTRIBUTES", ""),
+		ShardReplicaIndex:            envOrDefaultInt("SHARD_REPLICA_INDEX", 0),
+		ShardReplicaCount:            envOrDefaultInt("SHARD_REPLICA_COUNT", 1),
+		ShardPeers:                   envOrDefaultStringSlice("SHARD_PEERS", []string{}),
+		ShardSelf:                    envOrDefaultString("SHARD_SELF", hostname()),
+		TracingEndpoint:              envOrDefaultString("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TracingServiceName:           envOrDefaultString("OTEL_SERVICE_NAME", "barito-blackbox-exporter"),
+		TracingFlushInterval:         time.Duration(envOrDefaultInt("TRACING_FLUSH_INTERVAL", 5)) * time.Second,
+		TracingQueueSize:             envOrDefaultInt("TRACING_QUEUE_SIZE", 2048),
+		TracingTimeout:               time.Duration(envOrDefaultInt("TRACING_TIMEOUT", 10)) * time.Second,
+		LogLevel:                     envOrDefaultString("LOG_LEVEL", "info"),
+		LogFormat:                    envOrDefaultString("LOG_FORMAT", "text"),
+		LogSampleBurst:               envOrDefaultInt("LOG_SAMPLE_BURST", 0),
+		LogSampleInterval:            time.Duration(envOrDefaultInt("LOG_SAMPLE_INTERVAL", 60)) * time.Second,
+		AdminToken:                   envOrFile("ADMIN_TOKEN", ""),
 	}
+	return cfg, fileErr
 }
 
 func envOrDefaultString(envName, defaultValue string) string {
@@ -58,3 +233,108 @@ func envOrDefaultInt(envName string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// envOrFileString reads the value from the file at envName_FILE when set,
+// e.g. a mounted Kubernetes secret, so secrets don't have to sit in env.
+func envOrFileString(envName, defaultValue string) (string, error) {
+	if path := os.Getenv(envName + "_FILE"); path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read %s_FILE: %v", envName, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return envOrDefaultString(envName, defaultValue), nil
+}
+
+func envOrDefaultStringSlice(envName string, defaultValue []string) []string {
+	if v := os.Getenv(envName); v != "" {
+		return splitList(v)
+	}
+	return defaultValue
+}
+
+// envOrDefaultMap parses a comma separated list of key=value, e.g.
+// "source=prober,env={{.Environment}}".
+func envOrDefaultMap(envName string) map[string]string {
+	result := map[string]string{}
+	for _, s := range envOrDefaultStringSlice(envName, []string{}) {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			continue
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result
+}
+
+// envOrDefaultIntSlice parses a comma separated list of integers, e.g.
+// "502,503,504".
+func envOrDefaultIntSlice(envName string, defaultValue []int) []int {
+	result := []int{}
+	for _, s := range envOrDefaultStringSlice(envName, []string{}) {
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return defaultValue
+		}
+		result = append(result, i)
+	}
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
+
+func splitList(v string) []string {
+	result := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func envOrDefaultBool(envName string, defaultValue bool) bool {
+	if v := os.Getenv(envName); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return defaultValue
+		}
+		return b
+	}
+	return defaultValue
+}
+
+func envOrDefaultFloat(envName string, defaultValue float64) float64 {
+	if v := os.Getenv(envName); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return defaultValue
+		}
+		return f
+	}
+	return defaultValue
+}
+
+// envOrDefaultDurationSlice parses a comma separated list of Go durations,
+// e.g. "1h,24h,720h".
+func envOrDefaultDurationSlice(envName string, defaultValue []time.Duration) []time.Duration {
+	result := []time.Duration{}
+	for _, s := range envOrDefaultStringSlice(envName, []string{}) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return defaultValue
+		}
+		result = append(result, d)
+	}
+	if len(result) == 0 {
+		return defaultValue
+	}
+	return result
+}
+
+func hostname() string {
+	h, _ := os.Hostname()
+	return h
+}
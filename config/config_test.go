@@ -0,0 +1,38 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvOrFileString(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("TEST_TOKEN", "from-env")
+	defer os.Unsetenv("TEST_TOKEN")
+	if v, err := envOrFileString("TEST_TOKEN", ""); err != nil || v != "from-env" {
+		t.Errorf("Should read env without _FILE, got: %q, %v", v, err)
+	}
+
+	os.Setenv("TEST_TOKEN_FILE", path)
+	defer os.Unsetenv("TEST_TOKEN_FILE")
+	if v, err := envOrFileString("TEST_TOKEN", ""); err != nil || v != "s3cret" {
+		t.Errorf("Should prefer the file, got: %q, %v", v, err)
+	}
+
+	os.Setenv("TEST_TOKEN_FILE", filepath.Join(dir, "missing"))
+	if v, err := envOrFileString("TEST_TOKEN", ""); err == nil || v != "" {
+		t.Errorf("Should fail on an unreadable file rather than fall back to env, got: %q, %v", v, err)
+	}
+}
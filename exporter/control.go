@@ -0,0 +1,163 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/redact"
+)
+
+// AgentStatus is the state of an agent as shown by the admin API and the
+// status page.
+type AgentStatus struct {
+	Probe        string    `json:"probe"`
+	Paused       bool      `json:"paused"`
+	Runs         int       `json:"runs"`
+	LastRun      time.Time `json:"last_run"`
+	LastDuration float64   `json:"last_duration_seconds"`
+	LastError    string    `json:"last_error,omitempty"`
+	// ingestion delay found by the last run, for the ES probe
+	Delay     *float64 `json:"delay_seconds,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+// AgentControl lets an agent be paused, resumed and triggered while it
+// runs, and keeps the result of its last run. A nil AgentControl never
+// pauses, which is what agents built without one get.
+type AgentControl struct {
+	appGroup       string
+	probe          string
+	metricRecorder o11y.MetricRecorder
+	wake           chan struct{}
+
+	mu        sync.Mutex
+	paused    bool
+	triggered bool
+	status    AgentStatus
+}
+
+func NewAgentControl(appGroup, probe string, mR o11y.MetricRecorder) *AgentControl {
+	mR.SetProbePaused(appGroup, probe, false)
+	return &AgentControl{
+		appGroup:       appGroup,
+		probe:          probe,
+		metricRecorder: mR,
+		wake:           make(chan struct{}, 1),
+		status:         AgentStatus{Probe: probe},
+	}
+}
+
+// ControlledAgent is an agent which can be controlled from the admin API.
+type ControlledAgent interface {
+	Agent
+	Control() *AgentControl
+}
+
+func (c *AgentControl) Probe() string {
+	return c.probe
+}
+
+func (c *AgentControl) Pause() {
+	c.setPaused(true)
+}
+
+func (c *AgentControl) Resume() {
+	c.setPaused(false)
+}
+
+func (c *AgentControl) setPaused(paused bool) {
+	c.mu.Lock()
+	c.paused = paused
+	c.mu.Unlock()
+	c.metricRecorder.SetProbePaused(c.appGroup, c.probe, paused)
+}
+
+// Trigger wakes the agent up to run right away, even when paused.
+func (c *AgentControl) Trigger() {
+	c.mu.Lock()
+	c.triggered = true
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ShouldRun tells whether the agent runs this time, when it isn't paused
+// or it was triggered.
+func (c *AgentControl) ShouldRun() bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	run := !c.paused || c.triggered
+	c.triggered = false
+	return run
+}
+
+// Record keeps the result of a run started at start.
+func (c *AgentControl) Record(start time.Time, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Runs++
+	c.status.LastRun = start
+	c.status.LastDuration = time.Since(start).Seconds()
+	c.status.LastError = ""
+	if err != nil {
+		// shown outside of logs, which have their own redaction
+		c.status.LastError = redact.String(err.Error())
+	}
+}
+
+// RecordDelay keeps the ingestion delay found by the last run.
+func (c *AgentControl) RecordDelay(delaySecond float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Delay = &delaySecond
+}
+
+// RecordEndpoints keeps the endpoints discovered by the last run.
+func (c *AgentControl) RecordEndpoints(endpoints []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.status.Endpoints = append([]string{}, endpoints...)
+}
+
+// Sleep waits for d, unless the agent is triggered or ctx is done before.
+func (c *AgentControl) Sleep(ctx context.Context, d time.Duration) {
+	if c == nil {
+		time.Sleep(d)
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-c.wake:
+	case <-time.After(d):
+	}
+}
+
+func (c *AgentControl) Status() AgentStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.status
+	status.Paused = c.paused
+	return status
+}
@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAgentControl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	gomock.InOrder(
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, false),
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, true),
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, false),
+	)
+
+	c := NewAgentControl("lama", o11y.PROBE_PUSH, mr)
+	if !c.ShouldRun() {
+		t.Errorf("Should run when not paused")
+	}
+
+	c.Pause()
+	if c.ShouldRun() {
+		t.Errorf("Should not run when paused")
+	}
+
+	// a trigger wakes the agent up and runs it once, even when paused
+	c.Trigger()
+	start := time.Now()
+	c.Sleep(context.Background(), time.Minute)
+	if time.Since(start) > time.Second {
+		t.Errorf("Should wake up on trigger")
+	}
+	if !c.ShouldRun() || c.ShouldRun() {
+		t.Errorf("Should run once when triggered")
+	}
+
+	c.Record(start, errors.New("Got response status 502"))
+	status := c.Status()
+	if !status.Paused || status.Runs != 1 || status.LastError != "Got response status 502" || !status.LastRun.Equal(start) {
+		t.Errorf("Should keep the last run, got: %+v", status)
+	}
+
+	c.RecordDelay(30)
+	c.RecordEndpoints([]string{"http://es-01:9200"})
+	if status := c.Status(); *status.Delay != 30 || len(status.Endpoints) != 1 {
+		t.Errorf("Should keep the delay and endpoints, got: %+v", status)
+	}
+
+	c.Resume()
+	c.Record(start, nil)
+	if status := c.Status(); status.Paused || status.Runs != 2 || status.LastError != "" {
+		t.Errorf("Should clear the last error once resumed, got: %+v", status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	c.Sleep(ctx, time.Minute)
+	if time.Since(start) > time.Second {
+		t.Errorf("Should stop sleeping once ctx is done")
+	}
+}
+
+func TestAgentControl_nil(t *testing.T) {
+	var c *AgentControl
+	if !c.ShouldRun() {
+		t.Errorf("Should always run without control")
+	}
+	c.Record(time.Now(), nil)
+	c.RecordDelay(30)
+	c.RecordEndpoints([]string{"http://es-01:9200"})
+	c.Sleep(context.Background(), time.Millisecond)
+}
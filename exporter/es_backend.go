@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+const (
+	ES_DISTRIBUTION_ELASTICSEARCH = "elasticsearch"
+	ES_DISTRIBUTION_OPENSEARCH    = "opensearch"
+)
+
+// esBackend is the flavour and version of the search backend of an app
+// group, as told by its root endpoint.
+type esBackend struct {
+	Distribution string
+	Version      string
+	Major        int
+}
+
+// parseESBackend reads the root endpoint response. OpenSearch tells itself
+// apart with version.distribution, Elasticsearch doesn't have it.
+func parseESBackend(body []byte) (esBackend, error) {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return esBackend{}, err
+	}
+
+	version, ok := jsonParsed.Search("version", "number").Data().(string)
+	if !ok {
+		return esBackend{}, errors.New("Can't find version")
+	}
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return esBackend{}, err
+	}
+
+	distribution, _ := jsonParsed.Search("version", "distribution").Data().(string)
+	if distribution == "" {
+		distribution = ES_DISTRIBUTION_ELASTICSEARCH
+	}
+	return esBackend{Distribution: distribution, Version: version, Major: major}, nil
+}
+
+// skipsTotalHits tells whether the backend accepts track_total_hits: false,
+// sparing the count of every hit. It's the case of Elasticsearch 7 onward,
+// whose hits.total became an object, and of every OpenSearch.
+func (b esBackend) skipsTotalHits() bool {
+	return b.Distribution == ES_DISTRIBUTION_OPENSEARCH || b.Major >= 7
+}
@@ -0,0 +1,46 @@
+package exporter
+
+import (
+	"testing"
+)
+
+func TestParseESBackend(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expected       esBackend
+		skipsTotalHits bool
+	}{
+		{"elasticsearch 6", `{"version": {"number": "6.8.23", "build_flavor": "default"}, "tagline": "You Know, for Search"}`,
+			esBackend{Distribution: "elasticsearch", Version: "6.8.23", Major: 6}, false},
+		{"elasticsearch 7", `{"version": {"number": "7.17.9", "build_flavor": "default"}, "tagline": "You Know, for Search"}`,
+			esBackend{Distribution: "elasticsearch", Version: "7.17.9", Major: 7}, true},
+		{"elasticsearch 8", `{"version": {"number": "8.11.1", "build_flavor": "default"}, "tagline": "You Know, for Search"}`,
+			esBackend{Distribution: "elasticsearch", Version: "8.11.1", Major: 8}, true},
+		{"opensearch 1", `{"version": {"distribution": "opensearch", "number": "1.3.14"}, "tagline": "The OpenSearch Project: https://opensearch.org/"}`,
+			esBackend{Distribution: "opensearch", Version: "1.3.14", Major: 1}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend, err := parseESBackend([]byte(tc.body))
+			if err != nil {
+				t.Fatalf("Should not return error, got: %v", err)
+			}
+			if backend != tc.expected {
+				t.Errorf("Should return %+v, got: %+v", tc.expected, backend)
+			}
+			if backend.skipsTotalHits() != tc.skipsTotalHits {
+				t.Errorf("Should skip total hits: %v, got: %v", tc.skipsTotalHits, backend.skipsTotalHits())
+			}
+		})
+	}
+}
+
+func TestParseESBackend_invalid(t *testing.T) {
+	for _, body := range []string{`{"hits": {"hits": []}}`, `{"version": {"number": "x.y"}}`, `<html>`} {
+		if _, err := parseESBackend([]byte(body)); err == nil {
+			t.Errorf("Should return error on %q", body)
+		}
+	}
+}
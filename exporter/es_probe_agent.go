@@ -1,17 +1,24 @@
 package exporter
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
 	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
 	"github.com/Jeffail/gabs/v2"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,95 +27,536 @@ type ESProbeAgent struct {
 	appGroup       appgroup.AppGroup
 	appPrefix      string
 	esTimeField    string
+	lookback       time.Duration
+	indexAlias     string
+	indexDate      string
+	username       string
+	password       string
+	backendRefresh time.Duration
+	backend        esBackend
+	backendAt      time.Time
+	appChecks      []AppFreshnessCheck
 	interval       time.Duration
 	requestTimeout time.Duration
+	retryPolicy    retry.Policy
+	upstreams      *retry.Upstreams
+	integrityCheck bool
+	sequences      *Sequences
+	sequenceWindow time.Duration
+	sequenceDelay  time.Duration
+	probeLogTimes  *ProbeLogTimes
+	lastDataTime   int64
+	control        *AgentControl
 	metricRecorder o11y.MetricRecorder
 	ctx            context.Context
 }
 
-func NewESProbeAgent(appGroup appgroup.AppGroup, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *ESProbeAgent {
+func NewESProbeAgent(appGroup appgroup.AppGroup, sequences *Sequences, probeLogTimes *ProbeLogTimes, appChecks AppFreshnessChecks, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *ESProbeAgent {
 	return &ESProbeAgent{
 		appGroup:       appGroup,
 		appPrefix:      cfg.ProduceAppPrefix,
 		esTimeField:    cfg.ProduceTimeField,
+		lookback:       cfg.ESProbeLookback,
+		indexAlias:     cfg.ESProbeIndexAlias,
+		indexDate:      cfg.ESProbeIndexDateFormat,
+		username:       cfg.ESProbeUsername,
+		password:       cfg.ESProbePassword,
+		backendRefresh: cfg.ESProbeVersionRefresh,
+		appChecks:      appChecks[appGroup.GetClusterName()],
 		interval:       cfg.ESProbeInterval,
 		requestTimeout: cfg.ESProbeTimeout,
+		retryPolicy:    retry.NewPolicy(cfg.ESProbeRetries, cfg.ESProbeRetryBackoff, cfg.ESProbeRetryStatusCodes),
+		upstreams:      upstreams,
+		integrityCheck: cfg.IntegrityCheckEnabled,
+		sequences:      sequences,
+		sequenceWindow: cfg.SequenceCheckWindow,
+		sequenceDelay:  cfg.SequenceCheckDelay,
+		probeLogTimes:  probeLogTimes,
+		lastDataTime:   probeLogTimes.Get(appGroup.GetClusterName()),
+		control:        NewAgentControl(appGroup.GetClusterName(), o11y.PROBE_ELASTICSEARCH, mR),
 		metricRecorder: mR,
 		ctx:            ctx,
 	}
 }
 
+func (e *ESProbeAgent) Control() *AgentControl {
+	return e.control
+}
+
 func (e *ESProbeAgent) Run() {
 	for {
 		select {
 		case <-e.ctx.Done():
-			log.Println("Exit")
+			e.logger().Info("Exit")
 			return
 		default:
-			err := e.tick()
-			if err != nil {
-				log.Errorf("Failed to probe ES, appGroup: %q, error: %v", e.appGroup.GetClusterName(), err)
+			if e.control.ShouldRun() {
+				start := time.Now()
+				ctx, span := tracing.Start(context.Background(), "elasticsearch")
+				span.SetAttribute("app_group", e.appGroup.GetClusterName())
+				err := e.tick(ctx)
+				span.End(err)
+				e.control.Record(start, err)
+				if err != nil {
+					e.logger().WithFields(logging.Since(start)).WithError(err).Error("Failed to probe ES")
+				}
 			}
-			time.Sleep(e.interval)
+			e.control.Sleep(e.ctx, e.interval)
 		}
 	}
 }
 
-func (e *ESProbeAgent) tick() error {
-	err := e.appGroup.RefreshMetadata()
+func (e *ESProbeAgent) logger() *log.Entry {
+	return logging.For(e.appGroup.GetClusterName(), o11y.PROBE_ELASTICSEARCH)
+}
+
+// tick counts one run whatever the number of ES tried, so a notification
+// or SLO fed by runs doesn't depend on it.
+func (e *ESProbeAgent) tick(ctx context.Context) error {
+	result, err := e.probe(ctx)
+	e.metricRecorder.IncreaseProbeElasticsearchRun(e.appGroup.GetClusterName(), result)
+	return err
+}
+
+// probe returns RESULT_SUCCESS when it found the latest probe log, else the
+// reason of the last failure.
+func (e *ESProbeAgent) probe(ctx context.Context) (string, error) {
+	err := e.appGroup.RefreshMetadata(ctx)
 	if err != nil {
 		e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_ELASTICSEARCH_FAILED_FETCH_METADATA)
-		return err
+		return o11y.REASON_PROBE_ELASTICSEARCH_FAILED_FETCH_METADATA, err
 	}
 
 	// get ES Url
-	esUrls, err := e.appGroup.GetListES()
+	esUrls, err := e.appGroup.GetListES(ctx)
 	if err != nil {
 		e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL)
-		return err
+		return o11y.REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL, err
 	}
 
 	if len(esUrls) == 0 {
 		e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND)
-		return err
+		return o11y.REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND, err
+	}
+
+	e.control.RecordEndpoints(esUrls)
+	e.detectBackend(ctx, esUrls)
+
+	now := time.Now()
+	query, err := e.latestQuery(now)
+	if err != nil {
+		return o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED, err
 	}
 
 	var dataTime int64
-	for _, esUrl := range esUrls {
-		body, err := e.doRequest(esUrl)
+	var body []byte
+	var esUrl string
+	result := o11y.REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND
+	noData := false
+	for _, esUrl = range esUrls {
+		searchUrl := e.searchUrl(esUrl, now.Add(-e.lookback), now)
+		err := e.upstreams.For(o11y.UPSTREAM_ELASTICSEARCH).Do(esUrl, e.retryPolicy, func() error {
+			var err error
+			body, err = e.doRequest(ctx, searchUrl, query)
+			return err
+		})
 		if err != nil {
-			log.Debugf("Failed to hit ES, appgroup: %q, es: %q", e.appGroup.GetClusterName(), esUrl)
+			reason := classifyError(err)
+			e.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: esUrl, logging.FIELD_REASON: reason}).WithError(err).Debug("Failed to hit ES")
 			e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
 				o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+			e.metricRecorder.IncreaseProbeRequestFailed(e.appGroup.GetClusterName(), o11y.PROBE_ELASTICSEARCH, reason)
+			result = o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED
 			continue
 		}
+		if took, ok := parseTook(body); ok {
+			e.metricRecorder.SetProbeElasticsearchTook(e.appGroup.GetClusterName(), took)
+		}
 		dataTime, err = e.parseESBody(body)
+		if errors.Is(err, errNoProbeLog) {
+			e.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: esUrl, logging.FIELD_REASON: o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA}).Debugf("No probe log in the last %v", e.lookback)
+			e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
+				o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+			result = o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA
+			noData = true
+			continue
+		}
 		if err != nil {
-			log.Debugf("Failed to parse ES response, got error: %v", err)
+			e.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: esUrl, logging.FIELD_REASON: o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED}).WithError(err).Debug("Failed to parse ES response")
 			e.metricRecorder.IncreaseProbeElasticSearchFailed(e.appGroup.GetClusterName(),
 				o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED)
+			e.metricRecorder.IncreaseProbeRequestFailed(e.appGroup.GetClusterName(), o11y.PROBE_ELASTICSEARCH, o11y.REASON_PARSE)
+			result = o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED
 			continue
 		}
+		result = o11y.RESULT_SUCCESS
 		break
 	}
 
+	if len(e.appChecks) > 0 {
+		e.checkAppsFreshness(ctx, esUrls)
+	}
+
+	// past the lookback, the delay keeps growing from the last log seen
+	if dataTime == 0 && noData && e.lastDataTime != 0 {
+		e.setDelay(e.lastDataTime)
+	}
+
 	if dataTime != 0 {
-		delay := math.Floor(float64(((time.Now().UnixNano() / 1000000) - dataTime) / 1000))
+		e.lastDataTime = dataTime
+		e.probeLogTimes.Set(e.appGroup.GetClusterName(), dataTime)
 		e.metricRecorder.IncreaseProbeElasticSearchSuccess(e.appGroup.GetClusterName())
-		e.metricRecorder.SetProbeElasticsearchDelay(e.appGroup.GetClusterName(), delay)
+		e.setDelay(dataTime)
+
+		var err error
+		if e.integrityCheck {
+			err = e.checkIntegrity(ctx, esUrl, body)
+		}
+		if e.sequences != nil {
+			if seqErr := e.checkSequence(ctx, esUrl); err == nil {
+				err = seqErr
+			}
+		}
+		return result, err
+	}
+	return result, nil
+}
+
+func (e *ESProbeAgent) setDelay(dataTime int64) {
+	delay := math.Floor(float64(((time.Now().UnixNano() / 1000000) - dataTime) / 1000))
+	e.metricRecorder.SetProbeElasticsearchDelay(e.appGroup.GetClusterName(), delay)
+	e.control.RecordDelay(delay)
+}
+
+// checkIntegrity verifies the latest probe log came back as it was pushed,
+// then that its typed fields are mapped as expected in the index it landed
+// in.
+func (e *ESProbeAgent) checkIntegrity(ctx context.Context, esUrl string, body []byte) error {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return err
+	}
+	hit := jsonParsed.Search("hits", "hits", "0")
+	source, ok := hit.Path("_source").Data().(map[string]interface{})
+	if !ok {
+		return errors.New("Can't find source")
+	}
+
+	reason := verifyIntegrity(source)
+	if reason == "" {
+		index, _ := hit.Path("_index").Data().(string)
+		mappingUrl := fmt.Sprintf("%s/%s/_mapping/field/%s", esUrl, index, strings.Join(integrityTypedFieldNames(), ","))
+		var mapping []byte
+		err := e.upstreams.For(o11y.UPSTREAM_ELASTICSEARCH).Do(esUrl, e.retryPolicy, func() error {
+			var err error
+			mapping, err = e.doRequest(ctx, mappingUrl, nil)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to get mapping of index %q: %w", index, err)
+		}
+		reason, err = verifyMapping(mapping)
+		if err != nil {
+			return fmt.Errorf("Failed to parse mapping of index %q: %w", index, err)
+		}
+	}
+
+	if reason != "" {
+		e.metricRecorder.IncreaseProbeIntegrityFailed(e.appGroup.GetClusterName(), reason)
+		return fmt.Errorf("Probe log failed integrity check, reason: %s", reason)
+	}
+	e.metricRecorder.IncreaseProbeIntegritySuccess(e.appGroup.GetClusterName())
+	return nil
+}
+
+type sequenceStats struct {
+	count    int64
+	distinct int64
+	min      int64
+	max      int64
+}
+
+// checkSequence counts the probe logs missing or duplicated among the ones
+// pushed since the last check, up to sequenceDelay ago to leave time for
+// them to be indexed. Without a previous check, or one older than
+// sequenceWindow, the last sequence number is only recorded, as the logs
+// before it may be from a sequence which didn't survive a restart.
+func (e *ESProbeAgent) checkSequence(ctx context.Context, esUrl string) error {
+	clusterName := e.appGroup.GetClusterName()
+	until := time.Now().Add(-e.sequenceDelay).UnixNano() / 1000000
+	checkedSeq, from := e.sequences.Checked(clusterName)
+	baseline := from == 0 || from < until-e.sequenceWindow.Milliseconds()
+	if baseline {
+		from = until - e.sequenceWindow.Milliseconds()
+	}
+	if from >= until {
+		return nil
+	}
+
+	query := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				e.esTimeField: map[string]interface{}{"gt": from, "lte": until},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"count_seq": map[string]interface{}{"value_count": map[string]interface{}{"field": SEQUENCE_FIELD}},
+			"min_seq":   map[string]interface{}{"min": map[string]interface{}{"field": SEQUENCE_FIELD}},
+			"max_seq":   map[string]interface{}{"max": map[string]interface{}{"field": SEQUENCE_FIELD}},
+			// exact below the threshold, far more than probe logs in a window
+			"distinct_seq": map[string]interface{}{"cardinality": map[string]interface{}{"field": SEQUENCE_FIELD, "precision_threshold": 40000}},
+		},
+	}
+	if e.backend.skipsTotalHits() {
+		query["track_total_hits"] = false
+	}
+	queryBody, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+
+	searchUrl := e.searchUrl(esUrl, time.Unix(0, from*int64(time.Millisecond)), time.Unix(0, until*int64(time.Millisecond)))
+	var body []byte
+	err = e.upstreams.For(o11y.UPSTREAM_ELASTICSEARCH).Do(esUrl, e.retryPolicy, func() error {
+		var err error
+		body, err = e.doRequest(ctx, searchUrl, queryBody)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to get sequence numbers: %w", err)
+	}
+	stats, err := parseSequenceStats(body)
+	if err != nil {
+		return fmt.Errorf("Failed to parse sequence numbers: %w", err)
+	}
+
+	if stats.count == 0 {
+		e.sequences.SetChecked(clusterName, checkedSeq, until)
+		return nil
+	}
+	unsettled := e.sequences.Unsettled(clusterName, checkedSeq, stats.max)
+	e.sequences.SetChecked(clusterName, stats.max, until)
+	if baseline {
+		return nil
+	}
+
+	missing := stats.max - stats.min + 1 - stats.distinct
+	// the sequence going back means it was reset, there's no gap to count
+	if checkedSeq > 0 && stats.min > checkedSeq+1 {
+		missing += stats.min - checkedSeq - 1
+	}
+	missing -= unsettled
+	duplicated := stats.count - stats.distinct
+	if missing < 0 {
+		missing = 0
+	}
+	if duplicated < 0 {
+		duplicated = 0
+	}
+
+	e.metricRecorder.IncreaseProbeSequenceMissing(clusterName, int(missing))
+	e.metricRecorder.IncreaseProbeSequenceDuplicated(clusterName, int(duplicated))
+	if missing > 0 || duplicated > 0 {
+		e.logger().WithField(logging.FIELD_ENDPOINT, esUrl).Warnf("Found %d missing and %d duplicated probe logs, sequence: %d to %d", missing, duplicated, checkedSeq+1, stats.max)
 	}
 	return nil
 }
 
+func parseSequenceStats(body []byte) (sequenceStats, error) {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return sequenceStats{}, err
+	}
+	count, ok := jsonParsed.Search("aggregations", "count_seq", "value").Data().(float64)
+	if !ok {
+		return sequenceStats{}, errors.New("Can't find sequence count")
+	}
+	if count == 0 {
+		return sequenceStats{}, nil
+	}
+
+	distinct, distinctOk := jsonParsed.Search("aggregations", "distinct_seq", "value").Data().(float64)
+	min, minOk := jsonParsed.Search("aggregations", "min_seq", "value").Data().(float64)
+	max, maxOk := jsonParsed.Search("aggregations", "max_seq", "value").Data().(float64)
+	if !distinctOk || !minOk || !maxOk {
+		return sequenceStats{}, errors.New("Can't find sequence range")
+	}
+	return sequenceStats{
+		count:    int64(count),
+		distinct: int64(distinct),
+		min:      int64(min),
+		max:      int64(max),
+	}, nil
+}
+
+func (e *ESProbeAgent) searchUrl(esUrl string, from, until time.Time) string {
+	app := fmt.Sprintf("%s-%s", e.appPrefix, e.appGroup.GetClusterName())
+	return e.appSearchUrl(esUrl, app, e.indexAlias, from, until)
+}
+
+// appSearchUrl targets the index when set, "{app}" standing for the app, or
+// else the daily indices of the app from from to until, so the query doesn't
+// run across the whole retention. Missing indices, e.g. today's before the
+// first log, are ignored.
+func (e *ESProbeAgent) appSearchUrl(esUrl, app, index string, from, until time.Time) string {
+	indices := []string{}
+	if index != "" {
+		indices = append(indices, strings.Replace(index, "{app}", app, -1))
+	} else {
+		// days start at midnight UTC, like the index names
+		for day := from.UTC().Truncate(24 * time.Hour); !day.After(until); day = day.Add(24 * time.Hour) {
+			indices = append(indices, app+"-"+day.Format(e.indexDate))
+		}
+	}
+	return fmt.Sprintf("%s/%s/_search?ignore_unavailable=true&allow_no_indices=true", esUrl, strings.Join(indices, ","))
+}
+
+// latestQuery finds the latest probe log within the lookback. The sort
+// doesn't fail on indices where the time field isn't mapped yet. The range
+// bounds the work, terminate_after would let a shard stop before reaching
+// its latest log.
+func (e *ESProbeAgent) latestQuery(now time.Time) ([]byte, error) {
+	query := map[string]interface{}{
+		"size": 1,
+		"sort": []interface{}{
+			map[string]interface{}{
+				e.esTimeField: map[string]interface{}{"order": "desc", "unmapped_type": "long"},
+			},
+		},
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				e.esTimeField: map[string]interface{}{"gte": now.Add(-e.lookback).UnixNano() / 1000000},
+			},
+		},
+	}
+	if e.backend.skipsTotalHits() {
+		query["track_total_hits"] = false
+	}
+	return json.Marshal(query)
+}
+
+// detectBackend asks the first ES answering for its distribution and
+// version, again every backendRefresh, or only once when it's 0. The last
+// backend found is kept when none answers, queries fit every version until
+// one is found.
+func (e *ESProbeAgent) detectBackend(ctx context.Context, esUrls []string) {
+	if !e.backendAt.IsZero() && (e.backendRefresh == 0 || time.Since(e.backendAt) < e.backendRefresh) {
+		return
+	}
+	e.backendAt = time.Now()
+
+	for _, esUrl := range esUrls {
+		var body []byte
+		err := e.upstreams.For(o11y.UPSTREAM_ELASTICSEARCH).Do(esUrl, e.retryPolicy, func() error {
+			var err error
+			body, err = e.doRequest(ctx, esUrl+"/", nil)
+			return err
+		})
+		if err != nil {
+			e.logger().WithField(logging.FIELD_ENDPOINT, esUrl).WithError(err).Debug("Failed to get ES version")
+			continue
+		}
+		backend, err := parseESBackend(body)
+		if err != nil {
+			e.logger().WithField(logging.FIELD_ENDPOINT, esUrl).WithError(err).Debug("Failed to parse ES version")
+			continue
+		}
+
+		if backend != e.backend {
+			e.logger().WithField(logging.FIELD_ENDPOINT, esUrl).Infof("Found %s %s", backend.Distribution, backend.Version)
+		}
+		e.backend = backend
+		e.metricRecorder.SetProbeElasticsearchInfo(e.appGroup.GetClusterName(), backend.Distribution, backend.Version)
+		return
+	}
+}
+
+// checkAppsFreshness exports the age of the latest log of each app checked
+// for the app group.
+func (e *ESProbeAgent) checkAppsFreshness(ctx context.Context, esUrls []string) {
+	clusterName := e.appGroup.GetClusterName()
+	for _, check := range e.appChecks {
+		age, err := e.appLastLogAge(ctx, esUrls, check)
+		if err != nil {
+			e.logger().WithField(logging.FIELD_APP, check.App).WithError(err).Error("Failed to get latest log of app")
+			continue
+		}
+
+		e.metricRecorder.SetAppLastLogAge(clusterName, check.App, age, check.MaxStaleness.Seconds())
+		if age > check.MaxStaleness.Seconds() {
+			e.logger().WithField(logging.FIELD_APP, check.App).Warnf("No log from app for %.0fs", age)
+		}
+	}
+}
+
+// appLastLogAge searches the latest log of the app within the lookback,
+// its age is +Inf when there's none. Unlike the probe index, app indices are
+// large, terminate_after would cut the sort short.
+func (e *ESProbeAgent) appLastLogAge(ctx context.Context, esUrls []string, check AppFreshnessCheck) (float64, error) {
+	now := time.Now()
+	query := map[string]interface{}{
+		"size":    1,
+		"_source": false,
+		"sort": []interface{}{
+			map[string]interface{}{
+				check.TimeField: map[string]interface{}{"order": "desc", "unmapped_type": "date"},
+			},
+		},
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				check.TimeField: map[string]interface{}{"gte": now.Add(-e.lookback).UnixNano() / 1000000},
+			},
+		},
+	}
+	if e.backend.skipsTotalHits() {
+		query["track_total_hits"] = false
+	}
+	queryBody, err := json.Marshal(query)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, esUrl := range esUrls {
+		searchUrl := e.appSearchUrl(esUrl, check.App, check.Index, now.Add(-e.lookback), now)
+		var body []byte
+		err = e.upstreams.For(o11y.UPSTREAM_ELASTICSEARCH).Do(esUrl, e.retryPolicy, func() error {
+			var err error
+			body, err = e.doRequest(ctx, searchUrl, queryBody)
+			return err
+		})
+		if err != nil {
+			continue
+		}
+		return parseLastLogAge(body, now)
+	}
+	return 0, err
+}
+
+// parseTook returns the time ES took to run the query, in second.
+func parseTook(body []byte) (float64, bool) {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return 0, false
+	}
+	took, ok := jsonParsed.Path("took").Data().(float64)
+	return took / 1000, ok
+}
+
+var errNoProbeLog = errors.New("No probe log found")
+
 func (e *ESProbeAgent) parseESBody(body []byte) (int64, error) {
 	jsonParsed, err := gabs.ParseJSON(body)
 	if err != nil {
 		log.Debugf("Failed to parse json, got error: %v", err)
 		return 0, err
 	}
+	if hits, ok := jsonParsed.Search("hits", "hits").Data().([]interface{}); ok && len(hits) == 0 {
+		return 0, errNoProbeLog
+	}
 	value, ok := jsonParsed.Search("hits", "hits", "0", "_source", e.esTimeField).Data().(float64)
 	if !ok {
 		return 0, errors.New("Can't find value")
@@ -116,27 +564,39 @@ func (e *ESProbeAgent) parseESBody(body []byte) (int64, error) {
 	return int64(value), nil
 }
 
-func (e *ESProbeAgent) doRequest(esUrl string) ([]byte, error) {
-	url := fmt.Sprintf("%s/%s-%s*/_search?sort=%s:desc&size=1", esUrl, e.appPrefix, e.appGroup.GetClusterName(), e.esTimeField)
-	log.Debugf("Do ES requests, appGroup: %q, URL: %q", e.appGroup.GetClusterName(), url)
+// doRequest sends a GET, or a POST when there's a query.
+func (e *ESProbeAgent) doRequest(ctx context.Context, url string, query []byte) ([]byte, error) {
+	e.logger().WithField(logging.FIELD_ENDPOINT, url).Debug("Do ES requests")
 
 	var c = &http.Client{
-		Timeout: e.requestTimeout,
+		Timeout:   e.requestTimeout,
+		Transport: tracing.NewTransport(nil),
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	method, reqBody := "GET", io.Reader(nil)
+	if query != nil {
+		method, reqBody = "POST", bytes.NewReader(query)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
 	if err != nil {
 		return []byte(""), errors.New("failed to create request")
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
+	// security is on by default from Elasticsearch 8 and in OpenSearch
+	if e.username != "" {
+		req.SetBasicAuth(e.username, e.password)
+	}
+	start := time.Now()
 	resp, err := c.Do(req)
 	if err != nil {
 		return []byte(""), err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("Got response status %d", resp.StatusCode)
-		log.Debugf("ES requests got status: %d, appGroup: %q, URL: %q", resp.StatusCode, e.appGroup.GetClusterName(), url)
+		err = &retry.StatusError{StatusCode: resp.StatusCode}
+		e.logger().WithField(logging.FIELD_ENDPOINT, url).WithFields(logging.Since(start)).Debugf("ES requests got status: %d", resp.StatusCode)
 		return []byte(""), err
 	}
 
@@ -2,15 +2,19 @@ package exporter
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
 	"github.com/BaritoLog/barito-blackbox-exporter/mock"
 	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
 	"github.com/golang/mock/gomock"
@@ -25,29 +29,35 @@ func TestESProbeAgent(t *testing.T) {
 
 	var pathCalled string
 	var queryString url.Values
+	var query map[string]interface{}
 	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 		pathCalled = r.URL.Path
 		queryString = r.URL.Query()
-		body := fmt.Sprintf(`{"hits": {"hits": [{"_source": { "barito_trace_time": %d}}]}}`, (time.Now().UnixNano()/1000000)-1001)
+		json.NewDecoder(r.Body).Decode(&query)
+		body := fmt.Sprintf(`{"took": 4, "hits": {"hits": [{"_source": { "barito_trace_time": %d}}]}}`, (time.Now().UnixNano()/1000000)-1001)
 		w.Header().Set("content-type", "application/json")
 		w.Write([]byte(body))
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(2)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(2)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(2)
-	ag.EXPECT().GetListES().Return([]string{esSrv.URL}, nil).MinTimes(2)
+	ag.EXPECT().GetListES(gomock.Any()).Return([]string{esSrv.URL}, nil).MinTimes(2)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeElasticSearchSuccess("lama").MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS).MinTimes(1)
 	// expect delay 1 second
 	mr.EXPECT().SetProbeElasticsearchDelay("lama", float64(1)).MinTimes(1)
+	mr.EXPECT().SetProbeElasticsearchTook("lama", 0.004).MinTimes(1)
 
 	agent := ESProbeAgent{
 		appGroup:       ag,
 		appPrefix:      "barito-log-probe",
 		esTimeField:    "barito_trace_time",
+		lookback:       1 * time.Hour,
+		indexDate:      "2006.01.02",
 		interval:       1 * time.Second,
 		metricRecorder: mr,
 		ctx:            ctx,
@@ -55,18 +65,174 @@ func TestESProbeAgent(t *testing.T) {
 
 	agent.Run()
 
-	expectedESPath := fmt.Sprintf("/%s-%s*/_search", agent.appPrefix, agent.appGroup.GetClusterName())
-	if pathCalled != expectedESPath {
-		t.Errorf("Should call ES at path: %q, got: %q", expectedESPath, pathCalled)
+	todayIndex := "barito-log-probe-lama-" + time.Now().UTC().Format("2006.01.02")
+	if !strings.HasSuffix(pathCalled, todayIndex+"/_search") {
+		t.Errorf("Should call ES on the indices up to %q, got: %q", todayIndex, pathCalled)
 	}
 
 	expectedQueryString := url.Values{
-		"sort": []string{agent.esTimeField + ":desc"},
-		"size": []string{"1"},
+		"ignore_unavailable": []string{"true"},
+		"allow_no_indices":   []string{"true"},
 	}
 	if !reflect.DeepEqual(queryString, expectedQueryString) {
 		t.Errorf("Should call ES at with query string: %+v, got: %+v", expectedQueryString, queryString)
 	}
+
+	expectedSort := []interface{}{
+		map[string]interface{}{"barito_trace_time": map[string]interface{}{"order": "desc", "unmapped_type": "long"}},
+	}
+	if !reflect.DeepEqual(query["sort"], expectedSort) {
+		t.Errorf("Should sort by %+v, got: %+v", expectedSort, query["sort"])
+	}
+	if _, ok := query["terminate_after"]; ok {
+		t.Errorf("Should not terminate the sorted query early, got: %v", query["terminate_after"])
+	}
+	timeRange, _ := query["query"].(map[string]interface{})["range"].(map[string]interface{})["barito_trace_time"].(map[string]interface{})
+	if gte, _ := timeRange["gte"].(float64); time.Since(time.Unix(0, int64(gte)*int64(time.Millisecond))) < time.Hour {
+		t.Errorf("Should search the last hour, got: %+v", timeRange)
+	}
+}
+
+func TestESProbeAgent_searchUrl(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+
+	agent := ESProbeAgent{
+		appGroup:  ag,
+		appPrefix: "barito-log-probe",
+		indexDate: "2006.01.02",
+	}
+	from := time.Date(2020, 9, 11, 23, 30, 0, 0, time.UTC)
+	until := time.Date(2020, 9, 12, 0, 30, 0, 0, time.UTC)
+
+	expected := "http://es:9200/barito-log-probe-lama-2020.09.11,barito-log-probe-lama-2020.09.12/_search?ignore_unavailable=true&allow_no_indices=true"
+	if searchUrl := agent.searchUrl("http://es:9200", from, until); searchUrl != expected {
+		t.Errorf("Should search daily indices %q, got: %q", expected, searchUrl)
+	}
+
+	agent.indexAlias = "{app}-latest"
+	expected = "http://es:9200/barito-log-probe-lama-latest/_search?ignore_unavailable=true&allow_no_indices=true"
+	if searchUrl := agent.searchUrl("http://es:9200", from, until); searchUrl != expected {
+		t.Errorf("Should search alias %q, got: %q", expected, searchUrl)
+	}
+}
+
+func TestESProbeAgent_failed_noData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.Write([]byte(`{"hits": {"total": {"value": 0}, "hits": []}}`))
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
+	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
+	ag.EXPECT().GetListES(gomock.Any()).MinTimes(1).Return([]string{esSrv.URL}, nil)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA).MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA).MinTimes(1)
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		appPrefix:      "barito-log-probe",
+		esTimeField:    "barito_trace_time",
+		interval:       1 * time.Second,
+		requestTimeout: 1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+}
+
+func TestESProbeAgent_stalledPastLookback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.Write([]byte(`{"hits": {"total": {"value": 0}, "hits": []}}`))
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any())
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+	ag.EXPECT().GetListES(gomock.Any()).Return([]string{esSrv.URL}, nil)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+	mr.EXPECT().SetProbeElasticsearchDelay("lama", gomock.Any()).Do(func(appGroup string, delay float64) {
+		if delay < 7200 {
+			t.Errorf("Should report the delay since the last log seen, got: %v", delay)
+		}
+	})
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		appPrefix:      "barito-log-probe",
+		esTimeField:    "barito_trace_time",
+		lookback:       time.Hour,
+		requestTimeout: time.Second,
+		lastDataTime:   time.Now().Add(-2*time.Hour).UnixNano() / 1000000,
+		metricRecorder: mr,
+	}
+	agent.tick(context.Background())
+}
+
+func TestESProbeAgent_savedProbeLogTime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hits := `[]`
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		w.Write([]byte(`{"hits": {"hits": ` + hits + `}}`))
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).Times(2)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+	ag.EXPECT().GetListES(gomock.Any()).Return([]string{esSrv.URL}, nil).Times(2)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().SetProbePaused("lama", o11y.PROBE_ELASTICSEARCH, false)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+	mr.EXPECT().IncreaseProbeElasticSearchSuccess("lama")
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS)
+	delays := []float64{}
+	mr.EXPECT().SetProbeElasticsearchDelay("lama", gomock.Any()).Do(func(appGroup string, delay float64) {
+		delays = append(delays, delay)
+	}).Times(2)
+
+	// saved before the restart, the pipeline stalled since
+	probeLogTimes := NewProbeLogTimes(map[string]int64{"lama": time.Now().Add(-2*time.Hour).UnixNano() / 1000000})
+	cfg := &config.Config{ProduceAppPrefix: "barito-log-probe", ProduceTimeField: "barito_trace_time", ESProbeLookback: time.Hour, ESProbeTimeout: time.Second}
+	agent := NewESProbeAgent(ag, nil, probeLogTimes, nil, nil, context.Background(), cfg, mr)
+	agent.tick(context.Background())
+
+	dataTime := time.Now().Add(-time.Minute).UnixNano() / 1000000
+	hits = fmt.Sprintf(`[{"_source": {"barito_trace_time": %d}}]`, dataTime)
+	agent.tick(context.Background())
+
+	if len(delays) != 2 || delays[0] < 7200 || delays[1] >= 7200 {
+		t.Errorf("Should report the delay since the saved probe log time, then the new one, got: %v", delays)
+	}
+	if probeLogTimes.Get("lama") != dataTime {
+		t.Errorf("Should keep the latest probe log time, got: %d", probeLogTimes.Get("lama"))
+	}
 }
 
 func TestESProbeAgent_failed_noES(t *testing.T) {
@@ -77,12 +243,13 @@ func TestESProbeAgent_failed_noES(t *testing.T) {
 	defer cancel()
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(1)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
-	ag.EXPECT().GetListES().MinTimes(1).Return([]string{}, nil)
+	ag.EXPECT().GetListES(gomock.Any()).MinTimes(1).Return([]string{}, nil)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND).MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND).MinTimes(1)
 
 	agent := ESProbeAgent{
 		appGroup:       ag,
@@ -103,12 +270,13 @@ func TestESProbeAgent_failed_errorGetListES(t *testing.T) {
 	defer cancel()
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(1)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
-	ag.EXPECT().GetListES().MinTimes(1).Return([]string{}, errors.New("err"))
+	ag.EXPECT().GetListES(gomock.Any()).MinTimes(1).Return([]string{}, errors.New("err"))
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL).MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL).MinTimes(1)
 
 	agent := ESProbeAgent{
 		appGroup:       ag,
@@ -121,6 +289,33 @@ func TestESProbeAgent_failed_errorGetListES(t *testing.T) {
 
 	agent.Run()
 }
+func TestESProbeAgent_oneRunPerCycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any())
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+	ag.EXPECT().GetListES(gomock.Any()).Return([]string{esSrv.URL, esSrv.URL, esSrv.URL}, nil)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED).Times(3)
+	mr.EXPECT().IncreaseProbeRequestFailed("lama", o11y.PROBE_ELASTICSEARCH, o11y.REASON_CONNECT_REFUSED).Times(3)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		appPrefix:      "barito-log-probe",
+		esTimeField:    "barito_trace_time",
+		requestTimeout: time.Second,
+		metricRecorder: mr,
+	}
+	agent.tick(context.Background())
+}
+
 func TestESProbeAgent_failed_esTimeout(t *testing.T) {
 
 	ctrl := gomock.NewController(t)
@@ -134,12 +329,14 @@ func TestESProbeAgent_failed_esTimeout(t *testing.T) {
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(1)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
-	ag.EXPECT().GetListES().MinTimes(1).Return([]string{esSrv.URL}, nil)
+	ag.EXPECT().GetListES(gomock.Any()).MinTimes(1).Return([]string{esSrv.URL}, nil)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeRequestFailed("lama", o11y.PROBE_ELASTICSEARCH, o11y.REASON_TIMEOUT).MinTimes(1)
 
 	agent := ESProbeAgent{
 		appGroup:       ag,
@@ -168,12 +365,14 @@ func TestESProbeAgent_failed_invalidData(t *testing.T) {
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(1)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
-	ag.EXPECT().GetListES().MinTimes(1).Return([]string{esSrv.URL}, nil)
+	ag.EXPECT().GetListES(gomock.Any()).MinTimes(1).Return([]string{esSrv.URL}, nil)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeRequestFailed("lama", o11y.PROBE_ELASTICSEARCH, o11y.REASON_PARSE).MinTimes(1)
 
 	agent := ESProbeAgent{
 		appGroup:       ag,
@@ -187,6 +386,234 @@ func TestESProbeAgent_failed_invalidData(t *testing.T) {
 	agent.Run()
 }
 
+func TestESProbeAgent_integrity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mapping  string
+		modify   func(source map[string]interface{})
+		expected string
+	}{
+		{"success", "long", func(source map[string]interface{}) {}, ""},
+		{"mangled", "long", func(source map[string]interface{}) { source["source"] = "changed" }, o11y.REASON_INTEGRITY_MANGLED_FIELD},
+		{"mapping type", "keyword", func(source map[string]interface{}) {}, o11y.REASON_INTEGRITY_MAPPING_TYPE},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			defer cancel()
+
+			source := buildIntegritySource(t, time.Now().Add(-1001*time.Millisecond))
+			tc.modify(source)
+
+			var mappingPath string
+			esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				if !strings.HasSuffix(r.URL.Path, "/_search") {
+					mappingPath = r.URL.Path
+					fmt.Fprintf(w, `{"barito-log-probe-lama-2020.09.13": {"mappings": {
+						"barito_probe_long": {"full_name": "barito_probe_long", "mapping": {"barito_probe_long": {"type": %q}}},
+						"barito_probe_double": {"full_name": "barito_probe_double", "mapping": {"barito_probe_double": {"type": "float"}}},
+						"barito_probe_boolean": {"full_name": "barito_probe_boolean", "mapping": {"barito_probe_boolean": {"type": "boolean"}}},
+						"barito_probe_keyword": {"full_name": "barito_probe_keyword", "mapping": {"barito_probe_keyword": {"type": "text"}}}
+					}}}`, tc.mapping)
+					return
+				}
+				hit, _ := json.Marshal(source)
+				fmt.Fprintf(w, `{"hits": {"hits": [{"_index": "barito-log-probe-lama-2020.09.13", "_source": %s}]}}`, hit)
+			}))
+			defer esSrv.Close()
+
+			ag := mock.NewMockAppGroup(ctrl)
+			ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
+			ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
+			ag.EXPECT().GetListES(gomock.Any()).Return([]string{esSrv.URL}, nil).MinTimes(1)
+
+			mr := mock.NewMockMetricRecorder(ctrl)
+			mr.EXPECT().IncreaseProbeElasticSearchSuccess("lama").MinTimes(1)
+			mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS).MinTimes(1)
+			mr.EXPECT().SetProbeElasticsearchDelay("lama", gomock.Any()).MinTimes(1)
+			if tc.expected == "" {
+				mr.EXPECT().IncreaseProbeIntegritySuccess("lama").MinTimes(1)
+			} else {
+				mr.EXPECT().IncreaseProbeIntegrityFailed("lama", tc.expected).MinTimes(1)
+			}
+
+			agent := ESProbeAgent{
+				appGroup:       ag,
+				appPrefix:      "barito-log-probe",
+				esTimeField:    "barito_trace_time",
+				interval:       1 * time.Second,
+				requestTimeout: 1 * time.Second,
+				integrityCheck: true,
+				metricRecorder: mr,
+				ctx:            ctx,
+			}
+			agent.Run()
+
+			expectedMappingPath := "/barito-log-probe-lama-2020.09.13/_mapping/field/barito_probe_boolean,barito_probe_double,barito_probe_keyword,barito_probe_long"
+			if tc.name != "mangled" && mappingPath != expectedMappingPath {
+				t.Errorf("Should get mapping at path: %q, got: %q", expectedMappingPath, mappingPath)
+			}
+		})
+	}
+}
+
+func TestESProbeAgent_checkSequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var query map[string]interface{}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/barito-log-probe-lama/_search" {
+			t.Errorf("Should search probe logs, got: %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&query)
+		w.Header().Set("content-type", "application/json")
+		w.Write([]byte(`{"hits": {"hits": []}, "aggregations": {
+			"count_seq": {"value": 6},
+			"distinct_seq": {"value": 5},
+			"min_seq": {"value": 12},
+			"max_seq": {"value": 16}
+		}}`))
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	// 11 never made it, 14 made it twice
+	mr.EXPECT().IncreaseProbeSequenceMissing("lama", 1)
+	mr.EXPECT().IncreaseProbeSequenceDuplicated("lama", 1)
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		appPrefix:      "barito-log-probe",
+		esTimeField:    "barito_trace_time",
+		indexAlias:     "{app}",
+		requestTimeout: 1 * time.Second,
+		sequences:      NewSequences(nil),
+		sequenceWindow: 10 * time.Minute,
+		sequenceDelay:  1 * time.Minute,
+		metricRecorder: mr,
+	}
+
+	// the first check only records where the sequence is at
+	if err := agent.checkSequence(context.Background(), esSrv.URL); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	checkedSeq, checkedTime := agent.sequences.Checked("lama")
+	if checkedSeq != 16 {
+		t.Errorf("Should record last sequence number, got: %d", checkedSeq)
+	}
+
+	checkedTime -= 30000
+	agent.sequences.SetChecked("lama", 10, checkedTime)
+	if err := agent.checkSequence(context.Background(), esSrv.URL); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	timeRange, _ := query["query"].(map[string]interface{})["range"].(map[string]interface{})["barito_trace_time"].(map[string]interface{})
+	if timeRange["gt"] != float64(checkedTime) {
+		t.Errorf("Should search from last check %d, got: %v", checkedTime, timeRange["gt"])
+	}
+}
+
+func TestESProbeAgent_detectBackend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	timesCalled := 0
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timesCalled++
+		if user, pass, ok := r.BasicAuth(); !ok || user != "prober" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		w.Write([]byte(`{"version": {"distribution": "opensearch", "number": "2.11.0"}}`))
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().SetProbeElasticsearchInfo("lama", "opensearch", "2.11.0")
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		esTimeField:    "barito_trace_time",
+		requestTimeout: 1 * time.Second,
+		username:       "prober",
+		password:       "secret",
+		backendRefresh: 1 * time.Hour,
+		metricRecorder: mr,
+	}
+
+	agent.detectBackend(context.Background(), []string{esSrv.URL})
+	// not refreshed before backendRefresh
+	agent.detectBackend(context.Background(), []string{esSrv.URL})
+	if timesCalled != 1 {
+		t.Errorf("Should ask for the version once, got: %d", timesCalled)
+	}
+
+	body, _ := agent.latestQuery(time.Now())
+	var query map[string]interface{}
+	json.Unmarshal(body, &query)
+	if query["track_total_hits"] != false {
+		t.Errorf("Should not track total hits on opensearch, got: %v", query["track_total_hits"])
+	}
+}
+
+func TestESProbeAgent_checkAppsFreshness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	paths := []string{}
+	esSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("content-type", "application/json")
+		if r.URL.Path == "/payment-v2-*/_search" {
+			w.Write([]byte(`{"hits": {"hits": []}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"hits": {"hits": [{"sort": [%d]}]}}`, time.Now().Add(-time.Minute).UnixNano()/1000000)
+	}))
+	defer esSrv.Close()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().SetAppLastLogAge("lama", "checkout", gomock.Any(), float64(300)).Do(func(_, _ string, age, _ float64) {
+		if age < 59 || age > 61 {
+			t.Errorf("Should export age of about 60s, got: %v", age)
+		}
+	})
+	mr.EXPECT().SetAppLastLogAge("lama", "payment", math.Inf(1), float64(3600))
+
+	agent := ESProbeAgent{
+		appGroup:       ag,
+		lookback:       time.Minute,
+		indexDate:      "2006.01.02",
+		requestTimeout: 1 * time.Second,
+		appChecks: []AppFreshnessCheck{
+			{AppGroup: "lama", App: "checkout", TimeField: "@timestamp", MaxStaleness: 5 * time.Minute},
+			{AppGroup: "lama", App: "payment", Index: "payment-v2-*", TimeField: "created_at", MaxStaleness: time.Hour},
+		},
+		metricRecorder: mr,
+	}
+	agent.checkAppsFreshness(context.Background(), []string{esSrv.URL})
+
+	if len(paths) != 2 || !strings.HasPrefix(paths[0], "/checkout-") {
+		t.Errorf("Should search the daily indices of checkout then payment-v2-*, got: %v", paths)
+	}
+}
+
 func TestParseBody(t *testing.T) {
 	payload := `
 	{
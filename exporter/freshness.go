@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// AppFreshnessCheck watches the latest log of an app of an app group. Index
+// is an index pattern or alias, the daily indices of App when empty.
+type AppFreshnessCheck struct {
+	AppGroup     string        `yaml:"app_group"`
+	App          string        `yaml:"app"`
+	Index        string        `yaml:"index"`
+	TimeField    string        `yaml:"time_field"`
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+}
+
+// AppFreshnessChecks are the checks by app group cluster name.
+type AppFreshnessChecks map[string][]AppFreshnessCheck
+
+// LoadAppFreshnessChecks reads a YAML list of checks with app_group, app,
+// max_staleness, e.g. "5m", and optionally index and time_field, which
+// defaults to "@timestamp".
+func LoadAppFreshnessChecks(path string) (AppFreshnessChecks, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AppFreshnessCheck
+	if err := yaml.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %v", path, err)
+	}
+
+	checks := AppFreshnessChecks{}
+	for _, e := range entries {
+		if e.AppGroup == "" || e.App == "" || e.MaxStaleness <= 0 {
+			return nil, fmt.Errorf("Failed to parse %q: app_group, app and max_staleness are mandatory", path)
+		}
+		if e.TimeField == "" {
+			e.TimeField = "@timestamp"
+		}
+		checks[e.AppGroup] = append(checks[e.AppGroup], e)
+	}
+	return checks, nil
+}
+
+// parseLastLogAge reads the age in second of the latest log from its sort
+// value, in millisecond whether the time field is a date or a number. It's
+// +Inf when no log was found.
+func parseLastLogAge(body []byte, now time.Time) (float64, error) {
+	jsonParsed, err := gabs.ParseJSON(body)
+	if err != nil {
+		return 0, err
+	}
+	if hits, ok := jsonParsed.Search("hits", "hits").Data().([]interface{}); ok && len(hits) == 0 {
+		return math.Inf(1), nil
+	}
+
+	lastLogTime, ok := jsonParsed.Search("hits", "hits", "0", "sort", "0").Data().(float64)
+	if !ok {
+		return 0, errors.New("Can't find sort value")
+	}
+	age := float64(now.UnixNano()/1000000-int64(lastLogTime)) / 1000
+	return math.Max(age, 0), nil
+}
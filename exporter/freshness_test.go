@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadAppFreshnessChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freshness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checks.yaml")
+	ioutil.WriteFile(path, []byte(`
+- app_group: lama
+  app: checkout
+  max_staleness: 5m
+- app_group: lama
+  app: payment
+  index: "payment-v2-*"
+  time_field: created_at
+  max_staleness: 1h
+`), 0644)
+
+	checks, err := LoadAppFreshnessChecks(path)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	expected := AppFreshnessChecks{
+		"lama": {
+			{AppGroup: "lama", App: "checkout", TimeField: "@timestamp", MaxStaleness: 5 * time.Minute},
+			{AppGroup: "lama", App: "payment", Index: "payment-v2-*", TimeField: "created_at", MaxStaleness: time.Hour},
+		},
+	}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Errorf("Should return %+v, got: %+v", expected, checks)
+	}
+
+	ioutil.WriteFile(path, []byte(`[{app_group: lama, app: checkout}]`), 0644)
+	if _, err := LoadAppFreshnessChecks(path); err == nil {
+		t.Errorf("Should return error without max_staleness")
+	}
+}
+
+func TestParseLastLogAge(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	age, err := parseLastLogAge([]byte(`{"hits": {"hits": [{"_index": "checkout-2020.09.13", "sort": [1599999970000]}]}}`), now)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	if age != 30 {
+		t.Errorf("Should return age of 30s, got: %v", age)
+	}
+
+	age, err = parseLastLogAge([]byte(`{"hits": {"hits": []}}`), now)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	if !math.IsInf(age, 1) {
+		t.Errorf("Should return +Inf without log, got: %v", age)
+	}
+
+	if _, err := parseLastLogAge([]byte(`{"hits": {"hits": [{"_source": {}}]}}`), now); err == nil {
+		t.Errorf("Should return error without sort value")
+	}
+}
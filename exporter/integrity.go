@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/Jeffail/gabs/v2"
+)
+
+const (
+	INTEGRITY_CHECKSUM_FIELD = "barito_probe_checksum"
+	INTEGRITY_FIELDS_FIELD   = "barito_probe_fields"
+)
+
+// integrityTypedFields are pushed with every probe log so a pipeline
+// coercing types, or an index template mapping them differently, is caught.
+var integrityTypedFields = map[string]interface{}{
+	"barito_probe_long":    4242,
+	"barito_probe_double":  42.42,
+	"barito_probe_boolean": true,
+	"barito_probe_keyword": "barito-prober ✓ \"quoted\"",
+}
+
+// integrityMappingTypes are the accepted ES types of integrityTypedFields.
+var integrityMappingTypes = map[string][]string{
+	"barito_probe_long":    {"long", "integer"},
+	"barito_probe_double":  {"float", "double", "half_float", "scaled_float"},
+	"barito_probe_boolean": {"boolean"},
+	"barito_probe_keyword": {"keyword", "text"},
+}
+
+// addIntegrity adds the typed fields, the list of fields covered by the
+// checksum and the checksum itself to item.
+func addIntegrity(item map[string]interface{}) error {
+	for k, v := range integrityTypedFields {
+		item[k] = v
+	}
+
+	// checksum what ES will give back, numbers decoded as float64
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	fields := []string{}
+	for k := range decoded {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	checksum, err := integrityChecksum(decoded, fields)
+	if err != nil {
+		return err
+	}
+	item[INTEGRITY_FIELDS_FIELD] = strings.Join(fields, ",")
+	item[INTEGRITY_CHECKSUM_FIELD] = checksum
+	return nil
+}
+
+func integrityChecksum(source map[string]interface{}, fields []string) (string, error) {
+	h := sha256.New()
+	for _, field := range fields {
+		b, err := json.Marshal(source[field])
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(field))
+		h.Write([]byte("="))
+		h.Write(b)
+		h.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyIntegrity checks the _source of a probe log against its checksum,
+// and returns the reason it doesn't match, or "" when it does.
+func verifyIntegrity(source map[string]interface{}) string {
+	checksum, ok := source[INTEGRITY_CHECKSUM_FIELD].(string)
+	fieldList, fieldListOk := source[INTEGRITY_FIELDS_FIELD].(string)
+	if !ok || !fieldListOk {
+		return o11y.REASON_INTEGRITY_MISSING_CHECKSUM
+	}
+
+	fields := strings.Split(fieldList, ",")
+	for _, field := range fields {
+		if _, ok := source[field]; !ok {
+			return o11y.REASON_INTEGRITY_DROPPED_FIELD
+		}
+	}
+
+	actual, err := integrityChecksum(source, fields)
+	if err != nil || actual != checksum {
+		return o11y.REASON_INTEGRITY_MANGLED_FIELD
+	}
+	return ""
+}
+
+// verifyMapping checks the response of the field mapping API for
+// integrityTypedFields, and returns o11y.REASON_INTEGRITY_MAPPING_TYPE when
+// one of them is missing or mapped to an unexpected type.
+func verifyMapping(body []byte) (string, error) {
+	g, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", err
+	}
+
+	types := map[string]string{}
+	collectMappingTypes(g, types)
+
+	for field, accepted := range integrityMappingTypes {
+		if !contains(accepted, types[field]) {
+			return o11y.REASON_INTEGRITY_MAPPING_TYPE, nil
+		}
+	}
+	return "", nil
+}
+
+// collectMappingTypes walks the response down to the field entries, as it
+// is nested under the document type on ES 6 but not on ES 7.
+func collectMappingTypes(g *gabs.Container, types map[string]string) {
+	if fullName, ok := g.Path("full_name").Data().(string); ok {
+		for _, mapping := range g.Path("mapping").ChildrenMap() {
+			if t, ok := mapping.Path("type").Data().(string); ok {
+				types[fullName] = t
+			}
+		}
+		return
+	}
+	for _, child := range g.ChildrenMap() {
+		collectMappingTypes(child, types)
+	}
+}
+
+func integrityTypedFieldNames() []string {
+	names := []string{}
+	for name := range integrityTypedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package exporter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+func buildIntegritySource(t *testing.T, now time.Time) map[string]interface{} {
+	payload, err := NewPayload(&config.Config{
+		ProduceTimeField:      "barito_trace_time",
+		ProduceMessageSize:    1000,
+		ProduceStaticFields:   map[string]string{"source": "prober"},
+		IntegrityCheckEnabled: true,
+	})
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	body, err := payload.BuildSingle(PayloadData{}, now, 0)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+
+	source := map[string]interface{}{}
+	if err := json.Unmarshal(body, &source); err != nil {
+		t.Fatalf("Should build a valid json, got: %q", string(body))
+	}
+	// added by the pipeline, not covered by the checksum
+	source["@timestamp"] = "2020-09-13T12:26:40Z"
+	return source
+}
+
+func TestVerifyIntegrity(t *testing.T) {
+	testCases := []struct {
+		name     string
+		modify   func(source map[string]interface{})
+		expected string
+	}{
+		{"untouched", func(source map[string]interface{}) {}, ""},
+		{"padding dropped", func(source map[string]interface{}) { delete(source, PADDING_FIELD) }, ""},
+		{"checksum dropped", func(source map[string]interface{}) { delete(source, INTEGRITY_CHECKSUM_FIELD) }, o11y.REASON_INTEGRITY_MISSING_CHECKSUM},
+		{"field dropped", func(source map[string]interface{}) { delete(source, "source") }, o11y.REASON_INTEGRITY_DROPPED_FIELD},
+		{"value mangled", func(source map[string]interface{}) { source["barito_probe_keyword"] = "barito-prober ?" }, o11y.REASON_INTEGRITY_MANGLED_FIELD},
+		{"type coerced", func(source map[string]interface{}) { source["barito_probe_long"] = "4242" }, o11y.REASON_INTEGRITY_MANGLED_FIELD},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := buildIntegritySource(t, time.Unix(1600000000, 0))
+			tc.modify(source)
+			if reason := verifyIntegrity(source); reason != tc.expected {
+				t.Errorf("Should return reason %q, got: %q", tc.expected, reason)
+			}
+		})
+	}
+}
+
+func TestVerifyMapping(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{"es7", `{"barito-prober-lama-2020.09.13": {"mappings": {
+			"barito_probe_long": {"full_name": "barito_probe_long", "mapping": {"barito_probe_long": {"type": "long"}}},
+			"barito_probe_double": {"full_name": "barito_probe_double", "mapping": {"barito_probe_double": {"type": "float"}}},
+			"barito_probe_boolean": {"full_name": "barito_probe_boolean", "mapping": {"barito_probe_boolean": {"type": "boolean"}}},
+			"barito_probe_keyword": {"full_name": "barito_probe_keyword", "mapping": {"barito_probe_keyword": {"type": "text"}}}
+		}}}`, ""},
+		{"es6", `{"barito-prober-lama-2020.09.13": {"mappings": {"_doc": {
+			"barito_probe_long": {"full_name": "barito_probe_long", "mapping": {"barito_probe_long": {"type": "long"}}},
+			"barito_probe_double": {"full_name": "barito_probe_double", "mapping": {"barito_probe_double": {"type": "float"}}},
+			"barito_probe_boolean": {"full_name": "barito_probe_boolean", "mapping": {"barito_probe_boolean": {"type": "boolean"}}},
+			"barito_probe_keyword": {"full_name": "barito_probe_keyword", "mapping": {"barito_probe_keyword": {"type": "keyword"}}}
+		}}}}`, ""},
+		{"mistyped", `{"barito-prober-lama-2020.09.13": {"mappings": {
+			"barito_probe_long": {"full_name": "barito_probe_long", "mapping": {"barito_probe_long": {"type": "keyword"}}},
+			"barito_probe_double": {"full_name": "barito_probe_double", "mapping": {"barito_probe_double": {"type": "float"}}},
+			"barito_probe_boolean": {"full_name": "barito_probe_boolean", "mapping": {"barito_probe_boolean": {"type": "boolean"}}},
+			"barito_probe_keyword": {"full_name": "barito_probe_keyword", "mapping": {"barito_probe_keyword": {"type": "text"}}}
+		}}}`, o11y.REASON_INTEGRITY_MAPPING_TYPE},
+		{"unmapped", `{"barito-prober-lama-2020.09.13": {"mappings": {}}}`, o11y.REASON_INTEGRITY_MAPPING_TYPE},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, err := verifyMapping([]byte(tc.body))
+			if err != nil {
+				t.Fatalf("Should not return error, got: %v", err)
+			}
+			if reason != tc.expected {
+				t.Errorf("Should return reason %q, got: %q", tc.expected, reason)
+			}
+		})
+	}
+}
@@ -10,7 +10,10 @@ import (
 
 	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
 	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,47 +22,68 @@ type KibanaProbeAgent struct {
 	probePath      string
 	interval       time.Duration
 	requestTimeout time.Duration
+	retryPolicy    retry.Policy
+	upstreams      *retry.Upstreams
+	control        *AgentControl
 	metricRecorder o11y.MetricRecorder
 	ctx            context.Context
 }
 
-func NewKibanaProbeAgent(appGroup appgroup.AppGroup, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *KibanaProbeAgent {
+func NewKibanaProbeAgent(appGroup appgroup.AppGroup, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *KibanaProbeAgent {
 	path := fmt.Sprintf("/%s/api/index_management/indices", appGroup.GetClusterName())
 	return &KibanaProbeAgent{
 		appGroup:       appGroup,
 		probePath:      path,
 		interval:       cfg.KibanaProbeInterval,
 		requestTimeout: cfg.KibanaProbeTimeout,
+		retryPolicy:    retry.NewPolicy(cfg.KibanaProbeRetries, cfg.KibanaProbeRetryBackoff, cfg.KibanaProbeRetryStatusCodes),
+		upstreams:      upstreams,
+		control:        NewAgentControl(appGroup.GetClusterName(), o11y.PROBE_KIBANA, mR),
 		metricRecorder: mR,
 		ctx:            ctx,
 	}
 }
 
+func (e *KibanaProbeAgent) Control() *AgentControl {
+	return e.control
+}
+
 func (e *KibanaProbeAgent) Run() {
 	for {
 		select {
 		case <-e.ctx.Done():
-			log.Println("Exit")
+			e.logger().Info("Exit")
 			return
 		default:
-			err := e.tick()
-			if err != nil {
-				log.Errorf("Failed to probe kibana, appGroup: %q, error: %v", e.appGroup.GetClusterName(), err)
+			if e.control.ShouldRun() {
+				start := time.Now()
+				ctx, span := tracing.Start(context.Background(), "kibana")
+				span.SetAttribute("app_group", e.appGroup.GetClusterName())
+				err := e.tick(ctx)
+				span.End(err)
+				e.control.Record(start, err)
+				if err != nil {
+					e.logger().WithFields(logging.Since(start)).WithError(err).Error("Failed to probe kibana")
+				}
 			}
-			time.Sleep(e.interval)
+			e.control.Sleep(e.ctx, e.interval)
 		}
 	}
 }
 
-func (e *KibanaProbeAgent) tick() error {
-	err := e.appGroup.RefreshMetadata()
+func (e *KibanaProbeAgent) logger() *log.Entry {
+	return logging.For(e.appGroup.GetClusterName(), o11y.PROBE_KIBANA)
+}
+
+func (e *KibanaProbeAgent) tick(ctx context.Context) error {
+	err := e.appGroup.RefreshMetadata(ctx)
 	if err != nil {
 		e.metricRecorder.IncreaseProbeKibanaFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_KIBANA_FAILED_FETCH_METADATA)
 		return err
 	}
 
-	kibanaURL, err := e.appGroup.GetKibanaHost()
+	kibanaURL, err := e.appGroup.GetKibanaHost(ctx)
 	if err != nil {
 		e.metricRecorder.IncreaseProbeKibanaFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_KIBANA_FAILED_GET_KIBANA_FROM_CONSUL)
@@ -71,12 +95,18 @@ func (e *KibanaProbeAgent) tick() error {
 		return err
 	}
 
+	e.control.RecordEndpoints([]string{kibanaURL})
 	url := kibanaURL + e.probePath
-	_, err = e.doRequest(url)
+	err = e.upstreams.For(o11y.UPSTREAM_KIBANA).Do(kibanaURL, e.retryPolicy, func() error {
+		_, err := e.doRequest(ctx, url)
+		return err
+	})
 	if err != nil {
-		log.Debugf("Failed to hit Kibana, appgroup: %q, es: %q", e.appGroup.GetClusterName(), url)
+		reason := classifyError(err)
+		e.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: url, logging.FIELD_REASON: reason}).WithError(err).Debug("Failed to hit Kibana")
 		e.metricRecorder.IncreaseProbeKibanaFailed(e.appGroup.GetClusterName(),
 			o11y.REASON_PROBE_KIBANA_REQUEST_FAILED)
+		e.metricRecorder.IncreaseProbeRequestFailed(e.appGroup.GetClusterName(), o11y.PROBE_KIBANA, reason)
 		return err
 	}
 
@@ -84,26 +114,30 @@ func (e *KibanaProbeAgent) tick() error {
 	return nil
 }
 
-func (e *KibanaProbeAgent) doRequest(url string) ([]byte, error) {
-	log.Debugf("Do Kibana requests, appGroup: %q, URL: %q", e.appGroup.GetClusterName(), url)
+func (e *KibanaProbeAgent) doRequest(ctx context.Context, url string) ([]byte, error) {
+	e.logger().WithField(logging.FIELD_ENDPOINT, url).Debug("Do Kibana requests")
 
 	var c = &http.Client{
-		Timeout: e.requestTimeout,
+		Timeout:   e.requestTimeout,
+		Transport: tracing.NewTransport(nil),
 	}
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return []byte(""), errors.New("failed to create request")
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
 	resp, err := c.Do(req)
 	if err != nil {
 		return []byte(""), err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("Got response status %d", resp.StatusCode)
-		log.Debugf("Kibana requests got status: %d, appGroup: %q, URL: %q", resp.StatusCode, e.appGroup.GetClusterName(), url)
+		err = &retry.StatusError{StatusCode: resp.StatusCode}
+		e.logger().WithField(logging.FIELD_ENDPOINT, url).WithFields(logging.Since(start)).Debugf("Kibana requests got status: %d", resp.StatusCode)
 		return []byte(""), err
 	}
 
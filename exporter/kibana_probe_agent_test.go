@@ -26,9 +26,9 @@ func TestKibanaProbeAgent(t *testing.T) {
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(2)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(2)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(2)
-	ag.EXPECT().GetKibanaHost().Return(esSrv.URL, nil).MinTimes(2)
+	ag.EXPECT().GetKibanaHost(gomock.Any()).Return(esSrv.URL, nil).MinTimes(2)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeKibanaSuccess("lama").MinTimes(1)
@@ -61,12 +61,13 @@ func TestKibanaProbeAgent_kibanaError(t *testing.T) {
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(2)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(2)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(2)
-	ag.EXPECT().GetKibanaHost().Return(esSrv.URL, nil).MinTimes(2)
+	ag.EXPECT().GetKibanaHost(gomock.Any()).Return(esSrv.URL, nil).MinTimes(2)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeKibanaFailed("lama", o11y.REASON_PROBE_KIBANA_REQUEST_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeRequestFailed("lama", o11y.PROBE_KIBANA, o11y.REASON_HTTP_5XX).MinTimes(1)
 
 	agent := KibanaProbeAgent{
 		appGroup:       ag,
@@ -91,12 +92,13 @@ func TestKibanaProbeAgent_kibanaTimeout(t *testing.T) {
 	}))
 
 	ag := mock.NewMockAppGroup(ctrl)
-	ag.EXPECT().RefreshMetadata().MinTimes(1)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(1)
 	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
-	ag.EXPECT().GetKibanaHost().Return(esSrv.URL, nil).MinTimes(1)
+	ag.EXPECT().GetKibanaHost(gomock.Any()).Return(esSrv.URL, nil).MinTimes(1)
 
 	mr := mock.NewMockMetricRecorder(ctrl)
 	mr.EXPECT().IncreaseProbeKibanaFailed("lama", o11y.REASON_PROBE_KIBANA_REQUEST_FAILED).MinTimes(1)
+	mr.EXPECT().IncreaseProbeRequestFailed("lama", o11y.PROBE_KIBANA, o11y.REASON_TIMEOUT).MinTimes(1)
 
 	agent := KibanaProbeAgent{
 		appGroup:       ag,
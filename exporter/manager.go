@@ -0,0 +1,265 @@
+package exporter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	log "github.com/sirupsen/logrus"
+)
+
+type Agent interface {
+	Run()
+}
+
+// AgentFactory creates the agents probing an app group, they must stop once
+// ctx is done.
+type AgentFactory func(appGroup appgroup.AppGroup, ctx context.Context) []Agent
+
+type runningAppGroup struct {
+	appGroup appgroup.AppGroup
+	cancel   context.CancelFunc
+	controls []*AgentControl
+	agents   sync.WaitGroup
+}
+
+// AppGroupStatus is an app group probed and the status of its agents.
+type AppGroupStatus struct {
+	ClusterName string        `json:"cluster_name"`
+	Name        string        `json:"name"`
+	Agents      []AgentStatus `json:"agents"`
+}
+
+// Manager periodically lists app groups from its source, starts agents for
+// new app groups, restarts the ones whose config changed, and stops the
+// agents of the ones that are gone, deleting their series.
+type Manager struct {
+	source         appgroup.Source
+	newAgents      AgentFactory
+	interval       time.Duration
+	ctx            context.Context
+	metricRecorder o11y.MetricRecorder
+
+	mu       sync.Mutex
+	running  map[string]*runningAppGroup
+	restored map[string]bool
+	agents   sync.WaitGroup
+}
+
+func NewManager(source appgroup.Source, newAgents AgentFactory, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *Manager {
+	return &Manager{
+		source:         source,
+		newAgents:      newAgents,
+		interval:       cfg.DiscoveryInterval,
+		ctx:            ctx,
+		metricRecorder: mR,
+		running:        map[string]*runningAppGroup{},
+	}
+}
+
+// Run returns once ctx is done and every agent has stopped.
+func (m *Manager) Run() {
+	for {
+		err := m.tick()
+		if err != nil {
+			log.Errorf("Failed to list app groups, error: %v", err)
+		}
+
+		select {
+		case <-m.ctx.Done():
+			log.Println("Exit")
+			m.stopAll()
+			m.agents.Wait()
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+// Restored tells the app groups whose series were restored from the state.
+// The ones not probed after the first reconciliation, e.g. filtered out,
+// owned by another replica or gone from BaritoMarket, get their series
+// deleted, else they would be exported, and saved again, forever.
+func (m *Manager) Restored(clusterNames []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.restored = map[string]bool{}
+	for _, name := range clusterNames {
+		m.restored[name] = true
+	}
+}
+
+// AppGroups returns the app groups currently probed.
+func (m *Manager) AppGroups() []appgroup.AppGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []appgroup.AppGroup{}
+	for _, r := range m.running {
+		result = append(result, r.appGroup)
+	}
+	return result
+}
+
+// Statuses returns the status of the app groups currently probed, by
+// cluster name.
+func (m *Manager) Statuses() []AppGroupStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []AppGroupStatus{}
+	for _, r := range m.running {
+		result = append(result, r.status())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ClusterName < result[j].ClusterName })
+	return result
+}
+
+// Controls returns the controls of the agents of an app group, false when
+// it isn't probed.
+func (m *Manager) Controls(clusterName string) ([]*AgentControl, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.running[clusterName]
+	if !ok {
+		return nil, false
+	}
+	return r.controls, true
+}
+
+func (m *Manager) Status(clusterName string) (AppGroupStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.running[clusterName]
+	if !ok {
+		return AppGroupStatus{}, false
+	}
+	return r.status(), true
+}
+
+func (r *runningAppGroup) status() AppGroupStatus {
+	status := AppGroupStatus{
+		ClusterName: r.appGroup.GetClusterName(),
+		Name:        r.appGroup.GetName(),
+		Agents:      []AgentStatus{},
+	}
+	for _, c := range r.controls {
+		status.Agents = append(status.Agents, c.Status())
+	}
+	return status
+}
+
+func (r *runningAppGroup) pausedProbes() map[string]bool {
+	result := map[string]bool{}
+	for _, c := range r.controls {
+		if c.Status().Paused {
+			result[c.Probe()] = true
+		}
+	}
+	return result
+}
+
+func (m *Manager) tick() error {
+	appGroups, err := m.source.ListAppGroups()
+	if err != nil && len(appGroups) == 0 {
+		// keep probing what we know rather than stopping everything
+		return err
+	}
+	m.reconcile(appGroups)
+	return err
+}
+
+func (m *Manager) reconcile(appGroups []appgroup.AppGroup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := map[string]appgroup.AppGroup{}
+	for _, aG := range appGroups {
+		wanted[aG.GetClusterName()] = aG
+	}
+
+	// a probe paused from the admin API stays paused across a restart
+	paused := map[string]map[string]bool{}
+	for name, r := range m.running {
+		aG, ok := wanted[name]
+		if ok && appgroup.SameConfig(aG, r.appGroup) {
+			continue
+		}
+		log.WithField(logging.FIELD_APP_GROUP, name).Info("Stop probing")
+		r.cancel()
+		delete(m.running, name)
+		if !ok {
+			m.deleteAfterStop(name, r)
+		} else {
+			paused[name] = r.pausedProbes()
+		}
+	}
+
+	for name, aG := range wanted {
+		if _, ok := m.running[name]; ok {
+			continue
+		}
+		log.WithField(logging.FIELD_APP_GROUP, name).Info("Start probing")
+		ctx, cancel := context.WithCancel(m.ctx)
+		r := &runningAppGroup{appGroup: aG, cancel: cancel}
+		for _, agent := range m.newAgents(aG, ctx) {
+			if controlled, ok := agent.(ControlledAgent); ok {
+				control := controlled.Control()
+				if paused[name][control.Probe()] {
+					control.Pause()
+				}
+				r.controls = append(r.controls, control)
+			}
+			m.agents.Add(1)
+			r.agents.Add(1)
+			go func(agent Agent) {
+				defer m.agents.Done()
+				defer r.agents.Done()
+				agent.Run()
+			}(agent)
+		}
+		m.running[name] = r
+	}
+
+	for name := range m.restored {
+		if _, ok := m.running[name]; !ok {
+			m.metricRecorder.DeleteAppGroup(name)
+		}
+	}
+	m.restored = nil
+}
+
+// deleteAfterStop deletes the series of a removed app group once its agents
+// stopped, as they may be in the middle of a run recreating them. It's left
+// alone if the app group came back meanwhile.
+func (m *Manager) deleteAfterStop(name string, r *runningAppGroup) {
+	m.agents.Add(1)
+	go func() {
+		defer m.agents.Done()
+		r.agents.Wait()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.running[name]; !ok {
+			m.metricRecorder.DeleteAppGroup(name)
+		}
+	}()
+}
+
+func (m *Manager) stopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, r := range m.running {
+		r.cancel()
+		delete(m.running, name)
+	}
+}
@@ -0,0 +1,278 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+type fakeSource struct {
+	appGroups []appgroup.AppGroup
+	err       error
+}
+
+func (f *fakeSource) ListAppGroups() ([]appgroup.AppGroup, error) {
+	return f.appGroups, f.err
+}
+
+type fakeAgent struct {
+	ctx  context.Context
+	done *sync.WaitGroup
+}
+
+func (f *fakeAgent) Run() {
+	<-f.ctx.Done()
+	f.done.Done()
+}
+
+type agentFunc func()
+
+func (f agentFunc) Run() {
+	f()
+}
+
+func runningNames(m *Manager) []string {
+	names := []string{}
+	for _, aG := range m.AppGroups() {
+		names = append(names, aG.GetClusterName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestManager_reconcile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().DeleteAppGroup("unta")
+
+	cfg := &config.Config{}
+	source := &fakeSource{appGroups: []appgroup.AppGroup{
+		appgroup.NewAppGroup("lama", "ABC", cfg, nil),
+		appgroup.NewAppGroup("unta", "DEF", cfg, nil),
+	}}
+
+	started := map[string]int{}
+	stopped := &sync.WaitGroup{}
+	m := NewManager(source, func(aG appgroup.AppGroup, ctx context.Context) []Agent {
+		started[aG.GetClusterName()]++
+		stopped.Add(1)
+		return []Agent{&fakeAgent{ctx: ctx, done: stopped}}
+	}, context.Background(), cfg, mr)
+
+	m.tick()
+	if names := runningNames(m); len(names) != 2 {
+		t.Fatalf("Should run 2 app groups, got: %v", names)
+	}
+
+	// unta removed, lama's secret rotated, kuda added
+	source.appGroups = []appgroup.AppGroup{
+		appgroup.NewAppGroup("lama", "XYZ", cfg, nil),
+		appgroup.NewAppGroup("kuda", "GHI", cfg, nil),
+	}
+	m.tick()
+	if names := runningNames(m); len(names) != 2 || names[0] != "kuda" || names[1] != "lama" {
+		t.Fatalf("Should run kuda & lama, got: %v", names)
+	}
+	if started["lama"] != 2 || started["unta"] != 1 || started["kuda"] != 1 {
+		t.Errorf("Should restart lama & start kuda once, got: %v", started)
+	}
+
+	// kuda's static ES changed
+	source.appGroups = []appgroup.AppGroup{
+		appgroup.NewAppGroup("lama", "XYZ", cfg, nil),
+		appgroup.NewStaticAppGroup("kuda", "GHI", appgroup.Endpoints{Elasticsearch: []string{"es-01:9200"}}, cfg, nil),
+	}
+	m.tick()
+	if started["lama"] != 2 || started["kuda"] != 2 {
+		t.Errorf("Should restart kuda only, got: %v", started)
+	}
+
+	// a failing source keeps the current app groups
+	source.appGroups = nil
+	source.err = errors.New("market is down")
+	if err := m.tick(); err == nil {
+		t.Errorf("Should return source error")
+	}
+	if names := runningNames(m); len(names) != 2 {
+		t.Fatalf("Should keep running app groups when source fails, got: %v", names)
+	}
+
+	m.stopAll()
+	m.agents.Wait()
+}
+
+func TestManager_deleteAfterAgentsStop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	deleted := make(chan struct{})
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().DeleteAppGroup("unta").Do(func(appGroup string) { close(deleted) })
+
+	cfg := &config.Config{}
+	source := &fakeSource{appGroups: []appgroup.AppGroup{appgroup.NewAppGroup("unta", "DEF", cfg, nil)}}
+	// the agent is mid-tick, it finishes its run after being cancelled
+	midTick := make(chan struct{})
+	m := NewManager(source, func(aG appgroup.AppGroup, ctx context.Context) []Agent {
+		return []Agent{agentFunc(func() {
+			<-ctx.Done()
+			<-midTick
+		})}
+	}, context.Background(), cfg, mr)
+
+	m.tick()
+	source.appGroups = nil
+	m.tick()
+
+	select {
+	case <-deleted:
+		t.Fatalf("Should not delete the series while the agent is running")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(midTick)
+	select {
+	case <-deleted:
+	case <-time.After(time.Second):
+		t.Fatalf("Should delete the series once the agent stopped")
+	}
+	m.agents.Wait()
+}
+
+func TestManager_restored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// unta is still saved, but not probed anymore
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().DeleteAppGroup("unta")
+
+	cfg := &config.Config{}
+	source := &fakeSource{err: errors.New("market is down")}
+	stopped := &sync.WaitGroup{}
+	m := NewManager(source, func(aG appgroup.AppGroup, ctx context.Context) []Agent {
+		stopped.Add(1)
+		return []Agent{&fakeAgent{ctx: ctx, done: stopped}}
+	}, context.Background(), cfg, mr)
+	m.Restored([]string{"lama", "unta"})
+
+	// nothing listed yet, the restored series are kept
+	m.tick()
+
+	source.appGroups = []appgroup.AppGroup{appgroup.NewAppGroup("lama", "ABC", cfg, nil)}
+	source.err = nil
+	m.tick()
+	// only on the first reconciliation
+	m.tick()
+
+	m.stopAll()
+	stopped.Wait()
+}
+
+type fakeControlledAgent struct {
+	fakeAgent
+	control *AgentControl
+}
+
+func (f *fakeControlledAgent) Control() *AgentControl {
+	return f.control
+}
+
+func TestManager_controls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	gomock.InOrder(
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, false),
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, true),
+		// restarted, then paused again
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, false),
+		mr.EXPECT().SetProbePaused("lama", o11y.PROBE_PUSH, true),
+	)
+
+	cfg := &config.Config{}
+	source := &fakeSource{appGroups: []appgroup.AppGroup{appgroup.NewAppGroup("lama", "ABC", cfg, nil)}}
+	stopped := &sync.WaitGroup{}
+	m := NewManager(source, func(aG appgroup.AppGroup, ctx context.Context) []Agent {
+		stopped.Add(2)
+		return []Agent{
+			&fakeControlledAgent{fakeAgent{ctx: ctx, done: stopped}, NewAgentControl(aG.GetClusterName(), o11y.PROBE_PUSH, mr)},
+			&fakeAgent{ctx: ctx, done: stopped},
+		}
+	}, context.Background(), cfg, mr)
+	m.tick()
+
+	controls, ok := m.Controls("lama")
+	if !ok || len(controls) != 1 {
+		t.Fatalf("Should keep the control of the controlled agent, got: %v", controls)
+	}
+	if _, ok := m.Controls("unta"); ok {
+		t.Errorf("Should not find unknown app group")
+	}
+
+	controls[0].Pause()
+	statuses := m.Statuses()
+	if len(statuses) != 1 || statuses[0].ClusterName != "lama" || len(statuses[0].Agents) != 1 || !statuses[0].Agents[0].Paused {
+		t.Errorf("Should report lama's paused push agent, got: %+v", statuses)
+	}
+
+	// lama's secret rotated
+	source.appGroups = []appgroup.AppGroup{appgroup.NewAppGroup("lama", "XYZ", cfg, nil)}
+	m.tick()
+	if controls, _ := m.Controls("lama"); len(controls) != 1 || !controls[0].Status().Paused {
+		t.Errorf("Should keep lama's push agent paused across the restart, got: %+v", m.Statuses())
+	}
+
+	m.stopAll()
+	stopped.Wait()
+}
+
+func TestManager_Run(t *testing.T) {
+	cfg := &config.Config{DiscoveryInterval: time.Hour}
+	source := &fakeSource{appGroups: []appgroup.AppGroup{appgroup.NewAppGroup("lama", "ABC", cfg, nil)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := &sync.WaitGroup{}
+	m := NewManager(source, func(aG appgroup.AppGroup, ctx context.Context) []Agent {
+		stopped.Add(1)
+		return []Agent{&fakeAgent{ctx: ctx, done: stopped}}
+	}, ctx, cfg, nil)
+
+	done := make(chan struct{})
+	go func() {
+		m.Run()
+		close(done)
+	}()
+	for len(m.AppGroups()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Should return once ctx is done, without waiting for the next discovery")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		stopped.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("Should return after every agent has stopped")
+	}
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+type MetadataAgent struct {
+	appGroup       appgroup.AppGroup
+	interval       time.Duration
+	control        *AgentControl
+	metricRecorder o11y.MetricRecorder
+	ctx            context.Context
+}
+
+func NewMetadataAgent(appGroup appgroup.AppGroup, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *MetadataAgent {
+	return &MetadataAgent{
+		appGroup:       appGroup,
+		interval:       cfg.MetadataInterval,
+		control:        NewAgentControl(appGroup.GetClusterName(), o11y.PROBE_METADATA, mR),
+		metricRecorder: mR,
+		ctx:            ctx,
+	}
+}
+
+func (m *MetadataAgent) Control() *AgentControl {
+	return m.control
+}
+
+func (m *MetadataAgent) Run() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			m.logger().Info("Exit")
+			return
+		default:
+			if m.control.ShouldRun() {
+				start := time.Now()
+				ctx, span := tracing.Start(context.Background(), "metadata")
+				span.SetAttribute("app_group", m.appGroup.GetClusterName())
+				err := m.tick(ctx)
+				span.End(err)
+				m.control.Record(start, err)
+				if err != nil {
+					m.logger().WithFields(logging.Since(start)).WithError(err).Error("Failed to refresh metadata")
+				}
+			}
+			m.control.Sleep(m.ctx, m.interval)
+		}
+	}
+}
+
+func (m *MetadataAgent) logger() *log.Entry {
+	return logging.For(m.appGroup.GetClusterName(), o11y.PROBE_METADATA)
+}
+
+func (m *MetadataAgent) tick(ctx context.Context) error {
+	err := m.appGroup.RefreshMetadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.metricRecorder.SetAppGroupInfo(m.appGroup.GetClusterName(), o11y.AppGroupInfo{
+		Name:        m.appGroup.GetName(),
+		Capacity:    m.appGroup.GetCapacity(),
+		Status:      m.appGroup.GetStatus(),
+		Retention:   strconv.Itoa(m.appGroup.GetLogRetentionDays()),
+		Environment: m.appGroup.GetEnvironment(),
+	})
+
+	m.metricRecorder.SetAppGroupTPS(m.appGroup.GetClusterName(), m.appGroup.GetTPS(), m.appGroup.GetMaxTPS())
+	apps := []o11y.AppTPS{}
+	for _, app := range m.appGroup.GetApps() {
+		apps = append(apps, o11y.AppTPS{Name: app.Name, TPS: app.TPS, MaxTPS: app.MaxTPS})
+	}
+	m.metricRecorder.SetAppsTPS(m.appGroup.GetClusterName(), apps)
+	return nil
+}
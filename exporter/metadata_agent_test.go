@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+func TestMetadataAgent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).MinTimes(2)
+	ag.EXPECT().GetClusterName().Return("lama").MinTimes(2)
+	ag.EXPECT().GetName().Return("Lama").MinTimes(2)
+	ag.EXPECT().GetCapacity().Return("small").MinTimes(2)
+	ag.EXPECT().GetStatus().Return("ACTIVE").MinTimes(2)
+	ag.EXPECT().GetLogRetentionDays().Return(14).MinTimes(2)
+	ag.EXPECT().GetEnvironment().Return("production").MinTimes(2)
+	ag.EXPECT().GetTPS().Return(float64(50)).MinTimes(2)
+	ag.EXPECT().GetMaxTPS().Return(float64(100)).MinTimes(2)
+	ag.EXPECT().GetApps().Return([]appgroup.App{{Name: "app-1", TPS: 50, MaxTPS: 100}}).MinTimes(2)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().SetAppGroupInfo("lama", o11y.AppGroupInfo{
+		Name:        "Lama",
+		Capacity:    "small",
+		Status:      "ACTIVE",
+		Retention:   "14",
+		Environment: "production",
+	}).MinTimes(2)
+	mr.EXPECT().SetAppGroupTPS("lama", float64(50), float64(100)).MinTimes(2)
+	mr.EXPECT().SetAppsTPS("lama", []o11y.AppTPS{{Name: "app-1", TPS: 50, MaxTPS: 100}}).MinTimes(2)
+
+	agent := MetadataAgent{
+		appGroup:       ag,
+		interval:       1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+}
+
+func TestMetadataAgent_failedRefreshShouldNotRecordInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().RefreshMetadata(gomock.Any()).Return(errors.New("err")).MinTimes(1)
+	ag.EXPECT().GetClusterName().Return("lama").MinTimes(1)
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+
+	agent := MetadataAgent{
+		appGroup:       ag,
+		interval:       1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+}
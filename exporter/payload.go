@@ -0,0 +1,145 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+)
+
+const PADDING_FIELD = "barito_padding"
+
+// PayloadData is what templated fields are rendered with, e.g.
+// "{{.Environment}}" or `{{index .Labels "team"}}`.
+type PayloadData struct {
+	ClusterName string
+	Name        string
+	Environment string
+	Status      string
+	Capacity    string
+	Labels      map[string]string
+}
+
+func newPayloadData(aG appgroup.AppGroup) PayloadData {
+	return PayloadData{
+		ClusterName: aG.GetClusterName(),
+		Name:        aG.GetName(),
+		Environment: aG.GetEnvironment(),
+		Status:      aG.GetStatus(),
+		Capacity:    aG.GetCapacity(),
+		Labels:      aG.GetLabels(),
+	}
+}
+
+// Payload builds the body pushed to the router: batchSize items, each one
+// with the time field, the static and templated fields, and padded up to
+// messageSize bytes when set, so the router is exercised like by real
+// clients. With integrity, items also carry the typed fields and the
+// checksum the ES probe verifies.
+type Payload struct {
+	timeField      string
+	batchSize      int
+	messageSize    int
+	staticFields   map[string]string
+	templateFields map[string]*template.Template
+	integrity      bool
+}
+
+func NewPayload(cfg *config.Config) (*Payload, error) {
+	templateFields := map[string]*template.Template{}
+	for k, v := range cfg.ProduceTemplateFields {
+		t, err := template.New(k).Option("missingkey=zero").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid template of field %q: %v", k, err)
+		}
+		templateFields[k] = t
+	}
+
+	return &Payload{
+		timeField:      cfg.ProduceTimeField,
+		batchSize:      cfg.ProduceBatchSize,
+		messageSize:    cfg.ProduceMessageSize,
+		staticFields:   cfg.ProduceStaticFields,
+		templateFields: templateFields,
+		integrity:      cfg.IntegrityCheckEnabled,
+	}, nil
+}
+
+// BatchSize is the number of items in the body of produce_batch.
+func (p *Payload) BatchSize() int {
+	if p.batchSize < 1 {
+		return 1
+	}
+	return p.batchSize
+}
+
+// Build returns the body of produce_batch, the items under "items". Items
+// are numbered from seq, unless it's 0.
+func (p *Payload) Build(data PayloadData, now time.Time, seq int64) ([]byte, error) {
+	items := make([]map[string]interface{}, p.BatchSize())
+	for i := range items {
+		itemSeq := seq
+		if seq != 0 {
+			itemSeq += int64(i)
+		}
+		item, err := p.item(data, now, itemSeq)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return json.Marshal(map[string]interface{}{"items": items})
+}
+
+// BuildSingle returns the body of produce, a single item numbered seq,
+// unless it's 0.
+func (p *Payload) BuildSingle(data PayloadData, now time.Time, seq int64) ([]byte, error) {
+	item, err := p.item(data, now, seq)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(item)
+}
+
+func (p *Payload) item(data PayloadData, now time.Time, seq int64) (map[string]interface{}, error) {
+	item := map[string]interface{}{}
+	for k, v := range p.staticFields {
+		item[k] = v
+	}
+	for k, t := range p.templateFields {
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("Failed to render field %q: %v", k, err)
+		}
+		item[k] = b.String()
+	}
+	// the ES probe relies on it, it can't be overridden
+	item[p.timeField] = now.UnixNano() / 1000000
+	if seq != 0 {
+		item[SEQUENCE_FIELD] = seq
+	}
+
+	if p.integrity {
+		if err := addIntegrity(item); err != nil {
+			return nil, err
+		}
+	}
+
+	// the padding is left out of the checksum
+	if p.messageSize > 0 {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		// account for `,"barito_padding":""`
+		if n := p.messageSize - len(b) - len(PADDING_FIELD) - 6; n > 0 {
+			item[PADDING_FIELD] = strings.Repeat("x", n)
+		}
+	}
+	return item, nil
+}
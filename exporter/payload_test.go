@@ -0,0 +1,88 @@
+package exporter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+)
+
+func TestPayload_Build(t *testing.T) {
+	payload, err := NewPayload(&config.Config{
+		ProduceTimeField:      "barito_trace_time",
+		ProduceBatchSize:      3,
+		ProduceMessageSize:    200,
+		ProduceStaticFields:   map[string]string{"source": "prober", "barito_trace_time": "overridden"},
+		ProduceTemplateFields: map[string]string{"cluster": "{{.ClusterName}}", "team": `{{index .Labels "team"}}`},
+	})
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+
+	body, err := payload.Build(PayloadData{ClusterName: "lama", Labels: map[string]string{"team": "platform"}}, time.Unix(1600000000, 0), 0)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+
+	var parsed struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		t.Fatalf("Should build a valid json, got: %q", string(body))
+	}
+	if len(parsed.Items) != 3 {
+		t.Fatalf("Should build 3 items, got: %d", len(parsed.Items))
+	}
+	if len(parsed.Items[0]) != 200 {
+		t.Errorf("Should pad item to 200 bytes, got: %d", len(parsed.Items[0]))
+	}
+
+	var item map[string]interface{}
+	json.Unmarshal(parsed.Items[0], &item)
+	expected := map[string]interface{}{
+		"source":            "prober",
+		"cluster":           "lama",
+		"team":              "platform",
+		"barito_trace_time": float64(1600000000000),
+	}
+	for k, v := range expected {
+		if item[k] != v {
+			t.Errorf("Item should have %q: %v, got: %v", k, v, item[k])
+		}
+	}
+}
+
+func TestPayload_defaultIsSingleItem(t *testing.T) {
+	payload, _ := NewPayload(&config.Config{ProduceTimeField: "barito_trace_time"})
+	body, _ := payload.Build(PayloadData{}, time.Unix(1600000000, 0), 0)
+
+	if string(body) != `{"items":[{"barito_trace_time":1600000000000}]}` {
+		t.Errorf("Should build a single item with the time field, got: %s", body)
+	}
+}
+
+func TestPayload_sequence(t *testing.T) {
+	payload, _ := NewPayload(&config.Config{ProduceTimeField: "barito_trace_time", ProduceBatchSize: 3})
+
+	body, _ := payload.Build(PayloadData{}, time.Unix(1600000000, 0), 7)
+	expected := `{"items":[` +
+		`{"barito_probe_seq":7,"barito_trace_time":1600000000000},` +
+		`{"barito_probe_seq":8,"barito_trace_time":1600000000000},` +
+		`{"barito_probe_seq":9,"barito_trace_time":1600000000000}]}`
+	if string(body) != expected {
+		t.Errorf("Should number items from the sequence, got: %s", body)
+	}
+
+	body, _ = payload.BuildSingle(PayloadData{}, time.Unix(1600000000, 0), 7)
+	if string(body) != `{"barito_probe_seq":7,"barito_trace_time":1600000000000}` {
+		t.Errorf("Should number the item, got: %s", body)
+	}
+}
+
+func TestNewPayload_invalidTemplate(t *testing.T) {
+	_, err := NewPayload(&config.Config{ProduceTemplateFields: map[string]string{"env": "{{.Environment"}})
+	if err == nil {
+		t.Errorf("Should return error on invalid template")
+	}
+}
@@ -0,0 +1,39 @@
+package exporter
+
+import "sync"
+
+// ProbeLogTimes keeps the time, in millisecond, of the latest probe log the
+// ES probe found for each app group. It's saved along the state so that,
+// after a restart, the delay keeps growing while no probe log is found
+// within the lookback. A nil ProbeLogTimes keeps nothing.
+type ProbeLogTimes struct {
+	mu    sync.Mutex
+	times map[string]int64
+}
+
+func NewProbeLogTimes(saved map[string]int64) *ProbeLogTimes {
+	times := map[string]int64{}
+	for k, v := range saved {
+		times[k] = v
+	}
+	return &ProbeLogTimes{times: times}
+}
+
+// Get returns 0 when no probe log was found yet.
+func (p *ProbeLogTimes) Get(appGroup string) int64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.times[appGroup]
+}
+
+func (p *ProbeLogTimes) Set(appGroup string, dataTime int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.times[appGroup] = dataTime
+}
@@ -1,87 +1,374 @@
 package exporter
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"strings"
+	"net/http/httptrace"
+	"net/url"
 	"time"
 
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
 	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
 	log "github.com/sirupsen/logrus"
 )
 
+// maxRouterResponseSize bounds how much of the router response is read, it
+// is expected to be a small JSON object.
+const maxRouterResponseSize = 1 << 20
+
 type PushAgent struct {
-	appGroup       string
 	secretKey      string
+	group          appgroup.AppGroup
+	payload        *Payload
 	appPrefix      string
-	produceURL     string
+	routers        RouterSource
+	sequences      *Sequences
+	marketRouter   bool
+	batchPath      string
+	singlePath     string
+	modes          []string
 	timeField      string
 	interval       time.Duration
 	requestTimeout time.Duration
+	retryPolicy    retry.Policy
+	upstreams      *retry.Upstreams
+	control        *AgentControl
 	ctx            context.Context
 	metricRecorder o11y.MetricRecorder
 }
 
-func NewPushAgent(code, secret string, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *PushAgent {
+func NewPushAgent(appGroup appgroup.AppGroup, payload *Payload, routers RouterSource, sequences *Sequences, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *PushAgent {
 	return &PushAgent{
-		appGroup:       code,
-		secretKey:      secret,
+		secretKey:      appGroup.GetSecret(),
+		group:          appGroup,
+		payload:        payload,
 		appPrefix:      cfg.ProduceAppPrefix,
-		produceURL:     cfg.ProduceURL,
+		routers:        routers,
+		sequences:      sequences,
+		marketRouter:   cfg.ProduceRouterFromMarket,
+		batchPath:      cfg.ProduceBatchPath,
+		singlePath:     cfg.ProduceSinglePath,
+		modes:          cfg.ProduceModes,
 		interval:       cfg.ProduceInterval,
 		requestTimeout: cfg.ProduceTimeout,
 		timeField:      cfg.ProduceTimeField,
+		retryPolicy:    retry.NewPolicy(cfg.ProduceRetries, cfg.ProduceRetryBackoff, cfg.ProduceRetryStatusCodes),
+		upstreams:      upstreams,
+		control:        NewAgentControl(appGroup.GetClusterName(), o11y.PROBE_PUSH, mR),
 		ctx:            ctx,
 		metricRecorder: mR,
 	}
 }
 
+func (p *PushAgent) Control() *AgentControl {
+	return p.control
+}
+
+// ValidatePushModes rejects modes other than batch, batch_gzip, single and
+// single_gzip.
+func ValidatePushModes(modes []string) error {
+	for _, mode := range modes {
+		switch mode {
+		case o11y.PUSH_MODE_BATCH, o11y.PUSH_MODE_BATCH_GZIP, o11y.PUSH_MODE_SINGLE, o11y.PUSH_MODE_SINGLE_GZIP:
+		default:
+			return fmt.Errorf("Unknown push mode %q", mode)
+		}
+	}
+	return nil
+}
+
 func (p *PushAgent) Run() {
+	modes := p.modes
+	if len(modes) == 0 {
+		modes = []string{o11y.PUSH_MODE_BATCH}
+	}
+
 	for {
 		select {
 		case <-p.ctx.Done():
-			log.Println("Exit")
+			p.logger().Info("Exit")
 			return
 		default:
-			err := p.doRequest()
-			if err == nil {
-				log.Debugf("Requests success, appGroup: %q, appPrefix: %q, URL: %q", p.appGroup, p.appPrefix, p.produceURL)
-				p.metricRecorder.IncreasePushLogSuccess(p.appGroup)
-			} else {
-				log.Debugf("Requests failed, appGroup: %q, appPrefix: %q, URL: %q", p.appGroup, p.appPrefix, p.produceURL)
-				p.metricRecorder.IncreasePushLogFailed(p.appGroup)
+			if p.control.ShouldRun() {
+				p.pushAll(modes)
 			}
-			time.Sleep(p.interval)
+			p.control.Sleep(p.ctx, p.interval)
+		}
+	}
+}
+
+// pushAll pushes to every router in every mode, the run failing with the
+// first error.
+func (p *PushAgent) pushAll(modes []string) {
+	start := time.Now()
+	// requests aren't bound to p.ctx, a push is never cut short
+	ctx, span := tracing.Start(context.Background(), "push")
+	span.SetAttribute("app_group", p.group.GetClusterName())
+
+	var err error
+	routers := p.targets(ctx)
+	endpoints := []string{}
+	for _, router := range routers {
+		endpoints = append(endpoints, router.Name)
+		for _, mode := range modes {
+			if pushErr := p.push(ctx, router, mode); err == nil {
+				err = pushErr
+			}
+		}
+	}
+	span.End(err)
+	p.control.RecordEndpoints(endpoints)
+	p.control.Record(start, err)
+}
+
+func (p *PushAgent) logger() *log.Entry {
+	return logging.For(p.group.GetClusterName(), o11y.PROBE_PUSH)
+}
+
+// targets prefers the router advertised by BaritoMarket for the app group,
+// when enabled.
+func (p *PushAgent) targets(ctx context.Context) []Router {
+	if p.marketRouter {
+		if routerURL := p.group.GetRouterURL(); routerURL != "" {
+			return []Router{NewRouter("", routerURL, p.batchPath, p.singlePath)}
 		}
 	}
+	return p.routers.Routers(ctx)
 }
 
-func (p *PushAgent) doRequest() error {
-	log.Debugf("Do requests, appGroup: %q, appPrefix: %q, URL: %q", p.appGroup, p.appPrefix, p.produceURL)
+// push numbers the logs when the agent has sequences. Retries send the same
+// numbers, so they're only done when the router can't have accepted the
+// logs, else a router timing out after accepting them would look like the
+// pipeline duplicating logs. The numbers are given back when the logs were
+// definitely not accepted, and abandoned when they may have been.
+func (p *PushAgent) push(ctx context.Context, router Router, mode string) error {
+	appGroup := p.group.GetClusterName()
+	url, count := router.BatchURL, p.batchSize()
+	if isSingleMode(mode) {
+		url, count = router.SingleURL, 1
+	}
+
+	var seq int64
+	if p.sequences != nil {
+		seq = p.sequences.Reserve(appGroup, count)
+	}
+
+	policy := p.retryPolicy
+	if p.sequences != nil {
+		policy.Only = isDefinitelyRejected
+	}
+
+	start := time.Now()
+	body, err := p.body(mode, seq)
+	sent := err == nil
+	if sent {
+		err = p.upstreams.For(o11y.UPSTREAM_ROUTER).Do(routerBreakerKey(appGroup, url), policy, func() error {
+			return p.doRequest(ctx, router.Name, mode, url, body)
+		})
+	}
+	if p.sequences != nil {
+		switch {
+		case !sent || isDefinitelyRejected(err):
+			p.sequences.Rewind(appGroup, seq, count)
+		case err != nil:
+			p.sequences.Abandon(appGroup, seq, count)
+		default:
+			p.sequences.Settle(appGroup, seq)
+		}
+	}
+
+	logger := p.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: url, logging.FIELD_ROUTER: router.Name, logging.FIELD_MODE: mode}).WithFields(logging.Since(start))
+	if err == nil {
+		logger.Debug("Requests success")
+		p.metricRecorder.IncreasePushLogSuccess(appGroup, router.Name, mode)
+	} else {
+		reason := classifyError(err)
+		logger.WithField(logging.FIELD_REASON, reason).WithError(err).Debug("Requests failed")
+		p.metricRecorder.IncreasePushLogFailed(appGroup, router.Name, mode, reason)
+	}
+	return err
+}
+
+// doRequest sends the traceparent of the push span, so the router can link
+// its spans to it.
+func (p *PushAgent) doRequest(ctx context.Context, router, mode, url string, body []byte) error {
+	p.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: url, logging.FIELD_MODE: mode}).Debug("Do requests")
 	var c = &http.Client{
-		Timeout: p.requestTimeout,
+		Timeout:   p.requestTimeout,
+		Transport: tracing.NewTransport(nil),
 	}
 
-	body := fmt.Sprintf(`{"items": [{"%s": %d}] }`, p.timeField, time.Now().UnixNano()/1000000)
-	req, err := http.NewRequest("POST", p.produceURL, strings.NewReader(body))
+	var err error
+	gzipped := mode == o11y.PUSH_MODE_BATCH_GZIP || mode == o11y.PUSH_MODE_SINGLE_GZIP
+	if gzipped {
+		if body, err = gzipBody(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
 	if err != nil {
 		return errors.New("failed to create request")
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	req.Header.Set("X-App-Group-Secret", p.secretKey)
-	req.Header.Set("X-App-Name", p.appPrefix+"-"+p.appGroup)
+	req.Header.Set("X-App-Name", p.appPrefix+"-"+p.group.GetClusterName())
+
+	start := time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			p.metricRecorder.ObservePushLogTTFB(p.group.GetClusterName(), router, mode, time.Since(start).Seconds())
+		},
+	}))
 	resp, err := c.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
+	p.metricRecorder.IncreasePushLogResponse(p.group.GetClusterName(), router, mode, resp.StatusCode)
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("Got response status %d", resp.StatusCode)
-		log.Debugf("Requests got status: %d, appGroup: %q, appPrefix: %q, URL: %q", resp.StatusCode, p.appGroup, p.appPrefix, p.produceURL)
+		p.logger().WithFields(log.Fields{logging.FIELD_ENDPOINT: url, logging.FIELD_MODE: mode}).WithFields(logging.Since(start)).Debugf("Requests got status: %d", resp.StatusCode)
+		return &retry.StatusError{StatusCode: resp.StatusCode}
 	}
 
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRouterResponseSize))
+	if err != nil {
+		return err
+	}
+	warnings, err := parseRouterResponse(respBody)
+	if warnings > 0 {
+		p.logger().WithField(logging.FIELD_ENDPOINT, url).Debugf("Router accepted with %d warning, body: %s", warnings, respBody)
+		p.metricRecorder.IncreasePushLogWarning(p.group.GetClusterName(), router, mode, warnings)
+	}
 	return err
 }
+
+func (p *PushAgent) batchSize() int {
+	if p.payload == nil {
+		return 1
+	}
+	return p.payload.BatchSize()
+}
+
+func isSingleMode(mode string) bool {
+	return mode == o11y.PUSH_MODE_SINGLE || mode == o11y.PUSH_MODE_SINGLE_GZIP
+}
+
+// routerBreakerKey keys the router breakers by app group and host, every app
+// group sharing the same produce URL while the router may reject only some of
+// them.
+func routerBreakerKey(appGroup, rawURL string) string {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return appGroup + "/" + host
+}
+
+// body falls back to a single item with only the time field when the agent
+// has no payload.
+func (p *PushAgent) body(mode string, seq int64) ([]byte, error) {
+	payload := p.payload
+	if payload == nil {
+		payload = &Payload{timeField: p.timeField}
+	}
+
+	data := newPayloadData(p.group)
+	if isSingleMode(mode) {
+		return payload.BuildSingle(data, time.Now(), seq)
+	}
+	return payload.Build(data, time.Now(), seq)
+}
+
+// isDefinitelyRejected tells whether the logs of a failed push can't have
+// reached ES: never sent, or refused as a whole by the router, e.g. with a
+// 503. A timeout or another 5xx may come after the router accepted them.
+func isDefinitelyRejected(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rErr *rejectedError
+	if errors.As(err, &rErr) {
+		return !rErr.partial
+	}
+	var sErr *retry.StatusError
+	if errors.As(err, &sErr) && sErr.StatusCode == http.StatusServiceUnavailable {
+		return true
+	}
+
+	switch classifyError(err) {
+	case o11y.REASON_CIRCUIT_OPEN, o11y.REASON_DNS, o11y.REASON_CONNECT_REFUSED, o11y.REASON_TLS,
+		o11y.REASON_AUTH, o11y.REASON_RATE_LIMITED, o11y.REASON_HTTP_4XX:
+		return true
+	}
+	return false
+}
+
+// rejectedError is partial when the router may have accepted some of the
+// logs.
+type rejectedError struct {
+	reason  string
+	partial bool
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("Router rejected the logs: %s", e.reason)
+}
+
+// parseRouterResponse tells whether the router, despite responding 200,
+// rejected some of the logs through "error", "errors" or a non zero
+// "rejected", and returns the number of "warnings". An empty body is
+// accepted, a body which isn't a JSON object is not.
+func parseRouterResponse(body []byte) (int, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return 0, nil
+	}
+
+	var resp struct {
+		Error    string            `json:"error"`
+		Errors   []json.RawMessage `json:"errors"`
+		Rejected int               `json:"rejected"`
+		Warnings []json.RawMessage `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case resp.Error != "":
+		return len(resp.Warnings), &rejectedError{reason: resp.Error}
+	case len(resp.Errors) > 0:
+		return len(resp.Warnings), &rejectedError{reason: string(resp.Errors[0]), partial: true}
+	case resp.Rejected > 0:
+		return len(resp.Warnings), &rejectedError{reason: fmt.Sprintf("%d rejected", resp.Rejected), partial: true}
+	}
+	return len(resp.Warnings), nil
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -1,20 +1,31 @@
 package exporter
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
 	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
 	"github.com/golang/mock/gomock"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LogBody struct {
-	Items []map[string]string `json: items`
+	Items []map[string]string `json:"items"`
 }
 
 func TestPushAgent(t *testing.T) {
@@ -55,13 +66,15 @@ func TestPushAgent(t *testing.T) {
 	defer cancel()
 
 	mr := mock.NewMockMetricRecorder(ctrl)
-	mr.EXPECT().IncreasePushLogSuccess("lama").MinTimes(2)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 200).MinTimes(2)
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any()).MinTimes(2)
+	mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH).MinTimes(2)
 
 	agent := PushAgent{
-		appGroup:       "lama",
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
 		secretKey:      "ABC123",
 		appPrefix:      "barito-log-probe",
-		produceURL:     srv.URL,
+		routers:        StaticRouters{{Name: "router-a", BatchURL: srv.URL}},
 		interval:       1 * time.Second,
 		timeField:      "barito_trace_time",
 		metricRecorder: mr,
@@ -92,13 +105,19 @@ func TestPushAgent_non200ShouldMarkedAsFailed(t *testing.T) {
 	defer cancel()
 
 	mr := mock.NewMockMetricRecorder(ctrl)
-	mr.EXPECT().IncreasePushLogFailed("lama").Times(2)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 502)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 404)
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any()).Times(2)
+	gomock.InOrder(
+		mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_HTTP_5XX),
+		mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_HTTP_4XX),
+	)
 
 	agent := PushAgent{
-		appGroup:       "lama",
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
 		secretKey:      "ABC123",
 		appPrefix:      "barito-log-probe",
-		produceURL:     srv.URL,
+		routers:        StaticRouters{{Name: "router-a", BatchURL: srv.URL}},
 		timeField:      "barito_trace_time",
 		interval:       1 * time.Second,
 		metricRecorder: mr,
@@ -121,13 +140,13 @@ func TestPushAgent_TimeoutShouldMarkedAsFailed(t *testing.T) {
 	defer cancel()
 
 	mr := mock.NewMockMetricRecorder(ctrl)
-	mr.EXPECT().IncreasePushLogFailed("lama").Times(2)
+	mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_TIMEOUT).Times(2)
 
 	agent := PushAgent{
-		appGroup:       "lama",
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
 		secretKey:      "ABC123",
 		appPrefix:      "barito-log-probe",
-		produceURL:     srv.URL,
+		routers:        StaticRouters{{Name: "router-a", BatchURL: srv.URL}},
 		interval:       1 * time.Second,
 		timeField:      "barito_trace_time",
 		metricRecorder: mr,
@@ -138,3 +157,314 @@ func TestPushAgent_TimeoutShouldMarkedAsFailed(t *testing.T) {
 
 	agent.Run()
 }
+
+func TestPushAgent_modes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	requests := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatalf("Request body should be gzipped, got error: %v", err)
+			}
+			body = gz
+		}
+		b, _ := ioutil.ReadAll(body)
+		requests[r.URL.Path+" "+r.Header.Get("Content-Encoding")] = string(b)
+		if r.URL.Path == "/produce" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", gomock.Any(), gomock.Any()).AnyTimes()
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", gomock.Any(), gomock.Any()).AnyTimes()
+	mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH_GZIP)
+	mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_SINGLE, o11y.REASON_HTTP_4XX)
+
+	agent := PushAgent{
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
+		secretKey:      "ABC123",
+		appPrefix:      "barito-log-probe",
+		routers:        StaticRouters{NewRouter("router-a", srv.URL, "/produce_batch", "/produce")},
+		modes:          []string{o11y.PUSH_MODE_BATCH_GZIP, o11y.PUSH_MODE_SINGLE},
+		timeField:      "barito_trace_time",
+		interval:       1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+
+	var batch LogBody
+	json.Unmarshal([]byte(requests["/produce_batch gzip"]), &batch)
+	if len(batch.Items) != 1 {
+		t.Errorf("Should push a gzipped batch to produce_batch, got: %+v", requests)
+	}
+	var single map[string]interface{}
+	json.Unmarshal([]byte(requests["/produce "]), &single)
+	if _, ok := single["barito_trace_time"]; !ok {
+		t.Errorf("Should push a single item to produce, got: %+v", requests)
+	}
+}
+
+func TestPushAgent_routerResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `{"warnings": ["field too long"]}`},
+		{http.StatusOK, `{"errors": [{"index": 0, "message": "invalid timestamp"}]}`},
+		{http.StatusTooManyRequests, ``},
+	}
+	timesCalled := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(responses[timesCalled].status)
+		w.Write([]byte(responses[timesCalled].body))
+		timesCalled++
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any()).Times(3)
+	gomock.InOrder(
+		mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 200),
+		mr.EXPECT().IncreasePushLogWarning("lama", "router-a", o11y.PUSH_MODE_BATCH, 1),
+		mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH),
+		mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 200),
+		mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_REJECTED),
+		mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 429),
+		mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_RATE_LIMITED),
+	)
+
+	agent := PushAgent{
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
+		secretKey:      "ABC123",
+		appPrefix:      "barito-log-probe",
+		routers:        StaticRouters{{Name: "router-a", BatchURL: srv.URL}},
+		timeField:      "barito_trace_time",
+		interval:       1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+}
+
+func TestParseRouterResponse(t *testing.T) {
+	cases := map[string]struct {
+		warnings    int
+		expectedErr bool
+	}{
+		``:                                   {},
+		`{"topic": "lama", "partition": 0}`:  {},
+		`{"warnings": ["a", "b"]}`:           {warnings: 2},
+		`{"error": "invalid secret"}`:        {expectedErr: true},
+		`{"rejected": 2, "warnings": ["a"]}`: {warnings: 1, expectedErr: true},
+		`<html>502 Bad Gateway</html>`:       {expectedErr: true},
+	}
+	for body, c := range cases {
+		warnings, err := parseRouterResponse([]byte(body))
+		if warnings != c.warnings || (err != nil) != c.expectedErr {
+			t.Errorf("parseRouterResponse(%q) should return %d warnings & error: %v, got: %d, %v", body, c.warnings, c.expectedErr, warnings, err)
+		}
+	}
+}
+
+func TestIsDefinitelyRejected(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"bad request":      {&retry.StatusError{StatusCode: 400}, true},
+		"circuit open":     {fmt.Errorf("router: %w", retry.ErrCircuitOpen), true},
+		"rejected":         {&rejectedError{reason: "invalid secret"}, true},
+		"partly rejected":  {&rejectedError{reason: "2 rejected", partial: true}, false},
+		"unavailable":      {&retry.StatusError{StatusCode: 503}, true},
+		"bad gateway":      {&retry.StatusError{StatusCode: 502}, false},
+		"timeout":          {context.DeadlineExceeded, false},
+		"unparseable body": {errors.New("invalid character '<'"), false},
+	}
+	for name, c := range cases {
+		if got := isDefinitelyRejected(c.err); got != c.expected {
+			t.Errorf("%s: isDefinitelyRejected(%v) should be %v, got: %v", name, c.err, c.expected, got)
+		}
+	}
+}
+
+func TestRouterBreakerKey(t *testing.T) {
+	cases := map[string]string{
+		"https://router.example.com/produce_batch": "lama/router.example.com",
+		"http://10.0.0.1:8080/produce":             "lama/10.0.0.1:8080",
+		"router-a":                                 "lama/router-a",
+	}
+	for url, expected := range cases {
+		if key := routerBreakerKey("lama", url); key != expected {
+			t.Errorf("routerBreakerKey(%q) should be %q, got: %q", url, expected, key)
+		}
+	}
+}
+
+func TestPushAgent_routers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	routerA := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer routerA.Close()
+	routerB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer routerB.Close()
+	advertised := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/produce_batch" {
+			t.Errorf("Should push to produce_batch of the advertised router, got: %q", r.URL.Path)
+		}
+	}))
+	defer advertised.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	ag := mock.NewMockAppGroup(ctrl)
+	ag.EXPECT().GetClusterName().Return("lama").AnyTimes()
+	ag.EXPECT().GetName().AnyTimes()
+	ag.EXPECT().GetEnvironment().AnyTimes()
+	ag.EXPECT().GetStatus().AnyTimes()
+	ag.EXPECT().GetCapacity().AnyTimes()
+	ag.EXPECT().GetLabels().AnyTimes()
+	ag.EXPECT().GetRouterURL().Return("")
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreasePushLogResponse("lama", gomock.Any(), o11y.PUSH_MODE_BATCH, gomock.Any()).AnyTimes()
+	mr.EXPECT().ObservePushLogTTFB("lama", gomock.Any(), o11y.PUSH_MODE_BATCH, gomock.Any()).AnyTimes()
+	mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH)
+	mr.EXPECT().IncreasePushLogFailed("lama", "router-b", o11y.PUSH_MODE_BATCH, o11y.REASON_HTTP_5XX)
+
+	agent := PushAgent{
+		group:          ag,
+		appPrefix:      "barito-log-probe",
+		routers:        StaticRouters{{Name: "router-a", BatchURL: routerA.URL}, {Name: "router-b", BatchURL: routerB.URL}},
+		marketRouter:   true,
+		batchPath:      "/produce_batch",
+		timeField:      "barito_trace_time",
+		interval:       1 * time.Second,
+		metricRecorder: mr,
+		ctx:            ctx,
+	}
+	agent.Run()
+
+	// once BaritoMarket advertises a router, only that one is probed
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	agent.ctx = ctx
+	ag.EXPECT().GetRouterURL().Return(advertised.URL)
+	mr.EXPECT().IncreasePushLogSuccess("lama", strings.TrimPrefix(advertised.URL, "http://"), o11y.PUSH_MODE_BATCH)
+	agent.Run()
+}
+
+func TestPushAgent_sequence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	status := http.StatusOK
+	var seqs []float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Items []map[string]interface{} `json:"items"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		for _, item := range payload.Items {
+			seq, _ := item[SEQUENCE_FIELD].(float64)
+			seqs = append(seqs, seq)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any()).AnyTimes()
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any()).AnyTimes()
+	mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH).Times(2)
+	mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_HTTP_4XX)
+	mr.EXPECT().IncreasePushLogFailed("lama", "router-a", o11y.PUSH_MODE_BATCH, o11y.REASON_HTTP_5XX).Times(2)
+
+	payload, _ := NewPayload(&config.Config{ProduceTimeField: "barito_trace_time", ProduceBatchSize: 2})
+	agent := PushAgent{
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
+		payload:        payload,
+		sequences:      NewSequences(nil),
+		timeField:      "barito_trace_time",
+		retryPolicy:    retry.NewPolicy(1, time.Millisecond, nil),
+		metricRecorder: mr,
+	}
+	router := Router{Name: "router-a", BatchURL: srv.URL}
+
+	agent.push(context.Background(), router, o11y.PUSH_MODE_BATCH)
+	status = http.StatusBadRequest
+	agent.push(context.Background(), router, o11y.PUSH_MODE_BATCH)
+	status = http.StatusOK
+	agent.push(context.Background(), router, o11y.PUSH_MODE_BATCH)
+	status = http.StatusBadGateway
+	agent.push(context.Background(), router, o11y.PUSH_MODE_BATCH)
+	status = http.StatusServiceUnavailable
+	agent.push(context.Background(), router, o11y.PUSH_MODE_BATCH)
+
+	// the numbers of the rejected pushes are reused, not the ones of a push
+	// the router may have accepted, which isn't retried either
+	expected := []float64{1, 2, 3, 4, 3, 4, 5, 6, 7, 8, 7, 8}
+	if !reflect.DeepEqual(seqs, expected) {
+		t.Errorf("Should push sequence numbers %v, got: %v", expected, seqs)
+	}
+	if first := agent.sequences.Reserve("lama", 1); first != 7 {
+		t.Errorf("Should keep the numbers of a push failing with 502, got next: %d", first)
+	}
+	if unsettled := agent.sequences.Unsettled("lama", 0, 6); unsettled != 2 {
+		t.Errorf("Should not tell missing the numbers of a push failing with 502, got unsettled: %d", unsettled)
+	}
+}
+
+func TestPushAgent_traceparent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreasePushLogResponse("lama", "router-a", o11y.PUSH_MODE_BATCH, 200)
+	mr.EXPECT().ObservePushLogTTFB("lama", "router-a", o11y.PUSH_MODE_BATCH, gomock.Any())
+	mr.EXPECT().IncreasePushLogSuccess("lama", "router-a", o11y.PUSH_MODE_BATCH)
+
+	tracer, _ := tracing.NewTracer("http://127.0.0.1:1", "prober", 10, time.Hour, time.Second)
+	tracing.Configure(tracer)
+	defer tracing.Configure(nil)
+
+	agent := PushAgent{
+		group:          appgroup.NewAppGroup("lama", "", &config.Config{}, nil),
+		timeField:      "barito_trace_time",
+		metricRecorder: mr,
+	}
+	ctx, span := tracing.Start(context.Background(), "push")
+	agent.push(ctx, Router{Name: "router-a", BatchURL: srv.URL}, o11y.PUSH_MODE_BATCH)
+	span.End(nil)
+
+	// the client span is a child of the push span, in the same trace
+	push := trace.SpanContextFromContext(ctx)
+	if parts := strings.Split(traceparent, "-"); len(parts) != 4 || parts[1] != push.TraceID().String() || parts[2] == push.SpanID().String() {
+		t.Errorf("Should send traceparent of a client span in trace %s, got: %q", push.TraceID(), traceparent)
+	}
+}
@@ -0,0 +1,86 @@
+package exporter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+)
+
+// classifyError maps an error of a probe request to a stable reason, so
+// failures can be told apart on dashboards without reading logs.
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, retry.ErrCircuitOpen) {
+		return o11y.REASON_CIRCUIT_OPEN
+	}
+
+	var rejectedErr *rejectedError
+	if errors.As(err, &rejectedErr) {
+		return o11y.REASON_REJECTED
+	}
+
+	var statusErr *retry.StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return o11y.REASON_RATE_LIMITED
+		case statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden:
+			return o11y.REASON_AUTH
+		case statusErr.StatusCode >= 500:
+			return o11y.REASON_HTTP_5XX
+		case statusErr.StatusCode >= 400:
+			return o11y.REASON_HTTP_4XX
+		}
+		return o11y.REASON_REQUEST_FAILED
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return o11y.REASON_PARSE
+	}
+
+	// a DNS lookup may time out too, it's still a DNS problem
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return o11y.REASON_DNS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return o11y.REASON_CONNECT_REFUSED
+	}
+
+	if isTLSError(err) {
+		return o11y.REASON_TLS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return o11y.REASON_TIMEOUT
+	}
+
+	return o11y.REASON_REQUEST_FAILED
+}
+
+func isTLSError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	return errors.As(err, &verificationErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &certificateInvalidErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &recordHeaderErr) || errors.As(err, &alertErr)
+}
@@ -0,0 +1,59 @@
+package exporter
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+)
+
+func TestClassifyError(t *testing.T) {
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	_, connectErr := http.Get(closed.URL)
+
+	_, dnsErr := http.Get("http://barito-blackbox-exporter.invalid")
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	_, timeoutErr := (&http.Client{Timeout: 10 * time.Millisecond}).Get(slow.URL)
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	_, tlsErr := http.Get(tlsSrv.URL)
+
+	cases := map[string]struct {
+		err      error
+		expected string
+	}{
+		"connection refused": {connectErr, o11y.REASON_CONNECT_REFUSED},
+		"dns":                {dnsErr, o11y.REASON_DNS},
+		"timeout":            {timeoutErr, o11y.REASON_TIMEOUT},
+		"tls":                {tlsErr, o11y.REASON_TLS},
+		"tls alert":          {fmt.Errorf("remote error: %w", tls.AlertError(42)), o11y.REASON_TLS},
+		"tls in message":     {errors.New("tls: something else"), o11y.REASON_REQUEST_FAILED},
+		"unauthorized":       {&retry.StatusError{StatusCode: 401}, o11y.REASON_AUTH},
+		"forbidden":          {&retry.StatusError{StatusCode: 403}, o11y.REASON_AUTH},
+		"rate limited":       {&retry.StatusError{StatusCode: 429}, o11y.REASON_RATE_LIMITED},
+		"rejected":           {&rejectedError{reason: "invalid timestamp"}, o11y.REASON_REJECTED},
+		"not found":          {&retry.StatusError{StatusCode: 404}, o11y.REASON_HTTP_4XX},
+		"bad gateway":        {fmt.Errorf("es: %w", &retry.StatusError{StatusCode: 502}), o11y.REASON_HTTP_5XX},
+		"parse":              {json.Unmarshal([]byte("<html>"), &struct{}{}), o11y.REASON_PARSE},
+		"circuit open":       {fmt.Errorf("router: %w", retry.ErrCircuitOpen), o11y.REASON_CIRCUIT_OPEN},
+		"unknown":            {errors.New("something else"), o11y.REASON_REQUEST_FAILED},
+	}
+	for name, c := range cases {
+		if got := classifyError(c.err); got != c.expected {
+			t.Errorf("%s: should classify %v as %q, got: %q", name, c.err, c.expected, got)
+		}
+	}
+}
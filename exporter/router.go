@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	log "github.com/sirupsen/logrus"
+)
+
+// Router is a router endpoint probed by the push agent, Name is used as the
+// router label.
+type Router struct {
+	Name      string
+	BatchURL  string
+	SingleURL string
+}
+
+// RouterSource lists the routers every push agent probes.
+type RouterSource interface {
+	Routers(ctx context.Context) []Router
+}
+
+// NewRouter builds a router from its base URL, named after its host when
+// name is empty.
+func NewRouter(name, baseURL, batchPath, singlePath string) Router {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if name == "" {
+		name = routerName(baseURL)
+	}
+	return Router{
+		Name:      name,
+		BatchURL:  baseURL + batchPath,
+		SingleURL: baseURL + singlePath,
+	}
+}
+
+func routerName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return u.Host
+}
+
+// ParseRouters reads a list of "name=base URL", the name being optional,
+// e.g. "jkt=https://router-jkt.example.com,https://router-sg.example.com".
+func ParseRouters(specs []string, cfg *config.Config) ([]Router, error) {
+	routers := []Router{}
+	for _, spec := range specs {
+		name, baseURL := "", spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			name, baseURL = spec[:i], spec[i+1:]
+		}
+		if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+			return nil, fmt.Errorf("Invalid router %q, expecting name=http(s)://host", spec)
+		}
+		routers = append(routers, NewRouter(name, baseURL, cfg.ProduceBatchPath, cfg.ProduceSinglePath))
+	}
+	return routers, nil
+}
+
+// StaticRouters is a RouterSource of a fixed list.
+type StaticRouters []Router
+
+func (s StaticRouters) Routers(ctx context.Context) []Router {
+	return s
+}
+
+type routerSource struct {
+	static        []Router
+	fallback      Router
+	consulHost    string
+	consulService string
+	consulScheme  string
+	interval      time.Duration
+	retryPolicy   retry.Policy
+	upstreams     *retry.Upstreams
+	batchPath     string
+	singlePath    string
+
+	mu          sync.Mutex
+	discovered  []Router
+	refreshedAt time.Time
+}
+
+// NewRouterSource returns the static routers along with the ones discovered
+// from consul, refreshed every PRODUCE_ROUTER_REFRESH_INTERVAL. Without
+// any, the router of PRODUCE_URL & PRODUCE_SINGLE_URL is used.
+func NewRouterSource(static []Router, cfg *config.Config, upstreams *retry.Upstreams) *routerSource {
+	return &routerSource{
+		static: static,
+		fallback: Router{
+			Name:      routerName(cfg.ProduceURL),
+			BatchURL:  cfg.ProduceURL,
+			SingleURL: cfg.ProduceSingleURL,
+		},
+		consulHost:    cfg.ProduceRouterConsulHost,
+		consulService: cfg.ProduceRouterConsulService,
+		consulScheme:  cfg.ProduceRouterConsulScheme,
+		interval:      cfg.ProduceRouterRefreshInterval,
+		retryPolicy:   retry.NewPolicy(cfg.ConsulRetries, cfg.ConsulRetryBackoff, cfg.ConsulRetryStatusCodes),
+		upstreams:     upstreams,
+		batchPath:     cfg.ProduceBatchPath,
+		singlePath:    cfg.ProduceSinglePath,
+	}
+}
+
+func (r *routerSource) Routers(ctx context.Context) []Router {
+	routers := append([]Router{}, r.static...)
+	routers = append(routers, r.discoveredRouters(ctx)...)
+	if len(routers) == 0 {
+		return []Router{r.fallback}
+	}
+	return routers
+}
+
+// discoveredRouters keeps the last discovered routers when consul fails.
+// Consul is called without holding r.mu, the other agents keep pushing to
+// the last discovered routers meanwhile.
+func (r *routerSource) discoveredRouters(ctx context.Context) []Router {
+	if r.consulHost == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	if !r.refreshedAt.IsZero() && time.Since(r.refreshedAt) < r.interval {
+		defer r.mu.Unlock()
+		return r.discovered
+	}
+	// the first caller refreshes, the others don't wait for it
+	r.refreshedAt = time.Now()
+	last := r.discovered
+	r.mu.Unlock()
+
+	hosts, err := appgroup.FetchConsulServices(ctx, r.upstreams, r.consulHost, r.consulService, r.retryPolicy)
+	if err != nil {
+		log.WithField(logging.FIELD_ENDPOINT, r.consulHost).WithError(err).Error("Failed to discover routers from consul")
+		return last
+	}
+	discovered := []Router{}
+	for _, host := range hosts {
+		discovered = append(discovered, NewRouter(host, r.consulScheme+"://"+host, r.batchPath, r.singlePath))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.discovered = discovered
+	return discovered
+}
@@ -0,0 +1,105 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/config"
+)
+
+func TestParseRouters(t *testing.T) {
+	cfg := &config.Config{ProduceBatchPath: "/produce_batch", ProduceSinglePath: "/produce"}
+
+	routers, err := ParseRouters([]string{"jkt=https://router-jkt.example.com/", "https://router-sg.example.com"}, cfg)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	expected := []Router{
+		{Name: "jkt", BatchURL: "https://router-jkt.example.com/produce_batch", SingleURL: "https://router-jkt.example.com/produce"},
+		{Name: "router-sg.example.com", BatchURL: "https://router-sg.example.com/produce_batch", SingleURL: "https://router-sg.example.com/produce"},
+	}
+	if !reflect.DeepEqual(routers, expected) {
+		t.Errorf("Should return %+v, got: %+v", expected, routers)
+	}
+
+	if _, err := ParseRouters([]string{"jkt=router-jkt.example.com"}, cfg); err == nil {
+		t.Errorf("Should return error on router without scheme")
+	}
+}
+
+func TestRouterSource(t *testing.T) {
+	consulCalled := 0
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consulCalled++
+		if r.URL.Path != "/v1/health/service/barito-router" {
+			t.Errorf("Should fetch the router service, got: %q", r.URL.Path)
+		}
+		w.Write([]byte(`[{"Service": {"Address": "10.0.0.1", "Port": 8080}}]`))
+	}))
+	defer consul.Close()
+
+	cfg := &config.Config{
+		ProduceURL:                   "https://router.example.com/produce_batch",
+		ProduceBatchPath:             "/produce_batch",
+		ProduceSinglePath:            "/produce",
+		ProduceRouterConsulHost:      consul.URL,
+		ProduceRouterConsulService:   "barito-router",
+		ProduceRouterConsulScheme:    "http",
+		ProduceRouterRefreshInterval: time.Minute,
+	}
+	static := []Router{{Name: "jkt", BatchURL: "https://router-jkt.example.com/produce_batch"}}
+	source := NewRouterSource(static, cfg, nil)
+
+	expected := []Router{
+		static[0],
+		{Name: "10.0.0.1:8080", BatchURL: "http://10.0.0.1:8080/produce_batch", SingleURL: "http://10.0.0.1:8080/produce"},
+	}
+	for i := 0; i < 2; i++ {
+		if routers := source.Routers(context.Background()); !reflect.DeepEqual(routers, expected) {
+			t.Errorf("Should return %+v, got: %+v", expected, routers)
+		}
+	}
+	if consulCalled != 1 {
+		t.Errorf("Should only refresh routers from consul once per interval, got: %d", consulCalled)
+	}
+
+	fallback := NewRouterSource(nil, &config.Config{ProduceURL: "https://router.example.com/produce_batch"}, nil)
+	if routers := fallback.Routers(context.Background()); len(routers) != 1 || routers[0].Name != "router.example.com" {
+		t.Errorf("Should fall back to PRODUCE_URL, got: %+v", routers)
+	}
+}
+
+func TestRouterSource_refreshWithoutLock(t *testing.T) {
+	release := make(chan struct{})
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`[{"Service": {"Address": "10.0.0.1", "Port": 8080}}]`))
+	}))
+	defer consul.Close()
+	defer close(release)
+
+	source := NewRouterSource(nil, &config.Config{
+		ProduceURL:                   "https://router.example.com/produce_batch",
+		ProduceRouterConsulHost:      consul.URL,
+		ProduceRouterConsulService:   "barito-router",
+		ProduceRouterConsulScheme:    "http",
+		ProduceRouterRefreshInterval: time.Minute,
+	}, nil)
+	go source.Routers(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan []Router)
+	go func() { done <- source.Routers(context.Background()) }()
+	select {
+	case routers := <-done:
+		if len(routers) != 1 || routers[0].Name != "router.example.com" {
+			t.Errorf("Should use the last routers while refreshing, got: %+v", routers)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Should not wait for another agent refreshing the routers")
+	}
+}
@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/state"
+)
+
+const SEQUENCE_FIELD = "barito_probe_seq"
+
+// Sequences hands out the sequence numbers of probe logs, increasing
+// monotonically per app group, and keeps how far the ES probe has checked
+// them. Both are saved along the state, with the numbers still being
+// pushed, so a restart in the middle of a push doesn't count them missing.
+type Sequences struct {
+	mu        sync.Mutex
+	sequences map[string]state.Sequence
+	inFlight  map[string][]state.SequenceRange
+}
+
+func NewSequences(saved map[string]state.Sequence) *Sequences {
+	sequences := map[string]state.Sequence{}
+	for k, v := range saved {
+		sequences[k] = v
+	}
+	return &Sequences{sequences: sequences, inFlight: map[string][]state.SequenceRange{}}
+}
+
+// Reserve returns the first of n consecutive sequence numbers, starting
+// from 1. They are in flight until settled or rewound.
+func (s *Sequences) Reserve(appGroup string, n int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.sequences[appGroup]
+	if seq.Next < 1 {
+		seq.Next = 1
+	}
+	first := seq.Next
+	seq.Next += int64(n)
+	s.sequences[appGroup] = seq
+	s.inFlight[appGroup] = append(s.inFlight[appGroup], state.SequenceRange{First: first, Count: int64(n)})
+	return first
+}
+
+// Settle marks the numbers from first as pushed.
+func (s *Sequences) Settle(appGroup string, first int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settle(appGroup, first)
+}
+
+func (s *Sequences) settle(appGroup string, first int64) {
+	ranges := s.inFlight[appGroup]
+	for i, r := range ranges {
+		if r.First == first {
+			s.inFlight[appGroup] = append(ranges[:i:i], ranges[i+1:]...)
+			break
+		}
+	}
+	if len(s.inFlight[appGroup]) == 0 {
+		delete(s.inFlight, appGroup)
+	}
+}
+
+// Rewind gives back the n numbers from first when a push failed, so they
+// don't show up as missing, unless others were reserved since.
+func (s *Sequences) Rewind(appGroup string, first int64, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settle(appGroup, first)
+	seq := s.sequences[appGroup]
+	if seq.Next == first+int64(n) {
+		seq.Next = first
+		s.sequences[appGroup] = seq
+	}
+}
+
+// Abandon gives up on the n numbers from first when a push failed after
+// the router may have accepted the logs. They are unsettled until checked,
+// so they aren't told missing if they never reached ES.
+func (s *Sequences) Abandon(appGroup string, first int64, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settle(appGroup, first)
+	seq := s.sequences[appGroup]
+	seq.Unsettled = append(seq.Unsettled, state.SequenceRange{First: first, Count: int64(n)})
+	s.sequences[appGroup] = seq
+}
+
+// Unsettled returns how many numbers after from, up to to, were abandoned
+// or in flight when the state was saved before a restart. Those may never
+// have been pushed, so they can't be told missing.
+func (s *Sequences) Unsettled(appGroup string, from, to int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for _, r := range s.sequences[appGroup].Unsettled {
+		first, last := r.First, r.First+r.Count-1
+		if first <= from {
+			first = from + 1
+		}
+		if last > to {
+			last = to
+		}
+		if last >= first {
+			count += last - first + 1
+		}
+	}
+	return count
+}
+
+// Checked returns the last sequence number and push time, in millisecond,
+// checked in ES, both 0 when nothing was checked yet.
+func (s *Sequences) Checked(appGroup string) (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.sequences[appGroup]
+	return seq.CheckedSeq, seq.CheckedTime
+}
+
+func (s *Sequences) SetChecked(appGroup string, checkedSeq, checkedTime int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.sequences[appGroup]
+	seq.CheckedSeq = checkedSeq
+	seq.CheckedTime = checkedTime
+	// unsettled numbers are only needed until checked
+	var unsettled []state.SequenceRange
+	for _, r := range seq.Unsettled {
+		if r.First+r.Count-1 > checkedSeq {
+			unsettled = append(unsettled, r)
+		}
+	}
+	seq.Unsettled = unsettled
+	s.sequences[appGroup] = seq
+}
+
+func (s *Sequences) Snapshot() map[string]state.Sequence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := map[string]state.Sequence{}
+	for k, v := range s.sequences {
+		v.Unsettled = append(append([]state.SequenceRange(nil), v.Unsettled...), s.inFlight[k]...)
+		snapshot[k] = v
+	}
+	return snapshot
+}
@@ -0,0 +1,81 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/state"
+)
+
+func TestSequences(t *testing.T) {
+	sequences := NewSequences(map[string]state.Sequence{"lama": {Next: 10, CheckedSeq: 8, CheckedTime: 1600000000000}})
+
+	if first := sequences.Reserve("lama", 3); first != 10 {
+		t.Errorf("Should continue from saved sequence, got: %d", first)
+	}
+	if first := sequences.Reserve("hoke", 1); first != 1 {
+		t.Errorf("Should start new sequence from 1, got: %d", first)
+	}
+
+	first := sequences.Reserve("lama", 2)
+	sequences.Rewind("lama", first, 2)
+	if first := sequences.Reserve("lama", 1); first != 13 {
+		t.Errorf("Should reuse rewound numbers, got: %d", first)
+	}
+
+	// numbers reserved since can't be given back
+	sequences.Rewind("lama", 10, 3)
+	if first := sequences.Reserve("lama", 1); first != 14 {
+		t.Errorf("Should not rewind past later numbers, got: %d", first)
+	}
+
+	sequences.Settle("lama", 13)
+	sequences.SetChecked("hoke", 1, 1600000060000)
+	if checkedSeq, checkedTime := sequences.Checked("lama"); checkedSeq != 8 || checkedTime != 1600000000000 {
+		t.Errorf("Should return saved check, got: %d, %d", checkedSeq, checkedTime)
+	}
+
+	expected := map[string]state.Sequence{
+		"lama": {Next: 15, CheckedSeq: 8, CheckedTime: 1600000000000, Unsettled: []state.SequenceRange{{First: 14, Count: 1}}},
+		"hoke": {Next: 2, CheckedSeq: 1, CheckedTime: 1600000060000, Unsettled: []state.SequenceRange{{First: 1, Count: 1}}},
+	}
+	if snapshot := sequences.Snapshot(); !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("Snapshot should return %+v, got: %+v", expected, snapshot)
+	}
+}
+
+func TestSequences_abandon(t *testing.T) {
+	sequences := NewSequences(nil)
+	first := sequences.Reserve("lama", 2)
+	sequences.Abandon("lama", first, 2)
+
+	if next := sequences.Reserve("lama", 1); next != 3 {
+		t.Errorf("Should not reuse abandoned numbers, got: %d", next)
+	}
+	if unsettled := sequences.Unsettled("lama", 0, 3); unsettled != 2 {
+		t.Errorf("Should count abandoned numbers unsettled, got: %d", unsettled)
+	}
+	sequences.SetChecked("lama", 2, 1600000000000)
+	if unsettled := sequences.Unsettled("lama", 0, 3); unsettled != 0 {
+		t.Errorf("Should forget abandoned numbers once checked, got: %d", unsettled)
+	}
+}
+
+func TestSequences_unsettled(t *testing.T) {
+	// 10 to 12 were in flight when saved
+	sequences := NewSequences(map[string]state.Sequence{
+		"lama": {Next: 13, CheckedSeq: 8, Unsettled: []state.SequenceRange{{First: 10, Count: 3}}},
+	})
+
+	if unsettled := sequences.Unsettled("lama", 8, 20); unsettled != 3 {
+		t.Errorf("Should count unsettled numbers, got: %d", unsettled)
+	}
+	if unsettled := sequences.Unsettled("lama", 10, 11); unsettled != 1 {
+		t.Errorf("Should only count unsettled numbers after from up to to, got: %d", unsettled)
+	}
+
+	sequences.SetChecked("lama", 12, 1600000000000)
+	if unsettled := sequences.Unsettled("lama", 8, 20); unsettled != 0 {
+		t.Errorf("Should forget unsettled numbers once checked, got: %d", unsettled)
+	}
+}
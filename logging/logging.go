@@ -0,0 +1,64 @@
+// Package logging sets up logrus from the config and names the fields
+// shared by the logs of every agent, so they can be searched alike.
+package logging
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+
+	FIELD_APP_GROUP = "app_group"
+	FIELD_PROBE     = "probe"
+	FIELD_ENDPOINT  = "endpoint"
+	FIELD_REASON    = "reason"
+	FIELD_ROUTER    = "router"
+	FIELD_MODE      = "mode"
+	FIELD_APP       = "app"
+	// in second
+	FIELD_DURATION = "duration"
+	// number of logs of the app group dropped by sampling before this one
+	FIELD_SAMPLED_OUT = "sampled_out"
+)
+
+// Configure sets the level, one of logrus' e.g. "info", and the format,
+// text or json. Sampling is off unless burst is above 0, each app group then
+// logs at most burst info & debug lines per sampleInterval.
+func Configure(level, format string, burst int, sampleInterval time.Duration) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var formatter log.Formatter
+	switch format {
+	case FORMAT_TEXT:
+		formatter = &log.TextFormatter{FullTimestamp: true}
+	case FORMAT_JSON:
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("Unknown log format %q", format)
+	}
+	if burst > 0 {
+		formatter = NewSampler(formatter, burst, sampleInterval)
+	}
+
+	log.SetLevel(lvl)
+	log.SetFormatter(formatter)
+	return nil
+}
+
+// For returns the logger of a probe of an app group.
+func For(appGroup, probe string) *log.Entry {
+	return log.WithFields(log.Fields{FIELD_APP_GROUP: appGroup, FIELD_PROBE: probe})
+}
+
+// Since returns the duration field of a step started at start.
+func Since(start time.Time) log.Fields {
+	return log.Fields{FIELD_DURATION: time.Since(start).Seconds()}
+}
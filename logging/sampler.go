@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type sampleWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// Sampler is a formatter letting through at most burst info & debug logs of
+// each app group per interval, so a broken app group can't drown the others.
+// The first log let through after some were dropped tells how many in
+// FIELD_SAMPLED_OUT. Logs without app group, and warnings or worse, are
+// never dropped.
+type Sampler struct {
+	formatter log.Formatter
+	burst     int
+	interval  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	windows  map[string]*sampleWindow
+	prunedAt time.Time
+}
+
+func NewSampler(formatter log.Formatter, burst int, interval time.Duration) *Sampler {
+	return &Sampler{
+		formatter: formatter,
+		burst:     burst,
+		interval:  interval,
+		now:       time.Now,
+		windows:   map[string]*sampleWindow{},
+	}
+}
+
+// Format returns nothing for a dropped log, logrus then writes nothing.
+func (s *Sampler) Format(entry *log.Entry) ([]byte, error) {
+	appGroup, ok := entry.Data[FIELD_APP_GROUP].(string)
+	if !ok || entry.Level <= log.WarnLevel {
+		return s.formatter.Format(entry)
+	}
+
+	dropped, keep := s.sample(appGroup)
+	if !keep {
+		return nil, nil
+	}
+	if dropped > 0 {
+		annotated := entry.WithField(FIELD_SAMPLED_OUT, dropped)
+		annotated.Level = entry.Level
+		annotated.Message = entry.Message
+		annotated.Caller = entry.Caller
+		entry = annotated
+	}
+	return s.formatter.Format(entry)
+}
+
+// sample tells whether to keep a log of the app group, and how many were
+// dropped since the last one kept.
+func (s *Sampler) sample(appGroup string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+	w, ok := s.windows[appGroup]
+	if !ok {
+		w = &sampleWindow{start: now}
+		s.windows[appGroup] = w
+	}
+	if now.Sub(w.start) >= s.interval {
+		w.start, w.count = now, 0
+	}
+	if w.count >= s.burst {
+		w.dropped++
+		return 0, false
+	}
+
+	w.count++
+	dropped := w.dropped
+	w.dropped = 0
+	return dropped, true
+}
+
+// prune forgets, once per interval, the windows of app groups which stopped
+// logging, e.g. removed ones. The dropped count of an app group quiet for a
+// whole interval is lost.
+func (s *Sampler) prune(now time.Time) {
+	if now.Sub(s.prunedAt) < s.interval {
+		return
+	}
+	s.prunedAt = now
+
+	for appGroup, w := range s.windows {
+		age := now.Sub(w.start)
+		if (age >= s.interval && w.dropped == 0) || age >= 2*s.interval {
+			delete(s.windows, appGroup)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSampler(t *testing.T) {
+	now := time.Now()
+	sampler := NewSampler(&log.JSONFormatter{}, 2, time.Minute)
+	sampler.now = func() time.Time { return now }
+
+	var out bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(sampler)
+
+	lama := logger.WithField(FIELD_APP_GROUP, "lama")
+	for i := 0; i < 5; i++ {
+		lama.Info("Probed ES")
+	}
+	lama.Warn("Slow ES")
+	lama.Error("Failed to probe ES")
+	logger.WithField(FIELD_APP_GROUP, "kuda").Info("Start probing")
+	logger.Info("Not about an app group")
+
+	now = now.Add(time.Minute)
+	lama.Info("Probed ES")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if len(lines) != 7 {
+		t.Fatalf("Should keep 7 logs, got: %s", out.String())
+	}
+
+	var logs []map[string]interface{}
+	for _, line := range lines {
+		var l map[string]interface{}
+		if err := json.Unmarshal(line, &l); err != nil {
+			t.Fatalf("Should log JSON, got: %s", line)
+		}
+		logs = append(logs, l)
+	}
+	if logs[2]["level"] != "warning" || logs[3]["level"] != "error" {
+		t.Errorf("Should never drop warnings or errors, got: %v", logs[2:4])
+	}
+	if last := logs[6]; last[FIELD_APP_GROUP] != "lama" || last[FIELD_SAMPLED_OUT] != float64(3) || last["level"] != "info" || last["msg"] != "Probed ES" {
+		t.Errorf("Should tell 3 logs were dropped, got: %v", last)
+	}
+}
+
+func TestSampler_prune(t *testing.T) {
+	now := time.Now()
+	sampler := NewSampler(&log.JSONFormatter{}, 1, time.Minute)
+	sampler.now = func() time.Time { return now }
+
+	logger := log.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.SetFormatter(sampler)
+
+	logger.WithField(FIELD_APP_GROUP, "lama").Info("Probed ES")
+	logger.WithField(FIELD_APP_GROUP, "kuda").Info("Probed ES")
+	logger.WithField(FIELD_APP_GROUP, "kuda").Info("Probed ES")
+
+	now = now.Add(time.Minute)
+	logger.WithField(FIELD_APP_GROUP, "unta").Info("Probed ES")
+	if _, ok := sampler.windows["lama"]; ok || len(sampler.windows) != 2 {
+		t.Errorf("Should forget the idle app group only, got: %v", sampler.windows)
+	}
+
+	now = now.Add(time.Minute)
+	logger.WithField(FIELD_APP_GROUP, "unta").Info("Probed ES")
+	if _, ok := sampler.windows["kuda"]; ok || len(sampler.windows) != 1 {
+		t.Errorf("Should forget the app group quiet for a whole interval, got: %v", sampler.windows)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer log.SetFormatter(&log.TextFormatter{})
+	defer log.SetLevel(log.InfoLevel)
+
+	if err := Configure("warn", FORMAT_JSON, 10, time.Minute); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	if log.GetLevel() != log.WarnLevel {
+		t.Errorf("Should set level warn, got: %v", log.GetLevel())
+	}
+	if _, ok := log.StandardLogger().Formatter.(*Sampler); !ok {
+		t.Errorf("Should sample logs, got: %T", log.StandardLogger().Formatter)
+	}
+
+	if err := Configure("loud", FORMAT_TEXT, 0, 0); err == nil {
+		t.Errorf("Should return error on unknown level")
+	}
+	if err := Configure("info", "xml", 0, 0); err == nil {
+		t.Errorf("Should return error on unknown format")
+	}
+}
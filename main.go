@@ -1,94 +1,347 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Shopify/sarama"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/BaritoLog/barito-blackbox-exporter/admin"
 	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
 	"github.com/BaritoLog/barito-blackbox-exporter/config"
 	"github.com/BaritoLog/barito-blackbox-exporter/exporter"
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+	"github.com/BaritoLog/barito-blackbox-exporter/notifier"
 	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/BaritoLog/barito-blackbox-exporter/redact"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/BaritoLog/barito-blackbox-exporter/slo"
+	"github.com/BaritoLog/barito-blackbox-exporter/state"
+	"github.com/BaritoLog/barito-blackbox-exporter/statuspage"
+	"github.com/BaritoLog/barito-blackbox-exporter/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	log.SetLevel(log.DebugLevel)
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := logging.Configure(cfg.LogLevel, cfg.LogFormat, cfg.LogSampleBurst, cfg.LogSampleInterval); err != nil {
+		log.Fatalf("Invalid LOG_LEVEL or LOG_FORMAT: %v", err)
+	}
+	log.AddHook(&redact.Hook{})
+	redact.Register(cfg.BaritoMarketToken)
+	redact.Register(cfg.ESProbePassword)
+	redact.Register(cfg.AdminToken)
+	redact.Register(cfg.NotifierSlackWebhookURLs...)
+	redact.Register(cfg.NotifierWebhookURLs...)
 
-	cfg := config.NewConfig()
-	mR := o11y.NewMetricRecorder()
+	metricRecorder := o11y.NewMetricRecorder()
+	mR, tracker := createSLORecorder(cfg, metricRecorder.GetRegistry(), metricRecorder)
+	mR = createNotifierRecorder(cfg, mR)
+	upstreams := retry.NewUpstreams(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown, mR)
+	tracer := createTracer(cfg)
+
+	var store *state.Store
+	snapshot := &state.Snapshot{}
+	if cfg.StateFile != "" {
+		store = state.NewStore(cfg.StateFile)
+		snapshot = loadState(store, metricRecorder)
+		if tracker != nil {
+			tracker.Restore(snapshot.SLOWindows)
+		}
+	}
 
-	mapAppGroups := map[string]bool{}
+	if err := exporter.ValidatePushModes(cfg.ProduceModes); err != nil {
+		log.Fatalf("Invalid PRODUCE_MODES: %v", err)
+	}
+	payload, err := exporter.NewPayload(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create push payload: %v", err)
+	}
 
-	appGroups, err := appgroup.GetListAppGroups(*cfg)
+	routers, err := exporter.ParseRouters(cfg.ProduceRouters, cfg)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to get list app group from BaritoMarket: %v", err))
+		log.Fatalf("Invalid PRODUCE_ROUTERS: %v", err)
 	}
+	routerSource := exporter.NewRouterSource(routers, cfg, upstreams)
 
-	for _, aG := range appGroups {
-		go createPushAgent(aG, cfg, mR).Run()
-		go createESProbeAgent(aG, cfg, mR).Run()
-		go createKibanaProbeAgent(aG, cfg, mR).Run()
-		mapAppGroups[aG.GetClusterName()] = true
+	var sequences *exporter.Sequences
+	if cfg.SequenceCheckEnabled {
+		sequences = exporter.NewSequences(snapshot.Sequences)
+	}
+	probeLogTimes := exporter.NewProbeLogTimes(snapshot.ProbeLogTimes)
+
+	appChecks := exporter.AppFreshnessChecks{}
+	if cfg.AppFreshnessChecksFile != "" {
+		if appChecks, err = exporter.LoadAppFreshnessChecks(cfg.AppFreshnessChecksFile); err != nil {
+			log.Fatalf("Invalid APP_FRESHNESS_CHECKS_FILE: %v", err)
+		}
+	}
+
+	// cancelled on SIGINT or SIGTERM, stopping every agent
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancelled once the agents stopped, so their last spans are exported
+	tracingCtx, stopTracing := context.WithCancel(context.Background())
+	defer stopTracing()
+	tracingDone := make(chan struct{})
+	go func() {
+		if tracer != nil {
+			tracer.Run(tracingCtx, cfg.ShutdownTimeout)
+		}
+		close(tracingDone)
+	}()
+
+	manager := exporter.NewManager(createAppGroupSource(cfg, snapshot, upstreams, mR), createAgentFactory(cfg, payload, routerSource, sequences, probeLogTimes, appChecks, upstreams, mR), ctx, cfg, mR)
+	manager.Restored(snapshot.RestoredAppGroups())
+	managerDone := make(chan struct{})
+	go func() {
+		manager.Run()
+		close(managerDone)
+	}()
+
+	if store != nil {
+		go saveStatePeriodically(ctx, store, cfg, metricRecorder, manager.AppGroups, sequences, probeLogTimes, tracker)
 	}
 
 	// todo: disable for now, because after deleting the topic, consumer must be restarted
-	//go deleteProberKafkaTopic(appGroups, cfg)
+	//go deleteProberKafkaTopic(manager.AppGroups(), cfg)
+
+	// the admin API and the status page are off without a token
+	if cfg.AdminToken != "" {
+		adminHandler := admin.NewHandler(manager, cfg.AdminToken)
+		http.Handle(admin.PATH_PREFIX, adminHandler)
+		http.Handle(admin.PATH_PREFIX+"/", adminHandler)
+		http.Handle(statuspage.PATH, statuspage.NewHandler(manager, cfg.AdminToken))
+	}
 
 	http.Handle("/metrics", promhttp.HandlerFor(
-		mR.GetRegistry(),
+		metricRecorder.GetRegistry(),
 		promhttp.HandlerOpts{EnableOpenMetrics: true},
 	))
-	log.Fatal(http.ListenAndServe(":8000", nil))
+	server := &http.Server{Addr: ":8000"}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Infof("Shutting down on %v", <-signals)
+	// the manager forgets its app groups once stopped
+	appGroups := manager.AppGroups()
+	cancel()
+
+	// agents finish the push in flight, so its numbers are settled
+	select {
+	case <-managerDone:
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Warn("Timed out waiting for agents to stop")
+	}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("Failed to shut down HTTP server, error: %v", err)
+	}
+	if store != nil {
+		saveState(store, metricRecorder, appGroups, sequences, probeLogTimes, tracker)
+	}
+	stopTracing()
+	<-tracingDone
 }
 
-func createPushAgent(appGroup appgroup.AppGroup, cfg *config.Config, mR o11y.MetricRecorder) *exporter.PushAgent {
-	return exporter.NewPushAgent(appGroup.GetClusterName(), appGroup.GetSecret(), context.Background(), cfg, mR)
+// createTracer returns nil when tracing is disabled.
+func createTracer(cfg *config.Config) *tracing.Tracer {
+	if cfg.TracingEndpoint == "" {
+		return nil
+	}
+
+	tracer, err := tracing.NewTracer(cfg.TracingEndpoint, cfg.TracingServiceName, cfg.TracingQueueSize, cfg.TracingFlushInterval, cfg.TracingTimeout)
+	if err != nil {
+		log.Fatalf("Invalid OTEL_EXPORTER_OTLP_ENDPOINT: %v", err)
+	}
+	log.Infof("Tracing enabled, exporting spans to %q", cfg.TracingEndpoint)
+	tracing.Configure(tracer)
+	return tracer
 }
 
-func createESProbeAgent(appGroup appgroup.AppGroup, cfg *config.Config, mR o11y.MetricRecorder) *exporter.ESProbeAgent {
-	return exporter.NewESProbeAgent(appGroup, context.Background(), cfg, mR)
+// createAppGroupSource merges the app groups from BaritoMarket with the
+// static ones, static app groups taking precedence. Results are cached, the
+// ones of BaritoMarket starting from the saved state, so its outage, or a
+// static file failing to parse while edited, doesn't stop probes.
+// The include/exclude filter applies to all of them, then only the app groups
+// owned by this replica are kept.
+func createAppGroupSource(cfg *config.Config, snapshot *state.Snapshot, upstreams *retry.Upstreams, mR o11y.MetricRecorder) appgroup.Source {
+	sources := []appgroup.Source{}
+	if cfg.BaritoMarketDiscoveryEnabled {
+		saved := []appgroup.AppGroup{}
+		for _, aG := range snapshot.AppGroups {
+			saved = append(saved, appgroup.NewAppGroupWithMetadata(aG.ClusterName, aG.Secret, aG.Metadata, cfg, upstreams))
+		}
+		sources = append(sources, appgroup.NewCachedSource(appgroup.NewMarketSource(cfg, upstreams, mR), saved))
+	}
+	if cfg.StaticAppGroupsFile != "" {
+		sources = append(sources, appgroup.NewCachedSource(appgroup.NewFileSource(cfg.StaticAppGroupsFile, cfg, upstreams), nil))
+	}
+	if cfg.StaticAppGroups != "" {
+		sources = append(sources, appgroup.NewCachedSource(appgroup.NewEnvSource(cfg.StaticAppGroups, cfg, upstreams), nil))
+	}
+
+	filter, err := appgroup.NewFilter(cfg.AppGroupIncludeRegex, cfg.AppGroupExcludeRegex,
+		cfg.AppGroupIncludeAttributes, cfg.AppGroupExcludeAttributes)
+	if err != nil {
+		log.Fatalf("Failed to create app group filter: %v", err)
+	}
+	source := appgroup.NewFilteredSource(appgroup.NewMergedSource(sources...), filter)
+
+	shard, err := createShard(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create shard: %v", err)
+	}
+	if shard == nil {
+		return source
+	}
+	return appgroup.NewShardedSource(source, shard)
 }
 
-func createKibanaProbeAgent(appGroup appgroup.AppGroup, cfg *config.Config, mR o11y.MetricRecorder) *exporter.KibanaProbeAgent {
-	return exporter.NewKibanaProbeAgent(appGroup, context.Background(), cfg, mR)
+// createShard prefers the peer list over the replica index, and returns nil
+// when there is a single replica.
+func createShard(cfg *config.Config) (*appgroup.Shard, error) {
+	if len(cfg.ShardPeers) > 0 {
+		log.Infof("Sharding app groups across peers %v as %q", cfg.ShardPeers, cfg.ShardSelf)
+		return appgroup.NewShard(cfg.ShardPeers, cfg.ShardSelf)
+	}
+	if cfg.ShardReplicaCount > 1 {
+		log.Infof("Sharding app groups across %d replicas as replica %d", cfg.ShardReplicaCount, cfg.ShardReplicaIndex)
+		return appgroup.NewIndexShard(cfg.ShardReplicaIndex, cfg.ShardReplicaCount)
+	}
+	return nil, nil
 }
 
-func getClusterAndSecret() []map[string]string {
-	result := []map[string]string{}
+func loadState(store *state.Store, s state.Snapshotter) *state.Snapshot {
+	snapshot, err := store.Load()
+	if err != nil {
+		log.Errorf("Failed to load state, starting from scratch, error: %v", err)
+		return &state.Snapshot{}
+	}
+
+	for _, sample := range s.Restore(snapshot.Metrics) {
+		log.WithField("labels", sample.Labels).Warnf("Dropped saved %s, its labels don't match the metric anymore", sample.Name)
+	}
+	log.Infof("Loaded state saved at %v with %d app group", snapshot.SavedAt, len(snapshot.AppGroups))
+	return snapshot
+}
 
-	file, err := os.Open("./secrets_sample")
+func saveState(store *state.Store, s state.Snapshotter, appGroups []appgroup.AppGroup, sequences *exporter.Sequences, probeLogTimes *exporter.ProbeLogTimes, tracker *slo.Tracker) {
+	metrics, err := s.Snapshot()
 	if err != nil {
-		log.Fatal(err)
+		log.Errorf("Failed to snapshot metrics, error: %v", err)
+		return
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		s := strings.Split(scanner.Text(), " ")
-		result = append(result, map[string]string{"code": s[0], "secret": s[1]})
+	snapshot := &state.Snapshot{SavedAt: time.Now(), Metrics: metrics, ProbeLogTimes: map[string]int64{}}
+	for _, aG := range appGroups {
+		snapshot.AppGroups = append(snapshot.AppGroups, state.AppGroup{ClusterName: aG.GetClusterName(), Secret: aG.GetSecret(), Metadata: aG.GetMetadata()})
+		if dataTime := probeLogTimes.Get(aG.GetClusterName()); dataTime != 0 {
+			snapshot.ProbeLogTimes[aG.GetClusterName()] = dataTime
+		}
+	}
+	if sequences != nil {
+		snapshot.Sequences = sequences.Snapshot()
+	}
+	if tracker != nil {
+		snapshot.SLOWindows = tracker.Snapshot()
+	}
+	if err := store.Save(snapshot); err != nil {
+		log.Errorf("Failed to save state, error: %v", err)
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+// saveStatePeriodically stops once ctx is done, main saves the state a last
+// time after the agents stopped.
+func saveStatePeriodically(ctx context.Context, store *state.Store, cfg *config.Config, s state.Snapshotter, appGroups func() []appgroup.AppGroup, sequences *exporter.Sequences, probeLogTimes *exporter.ProbeLogTimes, tracker *slo.Tracker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.StateSaveInterval):
+			saveState(store, s, appGroups(), sequences, probeLogTimes, tracker)
+		}
+	}
+}
+
+func createAgentFactory(cfg *config.Config, payload *exporter.Payload, routers exporter.RouterSource, sequences *exporter.Sequences, probeLogTimes *exporter.ProbeLogTimes, appChecks exporter.AppFreshnessChecks, upstreams *retry.Upstreams, mR o11y.MetricRecorder) exporter.AgentFactory {
+	return func(aG appgroup.AppGroup, ctx context.Context) []exporter.Agent {
+		return []exporter.Agent{
+			createPushAgent(aG, payload, routers, sequences, upstreams, ctx, cfg, mR),
+			createESProbeAgent(aG, sequences, probeLogTimes, appChecks, upstreams, ctx, cfg, mR),
+			createKibanaProbeAgent(aG, upstreams, ctx, cfg, mR),
+			createMetadataAgent(aG, ctx, cfg, mR),
+		}
+	}
+}
+
+func createPushAgent(appGroup appgroup.AppGroup, payload *exporter.Payload, routers exporter.RouterSource, sequences *exporter.Sequences, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *exporter.PushAgent {
+	return exporter.NewPushAgent(appGroup, payload, routers, sequences, upstreams, ctx, cfg, mR)
+}
+
+func createESProbeAgent(appGroup appgroup.AppGroup, sequences *exporter.Sequences, probeLogTimes *exporter.ProbeLogTimes, appChecks exporter.AppFreshnessChecks, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *exporter.ESProbeAgent {
+	return exporter.NewESProbeAgent(appGroup, sequences, probeLogTimes, appChecks, upstreams, ctx, cfg, mR)
+}
+
+func createKibanaProbeAgent(appGroup appgroup.AppGroup, upstreams *retry.Upstreams, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *exporter.KibanaProbeAgent {
+	return exporter.NewKibanaProbeAgent(appGroup, upstreams, ctx, cfg, mR)
+}
+
+func createMetadataAgent(appGroup appgroup.AppGroup, ctx context.Context, cfg *config.Config, mR o11y.MetricRecorder) *exporter.MetadataAgent {
+	return exporter.NewMetadataAgent(appGroup, ctx, cfg, mR)
+}
+
+// createSLORecorder also returns the tracker, nil when SLOs are disabled, so
+// its windows can be saved along the state.
+func createSLORecorder(cfg *config.Config, registry *prometheus.Registry, mR o11y.MetricRecorder) (o11y.MetricRecorder, *slo.Tracker) {
+	if !cfg.SLOEnabled {
+		return mR, nil
+	}
+
+	tracker := slo.NewTracker(cfg.SLOWindows, cfg.SLOObjective)
+	registry.MustRegister(tracker)
+	return slo.NewRecorder(mR, tracker, cfg.SLOFreshnessThreshold.Seconds()), tracker
+}
+
+func createNotifierRecorder(cfg *config.Config, mR o11y.MetricRecorder) o11y.MetricRecorder {
+	webhooks := []notifier.Webhook{}
+	for _, url := range cfg.NotifierSlackWebhookURLs {
+		webhooks = append(webhooks, notifier.NewSlackWebhook(url, cfg.NotifierTimeout))
+	}
+	for _, url := range cfg.NotifierWebhookURLs {
+		webhooks = append(webhooks, notifier.NewJSONWebhook(url, cfg.NotifierTimeout))
+	}
+	if len(webhooks) == 0 {
+		return mR
 	}
 
-	log.Infof("Found %d appgroup", len(result))
-	return result
+	log.Infof("Notifier enabled with %d webhook", len(webhooks))
+	n := notifier.NewNotifier(webhooks, cfg.NotifierFailureThreshold, cfg.NotifierDelayThreshold)
+	return notifier.NewRecorder(mR, n)
 }
 
 func deleteProberKafkaTopic(appGroups []appgroup.AppGroup, cfg *config.Config) {
 	for {
 		for _, aG := range appGroups {
-			aG.RefreshMetadata()
-			listKafka, err := aG.GetListKafka()
+			aG.RefreshMetadata(context.Background())
+			listKafka, err := aG.GetListKafka(context.Background())
 			if err != nil {
 				log.Errorf("Failed to GetListKafka on app_group: %q, err: %v", aG.GetClusterName(), err)
 				continue
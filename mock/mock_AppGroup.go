@@ -5,6 +5,8 @@
 package mock
 
 import (
+	context "context"
+	appgroup "github.com/BaritoLog/barito-blackbox-exporter/appgroup"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -33,17 +35,17 @@ func (m *MockAppGroup) EXPECT() *MockAppGroupMockRecorder {
 }
 
 // RefreshMetadata mocks base method
-func (m *MockAppGroup) RefreshMetadata() error {
+func (m *MockAppGroup) RefreshMetadata(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RefreshMetadata")
+	ret := m.ctrl.Call(m, "RefreshMetadata", ctx)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RefreshMetadata indicates an expected call of RefreshMetadata
-func (mr *MockAppGroupMockRecorder) RefreshMetadata() *gomock.Call {
+func (mr *MockAppGroupMockRecorder) RefreshMetadata(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshMetadata", reflect.TypeOf((*MockAppGroup)(nil).RefreshMetadata))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshMetadata", reflect.TypeOf((*MockAppGroup)(nil).RefreshMetadata), ctx)
 }
 
 // GetName mocks base method
@@ -88,47 +90,201 @@ func (mr *MockAppGroupMockRecorder) GetSecret() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSecret", reflect.TypeOf((*MockAppGroup)(nil).GetSecret))
 }
 
+// GetCapacity mocks base method
+func (m *MockAppGroup) GetCapacity() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCapacity")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetCapacity indicates an expected call of GetCapacity
+func (mr *MockAppGroupMockRecorder) GetCapacity() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCapacity", reflect.TypeOf((*MockAppGroup)(nil).GetCapacity))
+}
+
+// GetStatus mocks base method
+func (m *MockAppGroup) GetStatus() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatus")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetStatus indicates an expected call of GetStatus
+func (mr *MockAppGroupMockRecorder) GetStatus() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatus", reflect.TypeOf((*MockAppGroup)(nil).GetStatus))
+}
+
+// GetEnvironment mocks base method
+func (m *MockAppGroup) GetEnvironment() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEnvironment")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetEnvironment indicates an expected call of GetEnvironment
+func (mr *MockAppGroupMockRecorder) GetEnvironment() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEnvironment", reflect.TypeOf((*MockAppGroup)(nil).GetEnvironment))
+}
+
+// GetLogRetentionDays mocks base method
+func (m *MockAppGroup) GetLogRetentionDays() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLogRetentionDays")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetLogRetentionDays indicates an expected call of GetLogRetentionDays
+func (mr *MockAppGroupMockRecorder) GetLogRetentionDays() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLogRetentionDays", reflect.TypeOf((*MockAppGroup)(nil).GetLogRetentionDays))
+}
+
+// GetTPS mocks base method
+func (m *MockAppGroup) GetTPS() float64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTPS")
+	ret0, _ := ret[0].(float64)
+	return ret0
+}
+
+// GetTPS indicates an expected call of GetTPS
+func (mr *MockAppGroupMockRecorder) GetTPS() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTPS", reflect.TypeOf((*MockAppGroup)(nil).GetTPS))
+}
+
+// GetMaxTPS mocks base method
+func (m *MockAppGroup) GetMaxTPS() float64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMaxTPS")
+	ret0, _ := ret[0].(float64)
+	return ret0
+}
+
+// GetMaxTPS indicates an expected call of GetMaxTPS
+func (mr *MockAppGroupMockRecorder) GetMaxTPS() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMaxTPS", reflect.TypeOf((*MockAppGroup)(nil).GetMaxTPS))
+}
+
+// GetApps mocks base method
+func (m *MockAppGroup) GetApps() []appgroup.App {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApps")
+	ret0, _ := ret[0].([]appgroup.App)
+	return ret0
+}
+
+// GetApps indicates an expected call of GetApps
+func (mr *MockAppGroupMockRecorder) GetApps() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApps", reflect.TypeOf((*MockAppGroup)(nil).GetApps))
+}
+
+// GetLabels mocks base method
+func (m *MockAppGroup) GetLabels() map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLabels")
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// GetLabels indicates an expected call of GetLabels
+func (mr *MockAppGroupMockRecorder) GetLabels() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLabels", reflect.TypeOf((*MockAppGroup)(nil).GetLabels))
+}
+
+// GetRouterURL mocks base method
+func (m *MockAppGroup) GetRouterURL() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRouterURL")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetRouterURL indicates an expected call of GetRouterURL
+func (mr *MockAppGroupMockRecorder) GetRouterURL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRouterURL", reflect.TypeOf((*MockAppGroup)(nil).GetRouterURL))
+}
+
+// GetEndpoints mocks base method
+func (m *MockAppGroup) GetEndpoints() appgroup.Endpoints {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEndpoints")
+	ret0, _ := ret[0].(appgroup.Endpoints)
+	return ret0
+}
+
+// GetEndpoints indicates an expected call of GetEndpoints
+func (mr *MockAppGroupMockRecorder) GetEndpoints() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEndpoints", reflect.TypeOf((*MockAppGroup)(nil).GetEndpoints))
+}
+
+// GetMetadata mocks base method
+func (m *MockAppGroup) GetMetadata() appgroup.Metadata {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetadata")
+	ret0, _ := ret[0].(appgroup.Metadata)
+	return ret0
+}
+
+// GetMetadata indicates an expected call of GetMetadata
+func (mr *MockAppGroupMockRecorder) GetMetadata() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadata", reflect.TypeOf((*MockAppGroup)(nil).GetMetadata))
+}
+
 // GetListES mocks base method
-func (m *MockAppGroup) GetListES() ([]string, error) {
+func (m *MockAppGroup) GetListES(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetListES")
+	ret := m.ctrl.Call(m, "GetListES", ctx)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetListES indicates an expected call of GetListES
-func (mr *MockAppGroupMockRecorder) GetListES() *gomock.Call {
+func (mr *MockAppGroupMockRecorder) GetListES(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListES", reflect.TypeOf((*MockAppGroup)(nil).GetListES))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListES", reflect.TypeOf((*MockAppGroup)(nil).GetListES), ctx)
 }
 
 // GetListKafka mocks base method
-func (m *MockAppGroup) GetListKafka() ([]string, error) {
+func (m *MockAppGroup) GetListKafka(ctx context.Context) ([]string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetListKafka")
+	ret := m.ctrl.Call(m, "GetListKafka", ctx)
 	ret0, _ := ret[0].([]string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetListKafka indicates an expected call of GetListKafka
-func (mr *MockAppGroupMockRecorder) GetListKafka() *gomock.Call {
+func (mr *MockAppGroupMockRecorder) GetListKafka(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListKafka", reflect.TypeOf((*MockAppGroup)(nil).GetListKafka))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetListKafka", reflect.TypeOf((*MockAppGroup)(nil).GetListKafka), ctx)
 }
 
 // GetKibanaHost mocks base method
-func (m *MockAppGroup) GetKibanaHost() (string, error) {
+func (m *MockAppGroup) GetKibanaHost(ctx context.Context) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetKibanaHost")
+	ret := m.ctrl.Call(m, "GetKibanaHost", ctx)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetKibanaHost indicates an expected call of GetKibanaHost
-func (mr *MockAppGroupMockRecorder) GetKibanaHost() *gomock.Call {
+func (mr *MockAppGroupMockRecorder) GetKibanaHost(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKibanaHost", reflect.TypeOf((*MockAppGroup)(nil).GetKibanaHost))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKibanaHost", reflect.TypeOf((*MockAppGroup)(nil).GetKibanaHost), ctx)
 }
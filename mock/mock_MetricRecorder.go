@@ -5,6 +5,7 @@
 package mock
 
 import (
+	o11y "github.com/BaritoLog/barito-blackbox-exporter/o11y"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 )
@@ -33,27 +34,63 @@ func (m *MockMetricRecorder) EXPECT() *MockMetricRecorderMockRecorder {
 }
 
 // IncreasePushLogSuccess mocks base method
-func (m *MockMetricRecorder) IncreasePushLogSuccess(appGroup string) {
+func (m *MockMetricRecorder) IncreasePushLogSuccess(appGroup, router, mode string) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "IncreasePushLogSuccess", appGroup)
+	m.ctrl.Call(m, "IncreasePushLogSuccess", appGroup, router, mode)
 }
 
 // IncreasePushLogSuccess indicates an expected call of IncreasePushLogSuccess
-func (mr *MockMetricRecorderMockRecorder) IncreasePushLogSuccess(appGroup interface{}) *gomock.Call {
+func (mr *MockMetricRecorderMockRecorder) IncreasePushLogSuccess(appGroup, router, mode interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogSuccess", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogSuccess), appGroup)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogSuccess", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogSuccess), appGroup, router, mode)
 }
 
 // IncreasePushLogFailed mocks base method
-func (m *MockMetricRecorder) IncreasePushLogFailed(appGroup string) {
+func (m *MockMetricRecorder) IncreasePushLogFailed(appGroup, router, mode, reason string) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "IncreasePushLogFailed", appGroup)
+	m.ctrl.Call(m, "IncreasePushLogFailed", appGroup, router, mode, reason)
 }
 
 // IncreasePushLogFailed indicates an expected call of IncreasePushLogFailed
-func (mr *MockMetricRecorderMockRecorder) IncreasePushLogFailed(appGroup interface{}) *gomock.Call {
+func (mr *MockMetricRecorderMockRecorder) IncreasePushLogFailed(appGroup, router, mode, reason interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogFailed), appGroup)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogFailed), appGroup, router, mode, reason)
+}
+
+// IncreasePushLogResponse mocks base method
+func (m *MockMetricRecorder) IncreasePushLogResponse(appGroup, router, mode string, statusCode int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreasePushLogResponse", appGroup, router, mode, statusCode)
+}
+
+// IncreasePushLogResponse indicates an expected call of IncreasePushLogResponse
+func (mr *MockMetricRecorderMockRecorder) IncreasePushLogResponse(appGroup, router, mode, statusCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogResponse", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogResponse), appGroup, router, mode, statusCode)
+}
+
+// IncreasePushLogWarning mocks base method
+func (m *MockMetricRecorder) IncreasePushLogWarning(appGroup, router, mode string, count int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreasePushLogWarning", appGroup, router, mode, count)
+}
+
+// IncreasePushLogWarning indicates an expected call of IncreasePushLogWarning
+func (mr *MockMetricRecorderMockRecorder) IncreasePushLogWarning(appGroup, router, mode, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreasePushLogWarning", reflect.TypeOf((*MockMetricRecorder)(nil).IncreasePushLogWarning), appGroup, router, mode, count)
+}
+
+// ObservePushLogTTFB mocks base method
+func (m *MockMetricRecorder) ObservePushLogTTFB(appGroup, router, mode string, second float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ObservePushLogTTFB", appGroup, router, mode, second)
+}
+
+// ObservePushLogTTFB indicates an expected call of ObservePushLogTTFB
+func (mr *MockMetricRecorderMockRecorder) ObservePushLogTTFB(appGroup, router, mode, second interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ObservePushLogTTFB", reflect.TypeOf((*MockMetricRecorder)(nil).ObservePushLogTTFB), appGroup, router, mode, second)
 }
 
 // IncreaseProbeElasticSearchSuccess mocks base method
@@ -80,6 +117,18 @@ func (mr *MockMetricRecorderMockRecorder) IncreaseProbeElasticSearchFailed(appGr
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeElasticSearchFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeElasticSearchFailed), appGroup, reason)
 }
 
+// IncreaseProbeElasticsearchRun mocks base method
+func (m *MockMetricRecorder) IncreaseProbeElasticsearchRun(appGroup, result string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeElasticsearchRun", appGroup, result)
+}
+
+// IncreaseProbeElasticsearchRun indicates an expected call of IncreaseProbeElasticsearchRun
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeElasticsearchRun(appGroup, result interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeElasticsearchRun", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeElasticsearchRun), appGroup, result)
+}
+
 // IncreaseProbeKibanaSuccess mocks base method
 func (m *MockMetricRecorder) IncreaseProbeKibanaSuccess(appGroup string) {
 	m.ctrl.T.Helper()
@@ -104,6 +153,18 @@ func (mr *MockMetricRecorderMockRecorder) IncreaseProbeKibanaFailed(appGroup, re
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeKibanaFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeKibanaFailed), appGroup, reason)
 }
 
+// IncreaseProbeRequestFailed mocks base method
+func (m *MockMetricRecorder) IncreaseProbeRequestFailed(appGroup, probe, reason string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeRequestFailed", appGroup, probe, reason)
+}
+
+// IncreaseProbeRequestFailed indicates an expected call of IncreaseProbeRequestFailed
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeRequestFailed(appGroup, probe, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeRequestFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeRequestFailed), appGroup, probe, reason)
+}
+
 // SetProbeElasticsearchDelay mocks base method
 func (m *MockMetricRecorder) SetProbeElasticsearchDelay(appGroup string, delaySecond float64) {
 	m.ctrl.T.Helper()
@@ -115,3 +176,219 @@ func (mr *MockMetricRecorderMockRecorder) SetProbeElasticsearchDelay(appGroup, d
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProbeElasticsearchDelay", reflect.TypeOf((*MockMetricRecorder)(nil).SetProbeElasticsearchDelay), appGroup, delaySecond)
 }
+
+// SetProbeElasticsearchTook mocks base method
+func (m *MockMetricRecorder) SetProbeElasticsearchTook(appGroup string, tookSecond float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetProbeElasticsearchTook", appGroup, tookSecond)
+}
+
+// SetProbeElasticsearchTook indicates an expected call of SetProbeElasticsearchTook
+func (mr *MockMetricRecorderMockRecorder) SetProbeElasticsearchTook(appGroup, tookSecond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProbeElasticsearchTook", reflect.TypeOf((*MockMetricRecorder)(nil).SetProbeElasticsearchTook), appGroup, tookSecond)
+}
+
+// SetProbeElasticsearchInfo mocks base method
+func (m *MockMetricRecorder) SetProbeElasticsearchInfo(appGroup, distribution, version string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetProbeElasticsearchInfo", appGroup, distribution, version)
+}
+
+// SetProbeElasticsearchInfo indicates an expected call of SetProbeElasticsearchInfo
+func (mr *MockMetricRecorderMockRecorder) SetProbeElasticsearchInfo(appGroup, distribution, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProbeElasticsearchInfo", reflect.TypeOf((*MockMetricRecorder)(nil).SetProbeElasticsearchInfo), appGroup, distribution, version)
+}
+
+// IncreaseProbeIntegritySuccess mocks base method
+func (m *MockMetricRecorder) IncreaseProbeIntegritySuccess(appGroup string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeIntegritySuccess", appGroup)
+}
+
+// IncreaseProbeIntegritySuccess indicates an expected call of IncreaseProbeIntegritySuccess
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeIntegritySuccess(appGroup interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeIntegritySuccess", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeIntegritySuccess), appGroup)
+}
+
+// IncreaseProbeIntegrityFailed mocks base method
+func (m *MockMetricRecorder) IncreaseProbeIntegrityFailed(appGroup, reason string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeIntegrityFailed", appGroup, reason)
+}
+
+// IncreaseProbeIntegrityFailed indicates an expected call of IncreaseProbeIntegrityFailed
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeIntegrityFailed(appGroup, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeIntegrityFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeIntegrityFailed), appGroup, reason)
+}
+
+// IncreaseProbeSequenceMissing mocks base method
+func (m *MockMetricRecorder) IncreaseProbeSequenceMissing(appGroup string, count int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeSequenceMissing", appGroup, count)
+}
+
+// IncreaseProbeSequenceMissing indicates an expected call of IncreaseProbeSequenceMissing
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeSequenceMissing(appGroup, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeSequenceMissing", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeSequenceMissing), appGroup, count)
+}
+
+// IncreaseProbeSequenceDuplicated mocks base method
+func (m *MockMetricRecorder) IncreaseProbeSequenceDuplicated(appGroup string, count int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseProbeSequenceDuplicated", appGroup, count)
+}
+
+// IncreaseProbeSequenceDuplicated indicates an expected call of IncreaseProbeSequenceDuplicated
+func (mr *MockMetricRecorderMockRecorder) IncreaseProbeSequenceDuplicated(appGroup, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseProbeSequenceDuplicated", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseProbeSequenceDuplicated), appGroup, count)
+}
+
+// SetAppGroupInfo mocks base method
+func (m *MockMetricRecorder) SetAppGroupInfo(appGroup string, info o11y.AppGroupInfo) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAppGroupInfo", appGroup, info)
+}
+
+// SetAppGroupInfo indicates an expected call of SetAppGroupInfo
+func (mr *MockMetricRecorderMockRecorder) SetAppGroupInfo(appGroup, info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAppGroupInfo", reflect.TypeOf((*MockMetricRecorder)(nil).SetAppGroupInfo), appGroup, info)
+}
+
+// SetAppGroupTPS mocks base method
+func (m *MockMetricRecorder) SetAppGroupTPS(appGroup string, tps, maxTPS float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAppGroupTPS", appGroup, tps, maxTPS)
+}
+
+// SetAppGroupTPS indicates an expected call of SetAppGroupTPS
+func (mr *MockMetricRecorderMockRecorder) SetAppGroupTPS(appGroup, tps, maxTPS interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAppGroupTPS", reflect.TypeOf((*MockMetricRecorder)(nil).SetAppGroupTPS), appGroup, tps, maxTPS)
+}
+
+// SetAppsTPS mocks base method
+func (m *MockMetricRecorder) SetAppsTPS(appGroup string, apps []o11y.AppTPS) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAppsTPS", appGroup, apps)
+}
+
+// SetAppsTPS indicates an expected call of SetAppsTPS
+func (mr *MockMetricRecorderMockRecorder) SetAppsTPS(appGroup, apps interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAppsTPS", reflect.TypeOf((*MockMetricRecorder)(nil).SetAppsTPS), appGroup, apps)
+}
+
+// SetAppLastLogAge mocks base method
+func (m *MockMetricRecorder) SetAppLastLogAge(appGroup, app string, ageSecond, maxStalenessSecond float64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetAppLastLogAge", appGroup, app, ageSecond, maxStalenessSecond)
+}
+
+// SetAppLastLogAge indicates an expected call of SetAppLastLogAge
+func (mr *MockMetricRecorderMockRecorder) SetAppLastLogAge(appGroup, app, ageSecond, maxStalenessSecond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAppLastLogAge", reflect.TypeOf((*MockMetricRecorder)(nil).SetAppLastLogAge), appGroup, app, ageSecond, maxStalenessSecond)
+}
+
+// IncreaseDiscoverySuccess mocks base method
+func (m *MockMetricRecorder) IncreaseDiscoverySuccess(source string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseDiscoverySuccess", source)
+}
+
+// IncreaseDiscoverySuccess indicates an expected call of IncreaseDiscoverySuccess
+func (mr *MockMetricRecorderMockRecorder) IncreaseDiscoverySuccess(source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseDiscoverySuccess", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseDiscoverySuccess), source)
+}
+
+// IncreaseDiscoveryFailed mocks base method
+func (m *MockMetricRecorder) IncreaseDiscoveryFailed(source string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseDiscoveryFailed", source)
+}
+
+// IncreaseDiscoveryFailed indicates an expected call of IncreaseDiscoveryFailed
+func (mr *MockMetricRecorderMockRecorder) IncreaseDiscoveryFailed(source interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseDiscoveryFailed", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseDiscoveryFailed), source)
+}
+
+// SetDiscoveredAppGroups mocks base method
+func (m *MockMetricRecorder) SetDiscoveredAppGroups(source string, count int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetDiscoveredAppGroups", source, count)
+}
+
+// SetDiscoveredAppGroups indicates an expected call of SetDiscoveredAppGroups
+func (mr *MockMetricRecorderMockRecorder) SetDiscoveredAppGroups(source, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDiscoveredAppGroups", reflect.TypeOf((*MockMetricRecorder)(nil).SetDiscoveredAppGroups), source, count)
+}
+
+// IncreaseUpstreamRetry mocks base method
+func (m *MockMetricRecorder) IncreaseUpstreamRetry(upstream string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseUpstreamRetry", upstream)
+}
+
+// IncreaseUpstreamRetry indicates an expected call of IncreaseUpstreamRetry
+func (mr *MockMetricRecorderMockRecorder) IncreaseUpstreamRetry(upstream interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseUpstreamRetry", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseUpstreamRetry), upstream)
+}
+
+// IncreaseUpstreamRejected mocks base method
+func (m *MockMetricRecorder) IncreaseUpstreamRejected(upstream string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "IncreaseUpstreamRejected", upstream)
+}
+
+// IncreaseUpstreamRejected indicates an expected call of IncreaseUpstreamRejected
+func (mr *MockMetricRecorderMockRecorder) IncreaseUpstreamRejected(upstream interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseUpstreamRejected", reflect.TypeOf((*MockMetricRecorder)(nil).IncreaseUpstreamRejected), upstream)
+}
+
+// SetUpstreamCircuitOpen mocks base method
+func (m *MockMetricRecorder) SetUpstreamCircuitOpen(upstream, host string, open bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetUpstreamCircuitOpen", upstream, host, open)
+}
+
+// SetUpstreamCircuitOpen indicates an expected call of SetUpstreamCircuitOpen
+func (mr *MockMetricRecorderMockRecorder) SetUpstreamCircuitOpen(upstream, host, open interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUpstreamCircuitOpen", reflect.TypeOf((*MockMetricRecorder)(nil).SetUpstreamCircuitOpen), upstream, host, open)
+}
+
+// SetProbePaused mocks base method
+func (m *MockMetricRecorder) SetProbePaused(appGroup, probe string, paused bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetProbePaused", appGroup, probe, paused)
+}
+
+// SetProbePaused indicates an expected call of SetProbePaused
+func (mr *MockMetricRecorderMockRecorder) SetProbePaused(appGroup, probe, paused interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProbePaused", reflect.TypeOf((*MockMetricRecorder)(nil).SetProbePaused), appGroup, probe, paused)
+}
+
+// DeleteAppGroup mocks base method
+func (m *MockMetricRecorder) DeleteAppGroup(appGroup string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DeleteAppGroup", appGroup)
+}
+
+// DeleteAppGroup indicates an expected call of DeleteAppGroup
+func (mr *MockMetricRecorderMockRecorder) DeleteAppGroup(appGroup interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAppGroup", reflect.TypeOf((*MockMetricRecorder)(nil).DeleteAppGroup), appGroup)
+}
@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/logging"
+)
+
+const (
+	PROBE_PUSH                = "push"
+	PROBE_ELASTICSEARCH       = "elasticsearch"
+	PROBE_ELASTICSEARCH_DELAY = "elasticsearch_delay"
+	PROBE_KIBANA              = "kibana"
+
+	STATUS_FIRING   = "firing"
+	STATUS_RESOLVED = "resolved"
+
+	// reason of the resolve sent for an app group no longer probed
+	REASON_APP_GROUP_REMOVED = "app_group_removed"
+)
+
+type Event struct {
+	AppGroup string    `json:"app_group"`
+	Probe    string    `json:"probe"`
+	Status   string    `json:"status"`
+	Reason   string    `json:"reason,omitempty"`
+	Failures int       `json:"consecutive_failures,omitempty"`
+	Delay    float64   `json:"delay_second,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func (e Event) Message() string {
+	if e.Status == STATUS_RESOLVED && e.Reason == REASON_APP_GROUP_REMOVED {
+		return fmt.Sprintf("[RESOLVED] %s probe on app group %q stopped, the app group is no longer probed", e.Probe, e.AppGroup)
+	}
+	if e.Status == STATUS_RESOLVED {
+		return fmt.Sprintf("[RESOLVED] %s probe on app group %q recovered", e.Probe, e.AppGroup)
+	}
+	if e.Probe == PROBE_ELASTICSEARCH_DELAY {
+		return fmt.Sprintf("[FIRING] ingestion delay on app group %q is %.0f seconds", e.AppGroup, e.Delay)
+	}
+	return fmt.Sprintf("[FIRING] %s probe on app group %q failed %d times in a row, reason: %q", e.Probe, e.AppGroup, e.Failures, e.Reason)
+}
+
+type alertState struct {
+	failures int
+	firing   bool
+}
+
+type Notifier struct {
+	webhooks         []Webhook
+	failureThreshold int
+	delayThreshold   float64
+
+	mu     sync.Mutex
+	states map[string]map[string]*alertState
+}
+
+func NewNotifier(webhooks []Webhook, failureThreshold int, delayThreshold time.Duration) *Notifier {
+	return &Notifier{
+		webhooks:         webhooks,
+		failureThreshold: failureThreshold,
+		delayThreshold:   delayThreshold.Seconds(),
+		states:           map[string]map[string]*alertState{},
+	}
+}
+
+// ObserveSuccess resets the failure streak of the probe, and sends a resolve
+// notification if it was firing.
+func (n *Notifier) ObserveSuccess(appGroup, probe string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.getState(appGroup, probe)
+	s.failures = 0
+	if s.firing {
+		s.firing = false
+		n.notify(Event{AppGroup: appGroup, Probe: probe, Status: STATUS_RESOLVED, Time: time.Now()})
+	}
+}
+
+// ObserveFailure fires once the probe has failed failureThreshold times in a
+// row, further failures are not notified until the probe is resolved.
+func (n *Notifier) ObserveFailure(appGroup, probe, reason string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.getState(appGroup, probe)
+	s.failures++
+	if !s.firing && s.failures >= n.failureThreshold {
+		s.firing = true
+		n.notify(Event{AppGroup: appGroup, Probe: probe, Status: STATUS_FIRING, Reason: reason, Failures: s.failures, Time: time.Now()})
+	}
+}
+
+func (n *Notifier) ObserveDelay(appGroup string, delaySecond float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.getState(appGroup, PROBE_ELASTICSEARCH_DELAY)
+	if !s.firing && delaySecond > n.delayThreshold {
+		s.firing = true
+		n.notify(Event{AppGroup: appGroup, Probe: PROBE_ELASTICSEARCH_DELAY, Status: STATUS_FIRING, Delay: delaySecond, Time: time.Now()})
+	} else if s.firing && delaySecond <= n.delayThreshold {
+		s.firing = false
+		n.notify(Event{AppGroup: appGroup, Probe: PROBE_ELASTICSEARCH_DELAY, Status: STATUS_RESOLVED, Delay: delaySecond, Time: time.Now()})
+	}
+}
+
+// Forget drops the states of an app group no longer probed, sending a
+// resolve for its probes still firing, which would never recover.
+func (n *Notifier) Forget(appGroup string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for probe, s := range n.states[appGroup] {
+		if s.firing {
+			n.notify(Event{AppGroup: appGroup, Probe: probe, Status: STATUS_RESOLVED, Reason: REASON_APP_GROUP_REMOVED, Time: time.Now()})
+		}
+	}
+	delete(n.states, appGroup)
+}
+
+func (n *Notifier) getState(appGroup, probe string) *alertState {
+	probes, ok := n.states[appGroup]
+	if !ok {
+		probes = map[string]*alertState{}
+		n.states[appGroup] = probes
+	}
+	s, ok := probes[probe]
+	if !ok {
+		s = &alertState{}
+		probes[probe] = s
+	}
+	return s
+}
+
+// notify sends in the background so a slow webhook never delays a probe.
+func (n *Notifier) notify(e Event) {
+	for _, w := range n.webhooks {
+		go func(w Webhook) {
+			if err := w.Send(e); err != nil {
+				logging.For(e.AppGroup, e.Probe).WithError(err).Error("Failed to send notification")
+			}
+		}(w)
+	}
+}
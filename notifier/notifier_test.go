@@ -0,0 +1,198 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+type fakeWebhook struct {
+	events chan Event
+}
+
+func (f *fakeWebhook) Send(e Event) error {
+	f.events <- e
+	return nil
+}
+
+func receiveEvents(t *testing.T, events chan Event, n int) []Event {
+	result := []Event{}
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-events:
+			result = append(result, e)
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Should receive %d events, got: %d", n, len(result))
+		}
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("Should not receive more than %d events, got extra: %+v", n, e)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return result
+}
+
+func TestNotifier_firingAfterThresholdAndResolve(t *testing.T) {
+	w := &fakeWebhook{events: make(chan Event, 10)}
+	n := NewNotifier([]Webhook{w}, 3, 10*time.Second)
+
+	n.ObserveFailure("lama", PROBE_KIBANA, "request_failed")
+	n.ObserveFailure("lama", PROBE_KIBANA, "request_failed")
+	receiveEvents(t, w.events, 0)
+
+	// fire once, the following failures are de-duplicated
+	n.ObserveFailure("lama", PROBE_KIBANA, "request_failed")
+	n.ObserveFailure("lama", PROBE_KIBANA, "request_failed")
+	events := receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_FIRING || events[0].Failures != 3 || events[0].Reason != "request_failed" {
+		t.Errorf("Should fire after 3 failures, got: %+v", events[0])
+	}
+
+	n.ObserveSuccess("lama", PROBE_KIBANA)
+	n.ObserveSuccess("lama", PROBE_KIBANA)
+	events = receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_RESOLVED || events[0].Probe != PROBE_KIBANA {
+		t.Errorf("Should resolve on first success, got: %+v", events[0])
+	}
+}
+
+func TestNotifier_successResetsFailureStreak(t *testing.T) {
+	w := &fakeWebhook{events: make(chan Event, 10)}
+	n := NewNotifier([]Webhook{w}, 2, 10*time.Second)
+
+	n.ObserveFailure("lama", PROBE_PUSH, "")
+	n.ObserveSuccess("lama", PROBE_PUSH)
+	n.ObserveFailure("lama", PROBE_PUSH, "")
+	n.ObserveFailure("unta", PROBE_PUSH, "")
+	receiveEvents(t, w.events, 0)
+}
+
+func TestNotifier_delay(t *testing.T) {
+	w := &fakeWebhook{events: make(chan Event, 10)}
+	n := NewNotifier([]Webhook{w}, 3, 10*time.Second)
+
+	n.ObserveDelay("lama", 5)
+	n.ObserveDelay("lama", 11)
+	n.ObserveDelay("lama", 12)
+	events := receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_FIRING || events[0].Delay != 11 {
+		t.Errorf("Should fire when delay exceed threshold, got: %+v", events[0])
+	}
+
+	n.ObserveDelay("lama", 3)
+	events = receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_RESOLVED {
+		t.Errorf("Should resolve when delay back under threshold, got: %+v", events[0])
+	}
+}
+
+func TestNotifier_forget(t *testing.T) {
+	w := &fakeWebhook{events: make(chan Event, 10)}
+	n := NewNotifier([]Webhook{w}, 1, 10*time.Second)
+
+	n.ObserveFailure("lama", PROBE_KIBANA, "request_failed")
+	n.ObserveFailure("lama", PROBE_PUSH, "timeout")
+	n.ObserveSuccess("lama", PROBE_PUSH)
+	n.ObserveFailure("unta", PROBE_KIBANA, "request_failed")
+	receiveEvents(t, w.events, 4)
+
+	n.Forget("lama")
+	events := receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_RESOLVED || events[0].Probe != PROBE_KIBANA || events[0].Reason != REASON_APP_GROUP_REMOVED {
+		t.Errorf("Should resolve the probe still firing, got: %+v", events[0])
+	}
+	if _, ok := n.states["lama"]; ok || len(n.states) != 1 {
+		t.Errorf("Should forget the states of the app group, got: %v", n.states)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Should send json, got content type: %q", r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		payload := map[string]interface{}{}
+		json.Unmarshal(body, &payload)
+		bodies <- payload
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	e := Event{AppGroup: "lama", Probe: PROBE_PUSH, Status: STATUS_FIRING, Failures: 3, Time: time.Unix(0, 0).UTC()}
+	if err := NewSlackWebhook(srv.URL, time.Second).Send(e); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	expectedSlack := map[string]interface{}{"text": e.Message()}
+	if got := <-bodies; !reflect.DeepEqual(got, expectedSlack) {
+		t.Errorf("Invalid slack payload, want:\n%v\ngot:\n%v", expectedSlack, got)
+	}
+
+	if err := NewJSONWebhook(srv.URL, time.Second).Send(e); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	expectedJSON := map[string]interface{}{
+		"app_group":            "lama",
+		"probe":                "push",
+		"status":               "firing",
+		"consecutive_failures": float64(3),
+		"time":                 "1970-01-01T00:00:00Z",
+	}
+	if got := <-bodies; !reflect.DeepEqual(got, expectedJSON) {
+		t.Errorf("Invalid json payload, want:\n%v\ngot:\n%v", expectedJSON, got)
+	}
+}
+
+func TestWebhook_non2xxShouldReturnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	err := NewJSONWebhook(srv.URL, time.Second).Send(Event{})
+	if err == nil {
+		t.Errorf("Should return error on non 2xx response")
+	}
+}
+
+func TestRecorder_elasticsearchRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED).Times(3)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED).Times(3)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS)
+
+	w := &fakeWebhook{events: make(chan Event, 10)}
+	r := NewRecorder(mr, NewNotifier([]Webhook{w}, 3, 10*time.Second))
+
+	// a run with 3 ES down
+	for i := 0; i < 3; i++ {
+		r.IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+	}
+	r.IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+	receiveEvents(t, w.events, 0)
+
+	r.IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+	r.IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+	events := receiveEvents(t, w.events, 1)
+	if events[0].Status != STATUS_FIRING || events[0].Probe != PROBE_ELASTICSEARCH || events[0].Failures != 3 {
+		t.Errorf("Should fire after 3 failed runs, got: %+v", events[0])
+	}
+
+	r.IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS)
+	if events := receiveEvents(t, w.events, 1); events[0].Status != STATUS_RESOLVED {
+		t.Errorf("Should resolve on a successful run, got: %+v", events[0])
+	}
+}
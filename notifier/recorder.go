@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+// Recorder feeds probe results to the notifier while still recording them
+// to the wrapped MetricRecorder, so agents don't need to know about it.
+type Recorder struct {
+	o11y.MetricRecorder
+	notifier *Notifier
+}
+
+func NewRecorder(mR o11y.MetricRecorder, n *Notifier) *Recorder {
+	return &Recorder{
+		MetricRecorder: mR,
+		notifier:       n,
+	}
+}
+
+func (r *Recorder) IncreasePushLogSuccess(appGroup, router, mode string) {
+	r.MetricRecorder.IncreasePushLogSuccess(appGroup, router, mode)
+	r.notifier.ObserveSuccess(appGroup, pushProbe(router, mode))
+}
+
+func (r *Recorder) IncreasePushLogFailed(appGroup, router, mode, reason string) {
+	r.MetricRecorder.IncreasePushLogFailed(appGroup, router, mode, reason)
+	r.notifier.ObserveFailure(appGroup, pushProbe(router, mode), reason)
+}
+
+// pushProbe tracks each router and push mode on its own, one failing while
+// another one succeeds would never reach the threshold otherwise.
+func pushProbe(router, mode string) string {
+	probe := PROBE_PUSH
+	if mode != "" {
+		probe += "_" + mode
+	}
+	if router != "" {
+		probe += "@" + router
+	}
+	return probe
+}
+
+// IncreaseProbeElasticsearchRun observes each run rather than each ES
+// failing, so an app group with several ES down doesn't fire after fewer
+// runs than the threshold.
+func (r *Recorder) IncreaseProbeElasticsearchRun(appGroup, result string) {
+	r.MetricRecorder.IncreaseProbeElasticsearchRun(appGroup, result)
+	if result == o11y.RESULT_SUCCESS {
+		r.notifier.ObserveSuccess(appGroup, PROBE_ELASTICSEARCH)
+	} else {
+		r.notifier.ObserveFailure(appGroup, PROBE_ELASTICSEARCH, result)
+	}
+}
+
+func (r *Recorder) IncreaseProbeKibanaSuccess(appGroup string) {
+	r.MetricRecorder.IncreaseProbeKibanaSuccess(appGroup)
+	r.notifier.ObserveSuccess(appGroup, PROBE_KIBANA)
+}
+
+func (r *Recorder) IncreaseProbeKibanaFailed(appGroup, reason string) {
+	r.MetricRecorder.IncreaseProbeKibanaFailed(appGroup, reason)
+	r.notifier.ObserveFailure(appGroup, PROBE_KIBANA, reason)
+}
+
+func (r *Recorder) SetProbeElasticsearchDelay(appGroup string, delaySecond float64) {
+	r.MetricRecorder.SetProbeElasticsearchDelay(appGroup, delaySecond)
+	r.notifier.ObserveDelay(appGroup, delaySecond)
+}
+
+func (r *Recorder) DeleteAppGroup(appGroup string) {
+	r.MetricRecorder.DeleteAppGroup(appGroup)
+	r.notifier.Forget(appGroup)
+}
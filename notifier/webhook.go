@@ -0,0 +1,76 @@
+package notifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Webhook interface {
+	Send(e Event) error
+}
+
+type slackWebhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackWebhook sends events as a Slack incoming webhook message, which is
+// also understood by most chat tools exposing a Slack-compatible endpoint.
+func NewSlackWebhook(url string, timeout time.Duration) *slackWebhook {
+	return &slackWebhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *slackWebhook) Send(e Event) error {
+	body, err := json.Marshal(map[string]string{"text": e.Message()})
+	if err != nil {
+		return err
+	}
+	return postJSON(s.client, s.url, body)
+}
+
+type jsonWebhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewJSONWebhook sends the event as is, for receivers that want to route on
+// its fields rather than parse a message.
+func NewJSONWebhook(url string, timeout time.Duration) *jsonWebhook {
+	return &jsonWebhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (j *jsonWebhook) Send(e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return postJSON(j.client, j.url, body)
+}
+
+func postJSON(c *http.Client, url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(body)))
+	if err != nil {
+		return errors.New("failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Got response status %d", resp.StatusCode)
+	}
+	return nil
+}
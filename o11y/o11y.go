@@ -1,38 +1,157 @@
 package o11y
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 const (
 	REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL = "failed_get_list_from_consul"
-	REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND      = "no_elasticsearch_found"
 	REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED              = "request_failed"
 	REASON_PROBE_ELASTICSEARCH_GET_DATA_FAILED             = "get_data_failed"
+	REASON_PROBE_ELASTICSEARCH_NO_ELASTICSEARCH_FOUND      = "no_elasticsearch_found"
 	REASON_PROBE_ELASTICSEARCH_FAILED_FETCH_METADATA       = "failed_fetch_metadata"
-	REASON_PROBE_KIBANA_REQUEST_FAILED                     = "request_failed"
+	REASON_PROBE_ELASTICSEARCH_NO_DATA                     = "no_data"
 	REASON_PROBE_KIBANA_FAILED_GET_KIBANA_FROM_CONSUL      = "failed_get_kibana_from_consul"
 	REASON_PROBE_KIBANA_FAILED_FETCH_METADATA              = "failed_fetch_metadata"
+	REASON_PROBE_KIBANA_REQUEST_FAILED                     = "request_failed"
 	REASON_PROBE_KIBANA_NO_KIBANA_FOUND                    = "no_kibana_found"
+
+	// result of an ES probe run finding the latest probe log, else the run
+	// is counted by the reason of its last failure
+	RESULT_SUCCESS = "success"
+
+	// reasons of a failed request, shared by all probes. The ES & Kibana
+	// failed counters keep request_failed, these go to
+	// barito_probe_request_failed.
+	REASON_DNS             = "dns"
+	REASON_CONNECT_REFUSED = "connect_refused"
+	REASON_TLS             = "tls"
+	REASON_TIMEOUT         = "timeout"
+	REASON_HTTP_4XX        = "http_4xx"
+	REASON_HTTP_5XX        = "http_5xx"
+	REASON_AUTH            = "auth"
+	REASON_PARSE           = "parse"
+	REASON_CIRCUIT_OPEN    = "circuit_open"
+	REASON_RATE_LIMITED    = "rate_limited"
+	REASON_REJECTED        = "rejected"
+	REASON_REQUEST_FAILED  = "request_failed"
+
+	// reasons of a probe log not coming back from ES as it was pushed
+	REASON_INTEGRITY_MISSING_CHECKSUM = "missing_checksum"
+	REASON_INTEGRITY_DROPPED_FIELD    = "dropped_field"
+	REASON_INTEGRITY_MANGLED_FIELD    = "mangled_field"
+	REASON_INTEGRITY_MAPPING_TYPE     = "mapping_type"
+
+	PROBE_PUSH          = "push"
+	PROBE_ELASTICSEARCH = "elasticsearch"
+	PROBE_KIBANA        = "kibana"
+	PROBE_METADATA      = "metadata"
+
+	PUSH_MODE_BATCH       = "batch"
+	PUSH_MODE_BATCH_GZIP  = "batch_gzip"
+	PUSH_MODE_SINGLE      = "single"
+	PUSH_MODE_SINGLE_GZIP = "single_gzip"
+
+	DISCOVERY_SOURCE_BARITO_MARKET = "barito_market"
+
+	UPSTREAM_BARITO_MARKET = "barito_market"
+	UPSTREAM_CONSUL        = "consul"
+	UPSTREAM_ROUTER        = "router"
+	UPSTREAM_ELASTICSEARCH = "elasticsearch"
+	UPSTREAM_KIBANA        = "kibana"
 )
 
+type AppGroupInfo struct {
+	Name        string
+	Capacity    string
+	Status      string
+	Retention   string
+	Environment string
+}
+
+type AppTPS struct {
+	Name   string
+	TPS    float64
+	MaxTPS float64
+}
+
 type MetricRecorder interface {
-	IncreasePushLogSuccess(appGroup string)
-	IncreasePushLogFailed(appGroup string)
+	IncreasePushLogSuccess(appGroup, router, mode string)
+	IncreasePushLogFailed(appGroup, router, mode, reason string)
+	IncreasePushLogResponse(appGroup, router, mode string, statusCode int)
+	IncreasePushLogWarning(appGroup, router, mode string, count int)
+	ObservePushLogTTFB(appGroup, router, mode string, second float64)
 	IncreaseProbeElasticSearchSuccess(appGroup string)
 	IncreaseProbeElasticSearchFailed(appGroup, reason string)
+	IncreaseProbeElasticsearchRun(appGroup, result string)
 	IncreaseProbeKibanaSuccess(appGroup string)
 	IncreaseProbeKibanaFailed(appGroup, reason string)
+	IncreaseProbeRequestFailed(appGroup, probe, reason string)
 	SetProbeElasticsearchDelay(appGroup string, delaySecond float64)
+	SetProbeElasticsearchTook(appGroup string, tookSecond float64)
+	SetProbeElasticsearchInfo(appGroup, distribution, version string)
+	IncreaseProbeIntegritySuccess(appGroup string)
+	IncreaseProbeIntegrityFailed(appGroup, reason string)
+	IncreaseProbeSequenceMissing(appGroup string, count int)
+	IncreaseProbeSequenceDuplicated(appGroup string, count int)
+	SetAppGroupInfo(appGroup string, info AppGroupInfo)
+	SetAppGroupTPS(appGroup string, tps, maxTPS float64)
+	SetAppsTPS(appGroup string, apps []AppTPS)
+	SetAppLastLogAge(appGroup, app string, ageSecond, maxStalenessSecond float64)
+	IncreaseDiscoverySuccess(source string)
+	IncreaseDiscoveryFailed(source string)
+	SetDiscoveredAppGroups(source string, count int)
+	IncreaseUpstreamRetry(upstream string)
+	IncreaseUpstreamRejected(upstream string)
+	SetUpstreamCircuitOpen(upstream, host string, open bool)
+	SetProbePaused(appGroup, probe string, paused bool)
+	DeleteAppGroup(appGroup string)
 }
 
 type metricRecorder struct {
 	registry                        *prometheus.Registry
 	metricPushLogSuccess            *prometheus.CounterVec
 	metricPushLogFailed             *prometheus.CounterVec
+	metricPushLogResponse           *prometheus.CounterVec
+	metricPushLogWarning            *prometheus.CounterVec
+	metricPushLogTTFB               *prometheus.HistogramVec
 	metricProbeElasticSearchSuccess *prometheus.CounterVec
 	metricProbeElasticSearchFailed  *prometheus.CounterVec
+	metricProbeElasticRun           *prometheus.CounterVec
 	metricProbeElasticDelaySecond   *prometheus.GaugeVec
+	metricProbeElasticTookSecond    *prometheus.GaugeVec
+	metricProbeElasticInfo          *prometheus.GaugeVec
+	metricProbeIntegritySuccess     *prometheus.CounterVec
+	metricProbeIntegrityFailed      *prometheus.CounterVec
+	metricProbeSequenceMissing      *prometheus.CounterVec
+	metricProbeSequenceDuplicated   *prometheus.CounterVec
 	metricProbeKibanaSuccess        *prometheus.CounterVec
 	metricProbeKibanaFailed         *prometheus.CounterVec
+	metricProbeRequestFailed        *prometheus.CounterVec
+	metricProbeLastSuccess          *prometheus.GaugeVec
+	metricAppGroupInfo              *prometheus.GaugeVec
+	metricAppGroupTPS               *prometheus.GaugeVec
+	metricAppGroupMaxTPS            *prometheus.GaugeVec
+	metricAppGroupCapacityUsage     *prometheus.GaugeVec
+	metricAppTPS                    *prometheus.GaugeVec
+	metricAppMaxTPS                 *prometheus.GaugeVec
+	metricAppLastLogAge             *prometheus.GaugeVec
+	metricAppLogMaxStaleness        *prometheus.GaugeVec
+	metricDiscoverySuccess          *prometheus.CounterVec
+	metricDiscoveryFailed           *prometheus.CounterVec
+	metricDiscoveredAppGroups       *prometheus.GaugeVec
+	metricUpstreamRetry             *prometheus.CounterVec
+	metricUpstreamRejected          *prometheus.CounterVec
+	metricUpstreamCircuitOpen       *prometheus.GaugeVec
+	metricProbePaused               *prometheus.GaugeVec
+
+	mu           sync.Mutex
+	appGroupInfo map[string]AppGroupInfo
+	appNames     map[string][]string
+	esInfo       map[string][2]string
 }
 
 func NewMetricRecorder() *metricRecorder {
@@ -42,13 +161,32 @@ func NewMetricRecorder() *metricRecorder {
 		prometheus.CounterOpts{
 			Name: "barito_push_log_success",
 			Help: "Number push log success",
-		}, []string{"app_group"},
+		}, []string{"app_group", "router", "mode"},
 	)
 	metricPushLogFailed := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "barito_push_log_failed",
 			Help: "Number push log failed",
-		}, []string{"app_group"},
+		}, []string{"app_group", "router", "mode", "reason"},
+	)
+	metricPushLogResponse := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_push_log_response",
+			Help: "Number push log response by status code, including retried ones",
+		}, []string{"app_group", "router", "mode", "code"},
+	)
+	metricPushLogWarning := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_push_log_warning",
+			Help: "Number of warnings in push log responses accepted by the router",
+		}, []string{"app_group", "router", "mode"},
+	)
+	metricPushLogTTFB := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "barito_push_log_ttfb_seconds",
+			Help:    "Time between sending a push log request and the first byte of its response",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"app_group", "router", "mode"},
 	)
 	metricProbeElasticSearchSuccess := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -68,6 +206,42 @@ func NewMetricRecorder() *metricRecorder {
 			Help: "Number of second the delay between current time and last log time",
 		}, []string{"app_group"},
 	)
+	metricProbeElasticTookSecond := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_probe_elasticsearch_took_second",
+			Help: "Number of second elasticsearch took to run the probe query",
+		}, []string{"app_group"},
+	)
+	metricProbeElasticInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_probe_elasticsearch_info",
+			Help: "Distribution and version of the elasticsearch of an app group, always 1",
+		}, []string{"app_group", "distribution", "version"},
+	)
+	metricProbeIntegritySuccess := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_integrity_success",
+			Help: "Number of probe logs found in elasticsearch as they were pushed",
+		}, []string{"app_group"},
+	)
+	metricProbeIntegrityFailed := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_integrity_failed",
+			Help: "Number of probe logs found in elasticsearch with dropped, mangled or mistyped fields",
+		}, []string{"app_group", "reason"},
+	)
+	metricProbeSequenceMissing := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_sequence_missing",
+			Help: "Number of probe logs pushed but not found in elasticsearch, by their sequence number",
+		}, []string{"app_group"},
+	)
+	metricProbeSequenceDuplicated := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_sequence_duplicated",
+			Help: "Number of probe logs found more than once in elasticsearch, by their sequence number",
+		}, []string{"app_group"},
+	)
 	metricProbeKibanaSuccess := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "barito_probe_kibana_success",
@@ -80,40 +254,219 @@ func NewMetricRecorder() *metricRecorder {
 			Help: "Number probe kibana failed",
 		}, []string{"app_group", "reason"},
 	)
+	metricProbeElasticRun := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_elasticsearch_run",
+			Help: "Number probe elasticsearch runs, once per cycle however many elasticsearch were tried, by result: success or the reason of the last failure",
+		}, []string{"app_group", "result"},
+	)
+	metricProbeRequestFailed := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_probe_request_failed",
+			Help: "Number of failed ES & Kibana probe requests, by reason",
+		}, []string{"app_group", "probe", "reason"},
+	)
+	metricProbeLastSuccess := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_probe_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful probe",
+		}, []string{"app_group", "probe"},
+	)
+	metricAppGroupInfo := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_appgroup_info",
+			Help: "App group metadata from BaritoMarket, always 1",
+		}, []string{"app_group", "name", "capacity", "status", "retention", "environment"},
+	)
+	metricAppGroupTPS := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_appgroup_tps",
+			Help: "Current throughput of the app group reported by BaritoMarket",
+		}, []string{"app_group"},
+	)
+	metricAppGroupMaxTPS := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_appgroup_max_tps",
+			Help: "Throughput quota of the app group configured on BaritoMarket",
+		}, []string{"app_group"},
+	)
+	metricAppGroupCapacityUsage := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_appgroup_capacity_usage_ratio",
+			Help: "Ratio between current throughput and throughput quota of the app group",
+		}, []string{"app_group"},
+	)
+	metricAppTPS := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_app_tps",
+			Help: "Current throughput of the app reported by BaritoMarket",
+		}, []string{"app_group", "app"},
+	)
+	metricAppMaxTPS := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_app_max_tps",
+			Help: "Throughput quota of the app configured on BaritoMarket",
+		}, []string{"app_group", "app"},
+	)
+	metricAppLastLogAge := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_app_last_log_age_seconds",
+			Help: "Number of second since the latest log of an app, +Inf when there's none within the lookback",
+		}, []string{"app_group", "app"},
+	)
+	metricAppLogMaxStaleness := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_app_log_max_staleness_seconds",
+			Help: "Number of second an app can go without a log before it's stale",
+		}, []string{"app_group", "app"},
+	)
+	metricDiscoverySuccess := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_discovery_success",
+			Help: "Number app group discovery success",
+		}, []string{"source"},
+	)
+	metricDiscoveryFailed := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_discovery_failed",
+			Help: "Number app group discovery failed, including the ones returning partial results",
+		}, []string{"source"},
+	)
+	metricDiscoveredAppGroups := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_discovery_app_groups",
+			Help: "Number of app groups found on the last discovery",
+		}, []string{"source"},
+	)
+	metricUpstreamRetry := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_upstream_retry",
+			Help: "Number of calls to an upstream retried",
+		}, []string{"upstream"},
+	)
+	metricUpstreamRejected := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "barito_upstream_rejected",
+			Help: "Number of calls to an upstream not made because its circuit breaker is open",
+		}, []string{"upstream"},
+	)
+	metricUpstreamCircuitOpen := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_upstream_circuit_open",
+			Help: "Whether the circuit breaker of an upstream host is open, 1 when open",
+		}, []string{"upstream", "host"},
+	)
+	metricProbePaused := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "barito_probe_paused",
+			Help: "Whether a probe of an app group is paused from the admin API, 1 when paused",
+		}, []string{"app_group", "probe"},
+	)
 
 	r.MustRegister(metricPushLogSuccess)
 	r.MustRegister(metricPushLogFailed)
+	r.MustRegister(metricPushLogResponse)
+	r.MustRegister(metricPushLogWarning)
+	r.MustRegister(metricPushLogTTFB)
 	r.MustRegister(metricProbeElasticSearchSuccess)
 	r.MustRegister(metricProbeElasticSearchFailed)
 	r.MustRegister(metricProbeElasticDelaySecond)
+	r.MustRegister(metricProbeElasticTookSecond)
+	r.MustRegister(metricProbeElasticInfo)
+	r.MustRegister(metricProbeIntegritySuccess)
+	r.MustRegister(metricProbeIntegrityFailed)
+	r.MustRegister(metricProbeSequenceMissing)
+	r.MustRegister(metricProbeSequenceDuplicated)
 	r.MustRegister(metricProbeKibanaSuccess)
 	r.MustRegister(metricProbeKibanaFailed)
+	r.MustRegister(metricProbeElasticRun)
+	r.MustRegister(metricProbeRequestFailed)
+	r.MustRegister(metricProbeLastSuccess)
+	r.MustRegister(metricAppGroupInfo)
+	r.MustRegister(metricAppGroupTPS)
+	r.MustRegister(metricAppGroupMaxTPS)
+	r.MustRegister(metricAppGroupCapacityUsage)
+	r.MustRegister(metricAppTPS)
+	r.MustRegister(metricAppMaxTPS)
+	r.MustRegister(metricAppLastLogAge)
+	r.MustRegister(metricAppLogMaxStaleness)
+	r.MustRegister(metricDiscoverySuccess)
+	r.MustRegister(metricDiscoveryFailed)
+	r.MustRegister(metricDiscoveredAppGroups)
+	r.MustRegister(metricUpstreamRetry)
+	r.MustRegister(metricUpstreamRejected)
+	r.MustRegister(metricUpstreamCircuitOpen)
+	r.MustRegister(metricProbePaused)
 
 	return &metricRecorder{
 		registry:                        r,
 		metricPushLogSuccess:            metricPushLogSuccess,
 		metricPushLogFailed:             metricPushLogFailed,
+		metricPushLogResponse:           metricPushLogResponse,
+		metricPushLogWarning:            metricPushLogWarning,
+		metricPushLogTTFB:               metricPushLogTTFB,
 		metricProbeElasticSearchSuccess: metricProbeElasticSearchSuccess,
 		metricProbeElasticSearchFailed:  metricProbeElasticSearchFailed,
 		metricProbeElasticDelaySecond:   metricProbeElasticDelaySecond,
+		metricProbeElasticTookSecond:    metricProbeElasticTookSecond,
+		metricProbeElasticInfo:          metricProbeElasticInfo,
+		metricProbeIntegritySuccess:     metricProbeIntegritySuccess,
+		metricProbeIntegrityFailed:      metricProbeIntegrityFailed,
+		metricProbeSequenceMissing:      metricProbeSequenceMissing,
+		metricProbeSequenceDuplicated:   metricProbeSequenceDuplicated,
 		metricProbeKibanaSuccess:        metricProbeKibanaSuccess,
 		metricProbeKibanaFailed:         metricProbeKibanaFailed,
+		metricProbeElasticRun:           metricProbeElasticRun,
+		metricProbeRequestFailed:        metricProbeRequestFailed,
+		metricProbeLastSuccess:          metricProbeLastSuccess,
+		metricAppGroupInfo:              metricAppGroupInfo,
+		metricAppGroupTPS:               metricAppGroupTPS,
+		metricAppGroupMaxTPS:            metricAppGroupMaxTPS,
+		metricAppGroupCapacityUsage:     metricAppGroupCapacityUsage,
+		metricAppTPS:                    metricAppTPS,
+		metricAppMaxTPS:                 metricAppMaxTPS,
+		metricAppLastLogAge:             metricAppLastLogAge,
+		metricAppLogMaxStaleness:        metricAppLogMaxStaleness,
+		metricDiscoverySuccess:          metricDiscoverySuccess,
+		metricDiscoveryFailed:           metricDiscoveryFailed,
+		metricDiscoveredAppGroups:       metricDiscoveredAppGroups,
+		metricUpstreamRetry:             metricUpstreamRetry,
+		metricUpstreamRejected:          metricUpstreamRejected,
+		metricUpstreamCircuitOpen:       metricUpstreamCircuitOpen,
+		metricProbePaused:               metricProbePaused,
+		appGroupInfo:                    map[string]AppGroupInfo{},
+		appNames:                        map[string][]string{},
+		esInfo:                          map[string][2]string{},
 	}
 }
 
-func (mR *metricRecorder) IncreasePushLogSuccess(appGroup string) {
-	mR.metricPushLogSuccess.WithLabelValues(appGroup).Inc()
-	mR.metricPushLogFailed.WithLabelValues(appGroup).Add(0)
+func (mR *metricRecorder) IncreasePushLogSuccess(appGroup, router, mode string) {
+	mR.metricPushLogSuccess.WithLabelValues(appGroup, router, mode).Inc()
+	mR.metricPushLogFailed.WithLabelValues(appGroup, router, mode, "").Add(0)
+	mR.metricProbeLastSuccess.WithLabelValues(appGroup, PROBE_PUSH).SetToCurrentTime()
 }
 
-func (mR *metricRecorder) IncreasePushLogFailed(appGroup string) {
-	mR.metricPushLogFailed.WithLabelValues(appGroup).Inc()
-	mR.metricPushLogSuccess.WithLabelValues(appGroup).Add(0)
+func (mR *metricRecorder) IncreasePushLogFailed(appGroup, router, mode, reason string) {
+	mR.metricPushLogFailed.WithLabelValues(appGroup, router, mode, reason).Inc()
+	mR.metricPushLogSuccess.WithLabelValues(appGroup, router, mode).Add(0)
+}
+
+func (mR *metricRecorder) IncreasePushLogResponse(appGroup, router, mode string, statusCode int) {
+	mR.metricPushLogResponse.WithLabelValues(appGroup, router, mode, strconv.Itoa(statusCode)).Inc()
+}
+
+func (mR *metricRecorder) IncreasePushLogWarning(appGroup, router, mode string, count int) {
+	mR.metricPushLogWarning.WithLabelValues(appGroup, router, mode).Add(float64(count))
+}
+
+func (mR *metricRecorder) ObservePushLogTTFB(appGroup, router, mode string, second float64) {
+	mR.metricPushLogTTFB.WithLabelValues(appGroup, router, mode).Observe(second)
 }
 
 func (mR *metricRecorder) IncreaseProbeElasticSearchSuccess(appGroup string) {
 	mR.metricProbeElasticSearchSuccess.WithLabelValues(appGroup).Inc()
 	mR.metricProbeElasticSearchFailed.WithLabelValues(appGroup, "").Add(0)
+	mR.metricProbeLastSuccess.WithLabelValues(appGroup, PROBE_ELASTICSEARCH).SetToCurrentTime()
 }
 
 func (mR *metricRecorder) IncreaseProbeElasticSearchFailed(appGroup, reason string) {
@@ -121,13 +474,53 @@ func (mR *metricRecorder) IncreaseProbeElasticSearchFailed(appGroup, reason stri
 	mR.metricProbeElasticSearchSuccess.WithLabelValues(appGroup).Add(0)
 }
 
+func (mR *metricRecorder) IncreaseProbeElasticsearchRun(appGroup, result string) {
+	mR.metricProbeElasticRun.WithLabelValues(appGroup, result).Inc()
+}
+
 func (mR *metricRecorder) SetProbeElasticsearchDelay(appGroup string, delaySecond float64) {
 	mR.metricProbeElasticDelaySecond.WithLabelValues(appGroup).Set(delaySecond)
 }
 
+func (mR *metricRecorder) SetProbeElasticsearchTook(appGroup string, tookSecond float64) {
+	mR.metricProbeElasticTookSecond.WithLabelValues(appGroup).Set(tookSecond)
+}
+
+func (mR *metricRecorder) SetProbeElasticsearchInfo(appGroup, distribution, version string) {
+	mR.mu.Lock()
+	defer mR.mu.Unlock()
+
+	// drop the previous series, e.g. after an upgrade
+	info := [2]string{distribution, version}
+	if prev, ok := mR.esInfo[appGroup]; ok && prev != info {
+		mR.metricProbeElasticInfo.DeleteLabelValues(appGroup, prev[0], prev[1])
+	}
+	mR.esInfo[appGroup] = info
+	mR.metricProbeElasticInfo.WithLabelValues(appGroup, distribution, version).Set(1)
+}
+
+func (mR *metricRecorder) IncreaseProbeIntegritySuccess(appGroup string) {
+	mR.metricProbeIntegritySuccess.WithLabelValues(appGroup).Inc()
+	mR.metricProbeIntegrityFailed.WithLabelValues(appGroup, "").Add(0)
+}
+
+func (mR *metricRecorder) IncreaseProbeIntegrityFailed(appGroup, reason string) {
+	mR.metricProbeIntegrityFailed.WithLabelValues(appGroup, reason).Inc()
+	mR.metricProbeIntegritySuccess.WithLabelValues(appGroup).Add(0)
+}
+
+func (mR *metricRecorder) IncreaseProbeSequenceMissing(appGroup string, count int) {
+	mR.metricProbeSequenceMissing.WithLabelValues(appGroup).Add(float64(count))
+}
+
+func (mR *metricRecorder) IncreaseProbeSequenceDuplicated(appGroup string, count int) {
+	mR.metricProbeSequenceDuplicated.WithLabelValues(appGroup).Add(float64(count))
+}
+
 func (mR *metricRecorder) IncreaseProbeKibanaSuccess(appGroup string) {
 	mR.metricProbeKibanaSuccess.WithLabelValues(appGroup).Inc()
 	mR.metricProbeKibanaFailed.WithLabelValues(appGroup, "").Add(0)
+	mR.metricProbeLastSuccess.WithLabelValues(appGroup, PROBE_KIBANA).SetToCurrentTime()
 }
 
 func (mR *metricRecorder) IncreaseProbeKibanaFailed(appGroup, reason string) {
@@ -135,6 +528,110 @@ func (mR *metricRecorder) IncreaseProbeKibanaFailed(appGroup, reason string) {
 	mR.metricProbeKibanaSuccess.WithLabelValues(appGroup).Add(0)
 }
 
+func (mR *metricRecorder) IncreaseProbeRequestFailed(appGroup, probe, reason string) {
+	mR.metricProbeRequestFailed.WithLabelValues(appGroup, probe, reason).Inc()
+}
+
+func (mR *metricRecorder) SetAppGroupInfo(appGroup string, info AppGroupInfo) {
+	mR.mu.Lock()
+	defer mR.mu.Unlock()
+
+	// drop the previous series, otherwise a changed label leaves a stale one behind
+	if prev, ok := mR.appGroupInfo[appGroup]; ok && prev != info {
+		mR.metricAppGroupInfo.DeleteLabelValues(appGroup, prev.Name, prev.Capacity, prev.Status, prev.Retention, prev.Environment)
+	}
+	mR.appGroupInfo[appGroup] = info
+	mR.metricAppGroupInfo.WithLabelValues(appGroup, info.Name, info.Capacity, info.Status, info.Retention, info.Environment).Set(1)
+}
+
+func (mR *metricRecorder) SetAppGroupTPS(appGroup string, tps, maxTPS float64) {
+	mR.metricAppGroupTPS.WithLabelValues(appGroup).Set(tps)
+	mR.metricAppGroupMaxTPS.WithLabelValues(appGroup).Set(maxTPS)
+	if maxTPS > 0 {
+		mR.metricAppGroupCapacityUsage.WithLabelValues(appGroup).Set(tps / maxTPS)
+	}
+}
+
+func (mR *metricRecorder) SetAppsTPS(appGroup string, apps []AppTPS) {
+	mR.mu.Lock()
+	defer mR.mu.Unlock()
+
+	current := map[string]bool{}
+	names := []string{}
+	for _, app := range apps {
+		current[app.Name] = true
+		names = append(names, app.Name)
+		mR.metricAppTPS.WithLabelValues(appGroup, app.Name).Set(app.TPS)
+		mR.metricAppMaxTPS.WithLabelValues(appGroup, app.Name).Set(app.MaxTPS)
+	}
+
+	// apps removed from the app group should not keep reporting their last value
+	for _, name := range mR.appNames[appGroup] {
+		if !current[name] {
+			mR.metricAppTPS.DeleteLabelValues(appGroup, name)
+			mR.metricAppMaxTPS.DeleteLabelValues(appGroup, name)
+		}
+	}
+	mR.appNames[appGroup] = names
+}
+
+func (mR *metricRecorder) SetAppLastLogAge(appGroup, app string, ageSecond, maxStalenessSecond float64) {
+	mR.metricAppLastLogAge.WithLabelValues(appGroup, app).Set(ageSecond)
+	mR.metricAppLogMaxStaleness.WithLabelValues(appGroup, app).Set(maxStalenessSecond)
+}
+
+func (mR *metricRecorder) IncreaseDiscoverySuccess(source string) {
+	mR.metricDiscoverySuccess.WithLabelValues(source).Inc()
+	mR.metricDiscoveryFailed.WithLabelValues(source).Add(0)
+}
+
+func (mR *metricRecorder) IncreaseDiscoveryFailed(source string) {
+	mR.metricDiscoveryFailed.WithLabelValues(source).Inc()
+	mR.metricDiscoverySuccess.WithLabelValues(source).Add(0)
+}
+
+func (mR *metricRecorder) SetDiscoveredAppGroups(source string, count int) {
+	mR.metricDiscoveredAppGroups.WithLabelValues(source).Set(float64(count))
+}
+
+func (mR *metricRecorder) IncreaseUpstreamRetry(upstream string) {
+	mR.metricUpstreamRetry.WithLabelValues(upstream).Inc()
+}
+
+func (mR *metricRecorder) IncreaseUpstreamRejected(upstream string) {
+	mR.metricUpstreamRejected.WithLabelValues(upstream).Inc()
+}
+
+func (mR *metricRecorder) SetUpstreamCircuitOpen(upstream, host string, open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	mR.metricUpstreamCircuitOpen.WithLabelValues(upstream, host).Set(value)
+}
+
+func (mR *metricRecorder) SetProbePaused(appGroup, probe string, paused bool) {
+	value := 0.0
+	if paused {
+		value = 1
+	}
+	mR.metricProbePaused.WithLabelValues(appGroup, probe).Set(value)
+}
+
+// DeleteAppGroup drops every series of an app group no longer probed, so it
+// doesn't keep reporting its last values.
+func (mR *metricRecorder) DeleteAppGroup(appGroup string) {
+	mR.mu.Lock()
+	delete(mR.appGroupInfo, appGroup)
+	delete(mR.appNames, appGroup)
+	delete(mR.esInfo, appGroup)
+	mR.mu.Unlock()
+
+	for _, vec := range mR.appGroupVecs() {
+		deleteSeries(vec, "app_group", appGroup)
+	}
+}
+
 func (mR *metricRecorder) GetRegistry() *prometheus.Registry {
 	return mR.registry
 }
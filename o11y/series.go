@@ -0,0 +1,74 @@
+package o11y
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type deletableVec interface {
+	prometheus.Collector
+	Delete(labels prometheus.Labels) bool
+}
+
+// appGroupVecs are the metrics with an app_group label.
+func (mR *metricRecorder) appGroupVecs() []deletableVec {
+	return []deletableVec{
+		mR.metricPushLogSuccess,
+		mR.metricPushLogFailed,
+		mR.metricPushLogResponse,
+		mR.metricPushLogWarning,
+		mR.metricPushLogTTFB,
+		mR.metricProbeElasticSearchSuccess,
+		mR.metricProbeElasticSearchFailed,
+		mR.metricProbeElasticRun,
+		mR.metricProbeElasticDelaySecond,
+		mR.metricProbeElasticTookSecond,
+		mR.metricProbeElasticInfo,
+		mR.metricProbeIntegritySuccess,
+		mR.metricProbeIntegrityFailed,
+		mR.metricProbeSequenceMissing,
+		mR.metricProbeSequenceDuplicated,
+		mR.metricProbeKibanaSuccess,
+		mR.metricProbeKibanaFailed,
+		mR.metricProbeRequestFailed,
+		mR.metricProbeLastSuccess,
+		mR.metricProbePaused,
+		mR.metricAppGroupInfo,
+		mR.metricAppGroupTPS,
+		mR.metricAppGroupMaxTPS,
+		mR.metricAppGroupCapacityUsage,
+		mR.metricAppTPS,
+		mR.metricAppMaxTPS,
+		mR.metricAppLastLogAge,
+		mR.metricAppLogMaxStaleness,
+	}
+}
+
+// deleteSeries deletes the series of vec whose label name is value, whatever
+// their other labels are.
+func deleteSeries(vec deletableVec, name, value string) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+
+	// collected first, vec can't be changed while collecting
+	matched := []prometheus.Labels{}
+	for m := range ch {
+		var d dto.Metric
+		if err := m.Write(&d); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, l := range d.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels[name] == value {
+			matched = append(matched, labels)
+		}
+	}
+	for _, labels := range matched {
+		vec.Delete(labels)
+	}
+}
@@ -0,0 +1,30 @@
+package o11y
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDeleteAppGroup(t *testing.T) {
+	mR := NewMetricRecorder()
+	mR.IncreasePushLogFailed("lama", "router-a", PUSH_MODE_BATCH, REASON_TIMEOUT)
+	mR.IncreasePushLogFailed("unta", "router-a", PUSH_MODE_BATCH, REASON_TIMEOUT)
+	mR.SetProbeElasticsearchDelay("lama", 7)
+	mR.SetAppGroupInfo("lama", AppGroupInfo{Name: "Lama"})
+	mR.SetProbePaused("lama", PROBE_PUSH, true)
+
+	mR.DeleteAppGroup("lama")
+
+	expected := `
+# HELP barito_push_log_failed Number push log failed
+# TYPE barito_push_log_failed counter
+barito_push_log_failed{app_group="unta",mode="batch",reason="timeout",router="router-a"} 1
+`
+	err := testutil.GatherAndCompare(mR.GetRegistry(), strings.NewReader(expected),
+		"barito_push_log_failed", "barito_probe_elasticsearch_delay_second", "barito_appgroup_info", "barito_probe_paused")
+	if err != nil {
+		t.Error(err)
+	}
+}
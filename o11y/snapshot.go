@@ -0,0 +1,105 @@
+package o11y
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sample is a single series value, kept so counters survive a restart.
+type Sample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Snapshot returns the current value of the probe counters and the last
+// success timestamps. Metadata gauges are left out, they are refreshed from
+// BaritoMarket anyway, and so is the elasticsearch delay, which the ES probe
+// tells again from the time of the latest probe log.
+func (mR *metricRecorder) Snapshot() ([]Sample, error) {
+	families, err := mR.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []Sample{}
+	for _, f := range families {
+		if !mR.isPersisted(f.GetName()) {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			samples = append(samples, Sample{
+				Name:   f.GetName(),
+				Labels: labels,
+				Value:  sampleValue(m),
+			})
+		}
+	}
+	return samples, nil
+}
+
+// Restore adds back the samples from a previous Snapshot, it should be called
+// before any agent starts. It returns the samples it couldn't restore, e.g.
+// saved before a label was added to their metric.
+func (mR *metricRecorder) Restore(samples []Sample) []Sample {
+	counters, gauges := mR.persistedMetrics()
+	dropped := []Sample{}
+	for _, s := range samples {
+		var err error
+		if c, ok := counters[s.Name]; ok {
+			var m prometheus.Counter
+			if m, err = c.GetMetricWith(s.Labels); err == nil {
+				m.Add(s.Value)
+			}
+		}
+		if g, ok := gauges[s.Name]; ok {
+			var m prometheus.Gauge
+			if m, err = g.GetMetricWith(s.Labels); err == nil {
+				m.Set(s.Value)
+			}
+		}
+		if err != nil {
+			dropped = append(dropped, s)
+		}
+	}
+	return dropped
+}
+
+func (mR *metricRecorder) persistedMetrics() (map[string]*prometheus.CounterVec, map[string]*prometheus.GaugeVec) {
+	counters := map[string]*prometheus.CounterVec{
+		"barito_push_log_success":            mR.metricPushLogSuccess,
+		"barito_push_log_failed":             mR.metricPushLogFailed,
+		"barito_probe_elasticsearch_success": mR.metricProbeElasticSearchSuccess,
+		"barito_probe_elasticsearch_failed":  mR.metricProbeElasticSearchFailed,
+		"barito_probe_elasticsearch_run":     mR.metricProbeElasticRun,
+		"barito_probe_kibana_success":        mR.metricProbeKibanaSuccess,
+		"barito_probe_kibana_failed":         mR.metricProbeKibanaFailed,
+		"barito_probe_request_failed":        mR.metricProbeRequestFailed,
+		"barito_probe_integrity_success":     mR.metricProbeIntegritySuccess,
+		"barito_probe_integrity_failed":      mR.metricProbeIntegrityFailed,
+		"barito_probe_sequence_missing":      mR.metricProbeSequenceMissing,
+		"barito_probe_sequence_duplicated":   mR.metricProbeSequenceDuplicated,
+	}
+	gauges := map[string]*prometheus.GaugeVec{
+		"barito_probe_last_success_timestamp_seconds": mR.metricProbeLastSuccess,
+	}
+	return counters, gauges
+}
+
+func (mR *metricRecorder) isPersisted(name string) bool {
+	counters, gauges := mR.persistedMetrics()
+	_, isCounter := counters[name]
+	_, isGauge := gauges[name]
+	return isCounter || isGauge
+}
+
+func sampleValue(m *dto.Metric) float64 {
+	if m.GetCounter() != nil {
+		return m.GetCounter().GetValue()
+	}
+	return m.GetGauge().GetValue()
+}
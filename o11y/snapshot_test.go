@@ -0,0 +1,55 @@
+package o11y
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	mR := NewMetricRecorder()
+	mR.IncreasePushLogSuccess("lama", "router-a", PUSH_MODE_BATCH)
+	mR.IncreasePushLogSuccess("lama", "router-a", PUSH_MODE_BATCH)
+	mR.IncreaseProbeKibanaFailed("lama", REASON_REQUEST_FAILED)
+	mR.SetProbeElasticsearchDelay("lama", 7)
+	mR.IncreaseProbeSequenceMissing("lama", 2)
+	mR.SetAppGroupInfo("lama", AppGroupInfo{Name: "Lama"})
+
+	samples, err := mR.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot should not return error, got: %v", err)
+	}
+	for _, s := range samples {
+		if s.Name == "barito_appgroup_info" || s.Name == "barito_probe_elasticsearch_delay_second" {
+			t.Errorf("Snapshot should not contain metadata metrics nor the delay, got: %+v", s)
+		}
+	}
+
+	// saved before the router label was added
+	samples = append(samples, Sample{Name: "barito_push_log_failed", Labels: map[string]string{"app_group": "lama", "mode": "batch", "reason": "timeout"}, Value: 1})
+
+	restored := NewMetricRecorder()
+	if dropped := restored.Restore(samples); len(dropped) != 1 || dropped[0].Name != "barito_push_log_failed" {
+		t.Errorf("Restore should return the samples it couldn't restore, got: %+v", dropped)
+	}
+	restored.IncreasePushLogSuccess("lama", "router-a", PUSH_MODE_BATCH)
+
+	expected := `
+# HELP barito_push_log_success Number push log success
+# TYPE barito_push_log_success counter
+barito_push_log_success{app_group="lama",mode="batch",router="router-a"} 3
+# HELP barito_probe_kibana_failed Number probe kibana failed
+# TYPE barito_probe_kibana_failed counter
+barito_probe_kibana_failed{app_group="lama",reason="request_failed"} 1
+# HELP barito_probe_sequence_missing Number of probe logs pushed but not found in elasticsearch, by their sequence number
+# TYPE barito_probe_sequence_missing counter
+barito_probe_sequence_missing{app_group="lama"} 2
+`
+	err = testutil.GatherAndCompare(restored.GetRegistry(), strings.NewReader(expected),
+		"barito_push_log_success", "barito_probe_kibana_failed", "barito_probe_elasticsearch_delay_second",
+		"barito_probe_sequence_missing")
+	if err != nil {
+		t.Error(err)
+	}
+}
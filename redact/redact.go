@@ -0,0 +1,89 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const REDACTED = "***"
+
+var (
+	mu      sync.RWMutex
+	secrets = map[string]bool{}
+
+	// credentials that may show up without being registered, e.g. in a URL
+	// coming back from an upstream
+	patterns = []*regexp.Regexp{
+		regexp.MustCompile(`(access_token=)[^&\s"']+`),
+		regexp.MustCompile(`(://[^/@\s:]+:)[^/@\s]+(@)`),
+	}
+)
+
+// Register marks values as secret, they are replaced in every string passed
+// to String afterwards.
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			secrets[v] = true
+		}
+	}
+}
+
+func String(s string) string {
+	mu.RLock()
+	for secret := range secrets {
+		s = strings.Replace(s, secret, REDACTED, -1)
+	}
+	mu.RUnlock()
+
+	s = patterns[0].ReplaceAllString(s, "${1}"+REDACTED)
+	s = patterns[1].ReplaceAllString(s, "${1}"+REDACTED+"${2}")
+	return s
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return String(e.err.Error())
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Error wraps err so its message is redacted, e.g. a *url.Error holding the
+// request URL.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{err: err}
+}
+
+// Hook redacts the message and fields of every log entry.
+type Hook struct{}
+
+func (h *Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *Hook) Fire(e *log.Entry) error {
+	e.Message = String(e.Message)
+	for k, v := range e.Data {
+		switch value := v.(type) {
+		case error:
+			e.Data[k] = String(value.Error())
+		case string:
+			e.Data[k] = String(value)
+		}
+	}
+	return nil
+}
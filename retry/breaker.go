@@ -0,0 +1,77 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	STATE_CLOSED    = "closed"
+	STATE_OPEN      = "open"
+	STATE_HALF_OPEN = "half_open"
+)
+
+// Breaker opens after threshold failures in a row and rejects calls until
+// cooldown has passed. It then lets a single call through, which closes it
+// on success or opens it again on failure. A threshold of 0 never opens.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     STATE_CLOSED,
+	}
+}
+
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case STATE_OPEN:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = STATE_HALF_OPEN
+		return true
+	case STATE_HALF_OPEN:
+		// the trial call is still in flight
+		return false
+	}
+	return true
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = STATE_CLOSED
+	b.failures = 0
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == STATE_HALF_OPEN || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = STATE_OPEN
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
@@ -0,0 +1,48 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2, 20*time.Millisecond)
+
+	b.Failure()
+	if !b.Allow() {
+		t.Fatalf("Should stay closed below the threshold")
+	}
+	b.Failure()
+	if b.Allow() || b.State() != STATE_OPEN {
+		t.Fatalf("Should open after reaching the threshold, got: %s", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow() || b.State() != STATE_HALF_OPEN {
+		t.Fatalf("Should let a trial call through after cooldown, got: %s", b.State())
+	}
+	if b.Allow() {
+		t.Errorf("Should let a single trial call through")
+	}
+	b.Failure()
+	if b.Allow() || b.State() != STATE_OPEN {
+		t.Fatalf("Should open again when the trial call fails, got: %s", b.State())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.Allow()
+	b.Success()
+	if !b.Allow() || b.State() != STATE_CLOSED {
+		t.Errorf("Should close when the trial call succeeds, got: %s", b.State())
+	}
+}
+
+func TestBreaker_zeroThresholdNeverOpens(t *testing.T) {
+	b := NewBreaker(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		b.Failure()
+	}
+	if !b.Allow() {
+		t.Errorf("Should never open with a threshold of 0")
+	}
+}
@@ -0,0 +1,110 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusError is returned for an unexpected response status, so the policy
+// can tell whether it's worth retrying.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Got response status %d", e.StatusCode)
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks an error as transient regardless of the policy, e.g. a
+// truncated response body.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// Policy retries a failed call up to Retries times, waiting Backoff after
+// the first failure and twice as long after each following one. Network
+// errors, errors marked with Retryable and responses with one of
+// StatusCodes, or any 5xx and 429 when StatusCodes is nil, are retried,
+// anything else is returned right away. Only, when set, further restricts
+// the errors retried, e.g. to the ones of calls which had no effect. The
+// zero Policy calls once.
+type Policy struct {
+	Retries     int
+	Backoff     time.Duration
+	StatusCodes []int
+	Only        func(err error) bool
+}
+
+func NewPolicy(retries int, backoff time.Duration, statusCodes []int) Policy {
+	return Policy{Retries: retries, Backoff: backoff, StatusCodes: statusCodes}
+}
+
+func (p Policy) IsRetryable(err error) bool {
+	if p.Only != nil && !p.Only(err) {
+		return false
+	}
+
+	var rErr *retryableError
+	if errors.As(err, &rErr) {
+		return true
+	}
+
+	var sErr *StatusError
+	if errors.As(err, &sErr) {
+		if p.StatusCodes == nil {
+			return sErr.StatusCode >= 500 || sErr.StatusCode == http.StatusTooManyRequests
+		}
+		for _, code := range p.StatusCodes {
+			if code == sErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+
+	// url.Error implements net.Error too
+	var nErr net.Error
+	return errors.As(err, &nErr)
+}
+
+// Do calls fn until it succeeds, returns an error not worth retrying or runs
+// out of retries. onRetry, when given, is called before each retry.
+func (p Policy) Do(fn func() error, onRetry func(attempt int, err error)) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt > p.Retries || !p.IsRetryable(err) {
+			return err
+		}
+
+		log.Debugf("Retry in %v, attempt: %d, error: %v", backoff, attempt, err)
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
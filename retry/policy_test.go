@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Do(t *testing.T) {
+	policy := NewPolicy(2, time.Millisecond, []int{503})
+
+	cases := map[string]struct {
+		errs          []error
+		expectedCalls int
+		expectedErr   bool
+	}{
+		"success":              {errs: []error{nil}, expectedCalls: 1},
+		"retryable status":     {errs: []error{&StatusError{StatusCode: 503}, nil}, expectedCalls: 2},
+		"non retryable status": {errs: []error{&StatusError{StatusCode: 500}}, expectedCalls: 1, expectedErr: true},
+		"marked retryable":     {errs: []error{Retryable(errors.New("EOF")), nil}, expectedCalls: 2},
+		"wrapped status":       {errs: []error{fmt.Errorf("consul: %w", &StatusError{StatusCode: 503}), nil}, expectedCalls: 2},
+		"plain error":          {errs: []error{errors.New("bad request")}, expectedCalls: 1, expectedErr: true},
+		"out of retries":       {errs: []error{&StatusError{StatusCode: 503}, &StatusError{StatusCode: 503}, &StatusError{StatusCode: 503}}, expectedCalls: 3, expectedErr: true},
+	}
+	for name, c := range cases {
+		calls := 0
+		retries := 0
+		err := policy.Do(func() error {
+			err := c.errs[calls]
+			calls++
+			return err
+		}, func(attempt int, err error) {
+			retries++
+		})
+
+		if calls != c.expectedCalls {
+			t.Errorf("%s: should call %d times, got: %d", name, c.expectedCalls, calls)
+		}
+		if retries != calls-1 {
+			t.Errorf("%s: should notify %d retries, got: %d", name, calls-1, retries)
+		}
+		if (err != nil) != c.expectedErr {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+func TestPolicy_IsRetryable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	_, netErr := http.Get(srv.URL)
+
+	policy := Policy{}
+	if !policy.IsRetryable(netErr) {
+		t.Errorf("Network error should be retryable, got: %v", netErr)
+	}
+	if !policy.IsRetryable(&StatusError{StatusCode: 502}) || !policy.IsRetryable(&StatusError{StatusCode: 429}) {
+		t.Errorf("5xx and 429 should be retryable when no status codes are configured")
+	}
+	if policy.IsRetryable(&StatusError{StatusCode: 404}) {
+		t.Errorf("4xx should not be retryable when no status codes are configured")
+	}
+
+	policy.Only = func(err error) bool { return !errors.Is(err, netErr) }
+	if policy.IsRetryable(netErr) || !policy.IsRetryable(&StatusError{StatusCode: 502}) {
+		t.Errorf("Only errors accepted by Only should be retryable")
+	}
+}
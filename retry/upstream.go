@@ -0,0 +1,130 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Upstreams keeps the upstreams of one exporter, so separate managers and
+// tests don't share breaker states. A nil *Upstreams never opens a breaker
+// and records nothing.
+type Upstreams struct {
+	threshold      int
+	cooldown       time.Duration
+	metricRecorder o11y.MetricRecorder
+
+	mu        sync.Mutex
+	upstreams map[string]*Upstream
+}
+
+func NewUpstreams(threshold int, cooldown time.Duration, mR o11y.MetricRecorder) *Upstreams {
+	return &Upstreams{
+		threshold:      threshold,
+		cooldown:       cooldown,
+		metricRecorder: mR,
+		upstreams:      map[string]*Upstream{},
+	}
+}
+
+// For returns the upstream shared by every caller using the same name, so a
+// host failing for one app group is not hammered by all the others.
+func (u *Upstreams) For(name string) *Upstream {
+	if u == nil {
+		return newUpstream(name, 0, 0, nil)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	up, ok := u.upstreams[name]
+	if !ok {
+		up = newUpstream(name, u.threshold, u.cooldown, u.metricRecorder)
+		u.upstreams[name] = up
+	}
+	return up
+}
+
+// Upstream keeps a breaker per host of a kind of upstream, e.g. per consul
+// host.
+type Upstream struct {
+	name           string
+	threshold      int
+	cooldown       time.Duration
+	metricRecorder o11y.MetricRecorder
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func newUpstream(name string, threshold int, cooldown time.Duration, mR o11y.MetricRecorder) *Upstream {
+	return &Upstream{
+		name:           name,
+		threshold:      threshold,
+		cooldown:       cooldown,
+		metricRecorder: mR,
+		breakers:       map[string]*Breaker{},
+	}
+}
+
+func (u *Upstream) breaker(host string) *Breaker {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	b, ok := u.breakers[host]
+	if !ok {
+		b = NewBreaker(u.threshold, u.cooldown)
+		u.breakers[host] = b
+	}
+	return b
+}
+
+// Do calls fn with the policy, unless the breaker of host is open. Only
+// failures telling the host is unhealthy, network errors and 5xx responses,
+// count toward opening the breaker. A 429 only tells the caller is too fast.
+func (u *Upstream) Do(host string, policy Policy, fn func() error) error {
+	b := u.breaker(host)
+	if !b.Allow() {
+		if u.metricRecorder != nil {
+			u.metricRecorder.IncreaseUpstreamRejected(u.name)
+		}
+		return fmt.Errorf("%s %q: %w", u.name, host, ErrCircuitOpen)
+	}
+
+	err := policy.Do(fn, func(attempt int, err error) {
+		if u.metricRecorder != nil {
+			u.metricRecorder.IncreaseUpstreamRetry(u.name)
+		}
+	})
+	if err != nil && isUpstreamFailure(err) {
+		b.Failure()
+	} else {
+		b.Success()
+	}
+
+	if u.metricRecorder != nil {
+		u.metricRecorder.SetUpstreamCircuitOpen(u.name, host, b.State() == STATE_OPEN)
+	}
+	return err
+}
+
+func isUpstreamFailure(err error) bool {
+	var sErr *StatusError
+	if errors.As(err, &sErr) {
+		return sErr.StatusCode >= 500
+	}
+
+	var rErr *retryableError
+	if errors.As(err, &rErr) {
+		return true
+	}
+
+	var nErr net.Error
+	return errors.As(err, &nErr)
+}
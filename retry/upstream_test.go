@@ -0,0 +1,73 @@
+package retry_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/retry"
+	"github.com/golang/mock/gomock"
+)
+
+func TestUpstream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	upstreams := retry.NewUpstreams(2, time.Minute, mr)
+
+	policy := retry.NewPolicy(1, time.Millisecond, nil)
+	down := func() error { return &retry.StatusError{StatusCode: 503} }
+
+	gomock.InOrder(
+		mr.EXPECT().IncreaseUpstreamRetry("consul"),
+		mr.EXPECT().SetUpstreamCircuitOpen("consul", "consul-1:8500", false),
+		mr.EXPECT().IncreaseUpstreamRetry("consul"),
+		mr.EXPECT().SetUpstreamCircuitOpen("consul", "consul-1:8500", true),
+		mr.EXPECT().IncreaseUpstreamRejected("consul"),
+	)
+	upstreams.For("consul").Do("consul-1:8500", policy, down)
+	upstreams.For("consul").Do("consul-1:8500", policy, down)
+
+	calls := 0
+	err := upstreams.For("consul").Do("consul-1:8500", policy, func() error {
+		calls++
+		return nil
+	})
+	if !errors.Is(err, retry.ErrCircuitOpen) || calls != 0 {
+		t.Errorf("Should reject calls once the breaker is open, got: %v after %d calls", err, calls)
+	}
+
+	// other hosts of the same upstream have their own breaker
+	mr.EXPECT().SetUpstreamCircuitOpen("consul", "consul-2:8500", false)
+	if err := upstreams.For("consul").Do("consul-2:8500", policy, func() error { return nil }); err != nil {
+		t.Errorf("Should not reject calls to another host, got: %v", err)
+	}
+}
+
+func TestUpstream_clientErrorDoesNotOpen(t *testing.T) {
+	for _, status := range []int{404, 429} {
+		upstreams := retry.NewUpstreams(1, time.Minute, nil)
+		upstreams.For("elasticsearch").Do("es-1", retry.Policy{}, func() error { return &retry.StatusError{StatusCode: status} })
+		if err := upstreams.For("elasticsearch").Do("es-1", retry.Policy{}, func() error { return nil }); err != nil {
+			t.Errorf("%d should not open the breaker, got: %v", status, err)
+		}
+	}
+}
+
+func TestUpstreams_separate(t *testing.T) {
+	down := func() error { return &retry.StatusError{StatusCode: 503} }
+	first := retry.NewUpstreams(1, time.Minute, nil)
+	first.For("router").Do("lama/router", retry.Policy{}, down)
+
+	if err := retry.NewUpstreams(1, time.Minute, nil).For("router").Do("lama/router", retry.Policy{}, func() error { return nil }); err != nil {
+		t.Errorf("Should not share breakers between registries, got: %v", err)
+	}
+
+	var none *retry.Upstreams
+	none.For("router").Do("lama/router", retry.Policy{}, down)
+	if err := none.For("router").Do("lama/router", retry.Policy{}, func() error { return nil }); err != nil {
+		t.Errorf("A nil registry should never open, got: %v", err)
+	}
+}
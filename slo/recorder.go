@@ -0,0 +1,79 @@
+package slo
+
+import (
+	"sync"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+// Recorder feeds probe results to the tracker while still recording them to
+// the wrapped MetricRecorder.
+type Recorder struct {
+	o11y.MetricRecorder
+	tracker        *Tracker
+	freshThreshold float64
+
+	mu     sync.Mutex
+	delays map[string]float64
+}
+
+func NewRecorder(mR o11y.MetricRecorder, t *Tracker, freshThresholdSecond float64) *Recorder {
+	return &Recorder{
+		MetricRecorder: mR,
+		tracker:        t,
+		freshThreshold: freshThresholdSecond,
+		delays:         map[string]float64{},
+	}
+}
+
+func (r *Recorder) IncreasePushLogSuccess(appGroup, router, mode string) {
+	r.MetricRecorder.IncreasePushLogSuccess(appGroup, router, mode)
+	r.tracker.Observe(appGroup, SLI_PUSH, true)
+}
+
+func (r *Recorder) IncreasePushLogFailed(appGroup, router, mode, reason string) {
+	r.MetricRecorder.IncreasePushLogFailed(appGroup, router, mode, reason)
+	r.tracker.Observe(appGroup, SLI_PUSH, false)
+}
+
+// SetProbeElasticsearchDelay keeps the delay for the run being recorded, set
+// before the run is.
+func (r *Recorder) SetProbeElasticsearchDelay(appGroup string, delaySecond float64) {
+	r.MetricRecorder.SetProbeElasticsearchDelay(appGroup, delaySecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delays[appGroup] = delaySecond
+}
+
+// IncreaseProbeElasticsearchRun accounts one freshness event per run,
+// however many ES were tried. A failed run counts against freshness, as we
+// can't tell if data is fresh when ES can't be queried.
+func (r *Recorder) IncreaseProbeElasticsearchRun(appGroup, result string) {
+	r.MetricRecorder.IncreaseProbeElasticsearchRun(appGroup, result)
+
+	r.mu.Lock()
+	delay, ok := r.delays[appGroup]
+	r.mu.Unlock()
+	fresh := result == o11y.RESULT_SUCCESS && ok && delay <= r.freshThreshold
+	r.tracker.Observe(appGroup, SLI_ELASTICSEARCH_FRESH, fresh)
+}
+
+func (r *Recorder) IncreaseProbeKibanaSuccess(appGroup string) {
+	r.MetricRecorder.IncreaseProbeKibanaSuccess(appGroup)
+	r.tracker.Observe(appGroup, SLI_KIBANA, true)
+}
+
+func (r *Recorder) IncreaseProbeKibanaFailed(appGroup, reason string) {
+	r.MetricRecorder.IncreaseProbeKibanaFailed(appGroup, reason)
+	r.tracker.Observe(appGroup, SLI_KIBANA, false)
+}
+
+func (r *Recorder) DeleteAppGroup(appGroup string) {
+	r.MetricRecorder.DeleteAppGroup(appGroup)
+	r.tracker.Delete(appGroup)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.delays, appGroup)
+}
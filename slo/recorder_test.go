@@ -0,0 +1,48 @@
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/mock"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	"github.com/golang/mock/gomock"
+)
+
+func TestRecorder_elasticsearchFreshness(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mr := mock.NewMockMetricRecorder(ctrl)
+	mr.EXPECT().IncreaseProbeElasticSearchFailed("lama", gomock.Any()).Times(2)
+	mr.EXPECT().IncreaseProbeElasticSearchSuccess("lama")
+	mr.EXPECT().SetProbeElasticsearchDelay("lama", gomock.Any()).Times(2)
+	mr.EXPECT().IncreaseProbeElasticsearchRun("lama", gomock.Any()).Times(3)
+
+	tracker := NewTracker([]time.Duration{time.Hour}, 0.99)
+	r := NewRecorder(mr, tracker, 60)
+
+	// the first ES fails, the second has fresh data
+	r.IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_REQUEST_FAILED)
+	r.IncreaseProbeElasticSearchSuccess("lama")
+	r.SetProbeElasticsearchDelay("lama", 5)
+	r.IncreaseProbeElasticsearchRun("lama", o11y.RESULT_SUCCESS)
+
+	// stalled past the lookback
+	r.IncreaseProbeElasticSearchFailed("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+	r.SetProbeElasticsearchDelay("lama", 7200)
+	r.IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_NO_DATA)
+
+	r.IncreaseProbeElasticsearchRun("lama", o11y.REASON_PROBE_ELASTICSEARCH_FAILED_GET_LIST_FROM_CONSUL)
+
+	var good, total float64
+	for _, w := range tracker.Snapshot() {
+		for _, b := range w.Buckets {
+			good += b.Good
+			total += b.Total
+		}
+	}
+	if good != 1 || total != 3 {
+		t.Errorf("Should observe one event per run, 1 good out of 3, got: %v out of %v", good, total)
+	}
+}
@@ -0,0 +1,148 @@
+package slo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/state"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	SLI_PUSH                = "push"
+	SLI_ELASTICSEARCH_FRESH = "elasticsearch_freshness"
+	SLI_KIBANA              = "kibana"
+)
+
+// Tracker keeps rolling good/total counts per app group and SLI, and exports
+// the resulting ratios when scraped.
+type Tracker struct {
+	windows   []time.Duration
+	objective float64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]map[string][]*window
+
+	descSLI    *prometheus.Desc
+	descBudget *prometheus.Desc
+}
+
+func NewTracker(windows []time.Duration, objective float64) *Tracker {
+	return &Tracker{
+		windows:   windows,
+		objective: objective,
+		now:       time.Now,
+		entries:   map[string]map[string][]*window{},
+		descSLI: prometheus.NewDesc(
+			"barito_slo_sli_ratio",
+			"Ratio of good probe over total probe in the window",
+			[]string{"app_group", "sli", "window"}, nil,
+		),
+		descBudget: prometheus.NewDesc(
+			"barito_slo_error_budget_remaining_ratio",
+			"Ratio of error budget left in the window, negative when the objective is breached",
+			[]string{"app_group", "sli", "window"}, nil,
+		),
+	}
+}
+
+func (t *Tracker) Observe(appGroup, sli string, good bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for _, w := range t.windowsOf(appGroup, sli) {
+		w.add(now, good)
+	}
+}
+
+// windowsOf returns the windows of the SLI of the app group, creating them
+// on first use. t.mu must be held.
+func (t *Tracker) windowsOf(appGroup, sli string) []*window {
+	slis, ok := t.entries[appGroup]
+	if !ok {
+		slis = map[string][]*window{}
+		t.entries[appGroup] = slis
+	}
+	windows, ok := slis[sli]
+	if !ok {
+		for _, size := range t.windows {
+			windows = append(windows, newWindow(size))
+		}
+		slis[sli] = windows
+	}
+	return windows
+}
+
+// Snapshot returns the buckets still in their window, to be saved along the
+// state.
+func (t *Tracker) Snapshot() []state.SLOWindow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	saved := []state.SLOWindow{}
+	for appGroup, slis := range t.entries {
+		for sli, windows := range slis {
+			for _, w := range windows {
+				if buckets := w.snapshot(now); len(buckets) > 0 {
+					saved = append(saved, state.SLOWindow{AppGroup: appGroup, SLI: sli, Size: w.size, Buckets: buckets})
+				}
+			}
+		}
+	}
+	return saved
+}
+
+// Restore adds back the buckets from a previous Snapshot. Windows whose size
+// isn't configured anymore are dropped.
+func (t *Tracker) Restore(saved []state.SLOWindow) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range saved {
+		for _, w := range t.windowsOf(s.AppGroup, s.SLI) {
+			if w.size == s.Size {
+				w.restore(s.Buckets)
+			}
+		}
+	}
+}
+
+// Delete forgets the windows of an app group no longer probed.
+func (t *Tracker) Delete(appGroup string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.entries, appGroup)
+}
+
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.descSLI
+	ch <- t.descBudget
+}
+
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for appGroup, slis := range t.entries {
+		for sli, windows := range slis {
+			for _, w := range windows {
+				good, total := w.sum(now)
+				if total == 0 {
+					continue
+				}
+				ratio := good / total
+				label := windowLabel(w.size)
+				ch <- prometheus.MustNewConstMetric(t.descSLI, prometheus.GaugeValue, ratio, appGroup, sli, label)
+				if t.objective < 1 {
+					budget := 1 - (1-ratio)/(1-t.objective)
+					ch <- prometheus.MustNewConstMetric(t.descBudget, prometheus.GaugeValue, budget, appGroup, sli, label)
+				}
+			}
+		}
+	}
+}
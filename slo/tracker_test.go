@@ -0,0 +1,98 @@
+package slo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tracker := NewTracker([]time.Duration{time.Hour, 24 * time.Hour}, 0.5)
+	tracker.now = func() time.Time { return now }
+
+	// 2 hours ago: 2 bad, only counted in the 1d window
+	now = now.Add(-2 * time.Hour)
+	tracker.Observe("lama", SLI_PUSH, false)
+	tracker.Observe("lama", SLI_PUSH, false)
+
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		tracker.Observe("lama", SLI_PUSH, true)
+	}
+	tracker.Observe("lama", SLI_PUSH, false)
+
+	expected := `
+# HELP barito_slo_error_budget_remaining_ratio Ratio of error budget left in the window, negative when the objective is breached
+# TYPE barito_slo_error_budget_remaining_ratio gauge
+barito_slo_error_budget_remaining_ratio{app_group="lama",sli="push",window="1d"} 0
+barito_slo_error_budget_remaining_ratio{app_group="lama",sli="push",window="1h"} 0.5
+# HELP barito_slo_sli_ratio Ratio of good probe over total probe in the window
+# TYPE barito_slo_sli_ratio gauge
+barito_slo_sli_ratio{app_group="lama",sli="push",window="1d"} 0.5
+barito_slo_sli_ratio{app_group="lama",sli="push",window="1h"} 0.75
+`
+	r := prometheus.NewRegistry()
+	r.MustRegister(tracker)
+	if err := testutil.GatherAndCompare(r, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// everything observed is now out of both windows
+	now = now.Add(25 * time.Hour)
+	if err := testutil.GatherAndCompare(r, strings.NewReader("")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWindowLabel(t *testing.T) {
+	cases := map[time.Duration]string{
+		30 * 24 * time.Hour: "30d",
+		6 * time.Hour:       "6h",
+		90 * time.Minute:    "90m",
+		90 * time.Second:    "1m30s",
+	}
+	for d, expected := range cases {
+		if got := windowLabel(d); got != expected {
+			t.Errorf("windowLabel(%v) should return %q, got: %q", d, expected, got)
+		}
+	}
+}
+
+func TestTracker_snapshot(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	tracker := NewTracker([]time.Duration{time.Hour, 24 * time.Hour}, 0.5)
+	tracker.now = func() time.Time { return now }
+
+	// 2 hours ago: only in the 1d window
+	now = now.Add(-2 * time.Hour)
+	tracker.Observe("lama", SLI_PUSH, false)
+	now = now.Add(2 * time.Hour)
+	tracker.Observe("lama", SLI_PUSH, true)
+
+	saved := tracker.Snapshot()
+	if len(saved) != 2 {
+		t.Fatalf("Snapshot should return the windows with events, got: %+v", saved)
+	}
+
+	// a 7d window was added to the config, a 1h one was removed
+	restored := NewTracker([]time.Duration{24 * time.Hour, 7 * 24 * time.Hour}, 0.5)
+	restored.now = func() time.Time { return now }
+	restored.Observe("lama", SLI_PUSH, true)
+	restored.Restore(saved)
+
+	expected := `
+# HELP barito_slo_sli_ratio Ratio of good probe over total probe in the window
+# TYPE barito_slo_sli_ratio gauge
+barito_slo_sli_ratio{app_group="lama",sli="push",window="1d"} 0.6666666666666666
+barito_slo_sli_ratio{app_group="lama",sli="push",window="7d"} 1
+`
+	r := prometheus.NewRegistry()
+	r.MustRegister(restored)
+	if err := testutil.GatherAndCompare(r, strings.NewReader(expected), "barito_slo_sli_ratio"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,106 @@
+package slo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/state"
+)
+
+const bucketsPerWindow = 60
+
+type bucket struct {
+	index int64
+	good  float64
+	total float64
+}
+
+// window counts good and total events over a rolling duration. Events are
+// grouped into a fixed number of buckets, so memory does not grow with the
+// window size and the ratio is accurate to 1/bucketsPerWindow of it.
+type window struct {
+	size       time.Duration
+	bucketSize time.Duration
+	buckets    []bucket
+}
+
+func newWindow(size time.Duration) *window {
+	bucketSize := size / bucketsPerWindow
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	return &window{
+		size:       size,
+		bucketSize: bucketSize,
+		buckets:    make([]bucket, bucketsPerWindow),
+	}
+}
+
+func (w *window) add(t time.Time, good bool) {
+	index := t.UnixNano() / int64(w.bucketSize)
+	b := &w.buckets[index%int64(len(w.buckets))]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	b.total++
+	if good {
+		b.good++
+	}
+}
+
+func (w *window) sum(now time.Time) (good, total float64) {
+	nowIndex := now.UnixNano() / int64(w.bucketSize)
+	for _, b := range w.buckets {
+		if w.inWindow(b.index, nowIndex) {
+			good += b.good
+			total += b.total
+		}
+	}
+	return good, total
+}
+
+func (w *window) inWindow(index, nowIndex int64) bool {
+	return index > nowIndex-int64(len(w.buckets)) && index <= nowIndex
+}
+
+func (w *window) snapshot(now time.Time) []state.SLOBucket {
+	nowIndex := now.UnixNano() / int64(w.bucketSize)
+	buckets := []state.SLOBucket{}
+	for _, b := range w.buckets {
+		if b.total > 0 && w.inWindow(b.index, nowIndex) {
+			buckets = append(buckets, state.SLOBucket{Index: b.index, Good: b.good, Total: b.total})
+		}
+	}
+	return buckets
+}
+
+// restore adds the saved buckets to the ones of the same index, so events
+// observed before the restore are kept.
+func (w *window) restore(saved []state.SLOBucket) {
+	for _, s := range saved {
+		b := &w.buckets[s.Index%int64(len(w.buckets))]
+		if b.index > s.Index {
+			continue
+		}
+		if b.index != s.Index {
+			*b = bucket{index: s.Index}
+		}
+		b.good += s.Good
+		b.total += s.Total
+	}
+}
+
+// windowLabel renders the window in the unit people use for SLOs, e.g. 30d
+// instead of 720h0m0s.
+func windowLabel(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
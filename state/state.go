@@ -0,0 +1,147 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+type AppGroup struct {
+	ClusterName string            `json:"cluster_name"`
+	Secret      string            `json:"secret"`
+	Metadata    appgroup.Metadata `json:"metadata"`
+}
+
+// SLOWindow is a rolling SLO window of an app group, with the buckets that
+// had events.
+type SLOWindow struct {
+	AppGroup string        `json:"app_group"`
+	SLI      string        `json:"sli"`
+	Size     time.Duration `json:"size"`
+	Buckets  []SLOBucket   `json:"buckets"`
+}
+
+type SLOBucket struct {
+	Index int64   `json:"index"`
+	Good  float64 `json:"good"`
+	Total float64 `json:"total"`
+}
+
+// Sequence is where the probe log sequence of an app group is at: the next
+// number to push, the last number and push time checked in ES, and the
+// numbers whose push was in flight when saved, which may or may not be in
+// ES.
+type Sequence struct {
+	Next        int64           `json:"next"`
+	CheckedSeq  int64           `json:"checked_seq"`
+	CheckedTime int64           `json:"checked_time"`
+	Unsettled   []SequenceRange `json:"unsettled,omitempty"`
+}
+
+// SequenceRange is count numbers from first.
+type SequenceRange struct {
+	First int64 `json:"first"`
+	Count int64 `json:"count"`
+}
+
+// Snapshot is what survives a restart: probe metrics, including the last
+// success time of each probe, the app groups found on last discovery with
+// their metadata so we can start probing even when BaritoMarket is
+// unreachable, and the probe log
+// sequences so a restart doesn't look like missing logs, and the SLO windows
+// so a restart doesn't reset the error budget. The time of the latest probe
+// log found in ES, in millisecond, lets the delay be told even when the
+// pipeline stalled past the lookback before the restart.
+type Snapshot struct {
+	SavedAt       time.Time           `json:"saved_at"`
+	Metrics       []o11y.Sample       `json:"metrics"`
+	AppGroups     []AppGroup          `json:"app_groups"`
+	Sequences     map[string]Sequence `json:"sequences,omitempty"`
+	SLOWindows    []SLOWindow         `json:"slo_windows,omitempty"`
+	ProbeLogTimes map[string]int64    `json:"probe_log_times,omitempty"`
+}
+
+// RestoredAppGroups returns the cluster names of the app groups with saved
+// metrics or SLO windows.
+func (s *Snapshot) RestoredAppGroups() []string {
+	seen := map[string]bool{}
+	result := []string{}
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	for _, sample := range s.Metrics {
+		add(sample.Labels["app_group"])
+	}
+	for _, w := range s.SLOWindows {
+		add(w.AppGroup)
+	}
+	return result
+}
+
+// Snapshotter is implemented by the metric recorder.
+type Snapshotter interface {
+	Snapshot() ([]o11y.Sample, error)
+	Restore(samples []o11y.Sample) []o11y.Sample
+}
+
+type Store struct {
+	path string
+}
+
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Load returns an empty snapshot when the file doesn't exist yet.
+func (s *Store) Load() (*Snapshot, error) {
+	body, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(body, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Save writes to a temporary file then renames it, so a crash while saving
+// never leaves a truncated state behind. The file holds app group secrets,
+// hence only readable by its owner.
+func (s *Store) Save(snapshot *Snapshot) error {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,81 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/appgroup"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+func TestSnapshot_RestoredAppGroups(t *testing.T) {
+	snapshot := &Snapshot{
+		Metrics: []o11y.Sample{
+			{Name: "barito_push_log_success", Labels: map[string]string{"app_group": "lama"}, Value: 3},
+			{Name: "barito_probe_kibana_success", Labels: map[string]string{"app_group": "lama"}, Value: 1},
+		},
+		SLOWindows: []SLOWindow{{AppGroup: "unta", SLI: "push", Size: time.Hour}},
+	}
+	if names := snapshot.RestoredAppGroups(); !reflect.DeepEqual(names, []string{"lama", "unta"}) {
+		t.Errorf("Should return each app group once, got: %v", names)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(filepath.Join(dir, "state.json"))
+
+	snapshot, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load missing file should not return error, got: %v", err)
+	}
+	if !reflect.DeepEqual(snapshot, &Snapshot{}) {
+		t.Errorf("Load missing file should return empty snapshot, got: %+v", snapshot)
+	}
+
+	expected := &Snapshot{
+		SavedAt: time.Unix(1600000000, 0).UTC(),
+		Metrics: []o11y.Sample{
+			{Name: "barito_push_log_success", Labels: map[string]string{"app_group": "lama"}, Value: 3},
+		},
+		AppGroups: []AppGroup{{ClusterName: "lama", Secret: "ABC123", Metadata: appgroup.Metadata{
+			Name:      "Lama",
+			Labels:    map[string]string{"team": "core"},
+			RouterURL: "http://router-01:8081",
+			Apps:      []appgroup.App{{Name: "lama-app"}},
+		}}},
+		Sequences: map[string]Sequence{"lama": {Next: 42, CheckedSeq: 40, CheckedTime: 1600000000000}},
+		SLOWindows: []SLOWindow{
+			{AppGroup: "lama", SLI: "push", Size: time.Hour, Buckets: []SLOBucket{{Index: 26666666, Good: 3, Total: 4}}},
+		},
+		ProbeLogTimes: map[string]int64{"lama": 1600000000000},
+	}
+	if err := store.Save(expected); err != nil {
+		t.Fatalf("Save should not return error, got: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("State file should only be readable by owner, got: %v", info.Mode().Perm())
+	}
+
+	snapshot, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load should not return error, got: %v", err)
+	}
+	if !reflect.DeepEqual(snapshot, expected) {
+		t.Errorf("Load should return saved snapshot, want:\n%+v\ngot:\n%+v", expected, snapshot)
+	}
+}
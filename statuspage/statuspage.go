@@ -0,0 +1,312 @@
+// Package statuspage serves an HTML summary of every app group probed,
+// built from the state the agents keep in memory, for a quick look without
+// Grafana.
+package statuspage
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/exporter"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PATH = "/status"
+
+	SORT_APP_GROUP = "app_group"
+	SORT_STATE     = "state"
+	SORT_DELAY     = "delay"
+
+	STATE_OK      = "ok"
+	STATE_FAILED  = "failed"
+	STATE_PAUSED  = "paused"
+	STATE_PENDING = "pending"
+)
+
+// probes are the columns of the page, in order.
+var probes = []string{o11y.PROBE_PUSH, o11y.PROBE_ELASTICSEARCH, o11y.PROBE_KIBANA}
+
+// Source lists the app groups probed, e.g. the exporter manager.
+type Source interface {
+	Statuses() []exporter.AppGroupStatus
+}
+
+type outcome struct {
+	State   string
+	LastRun time.Time
+	Error   string
+}
+
+type row struct {
+	ClusterName string
+	Name        string
+	Outcomes    []outcome
+	Delay       *float64
+	LastError   string
+	Endpoints   []string
+}
+
+// stateRanks orders states from the worst.
+var stateRanks = map[string]int{STATE_FAILED: 0, STATE_PAUSED: 1, STATE_PENDING: 2, STATE_OK: 3}
+
+// State is the worst state of the probes of the row.
+func (r row) State() string {
+	state := STATE_OK
+	for _, o := range r.Outcomes {
+		if stateRanks[o.State] < stateRanks[state] {
+			state = o.State
+		}
+	}
+	return state
+}
+
+func (r row) hasState(state string) bool {
+	for _, o := range r.Outcomes {
+		if o.State == state {
+			return true
+		}
+	}
+	return false
+}
+
+func newRow(s exporter.AppGroupStatus) row {
+	r := row{ClusterName: s.ClusterName, Name: s.Name, Endpoints: []string{}}
+	agents := map[string]exporter.AgentStatus{}
+	var lastErrorAt time.Time
+	for _, a := range s.Agents {
+		agents[a.Probe] = a
+		if a.Delay != nil {
+			r.Delay = a.Delay
+		}
+		r.Endpoints = append(r.Endpoints, a.Endpoints...)
+		if a.LastError != "" && a.LastRun.After(lastErrorAt) {
+			r.LastError, lastErrorAt = a.LastError, a.LastRun
+		}
+	}
+
+	for _, probe := range probes {
+		a, ok := agents[probe]
+		o := outcome{State: STATE_PENDING, LastRun: a.LastRun, Error: a.LastError}
+		switch {
+		case !ok:
+		case a.Paused:
+			o.State = STATE_PAUSED
+		case a.Runs == 0:
+		case a.LastError != "":
+			o.State = STATE_FAILED
+		default:
+			o.State = STATE_OK
+		}
+		r.Outcomes = append(r.Outcomes, o)
+	}
+	return r
+}
+
+// filterRows keeps the rows whose cluster name, name or endpoints contain
+// query, and with a probe in state when not empty.
+func filterRows(rows []row, query, state string) []row {
+	query = strings.ToLower(query)
+	result := []row{}
+	for _, r := range rows {
+		text := strings.ToLower(strings.Join(append([]string{r.ClusterName, r.Name}, r.Endpoints...), " "))
+		if query != "" && !strings.Contains(text, query) {
+			continue
+		}
+		if state != "" && !r.hasState(state) {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// sortRows sorts by key, descending when it starts with "-". Ties are
+// ordered by cluster name, and rows without delay come last either way.
+func sortRows(rows []row, key string) {
+	desc := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch key {
+		case SORT_STATE:
+			if ra, rb := stateRanks[a.State()], stateRanks[b.State()]; ra != rb {
+				return (ra < rb) != desc
+			}
+		case SORT_DELAY:
+			if (a.Delay == nil) != (b.Delay == nil) {
+				return b.Delay == nil
+			}
+			if a.Delay != nil && *a.Delay != *b.Delay {
+				return (*a.Delay < *b.Delay) != desc
+			}
+		case SORT_APP_GROUP:
+			if desc {
+				return a.ClusterName > b.ClusterName
+			}
+		}
+		return a.ClusterName < b.ClusterName
+	})
+}
+
+type page struct {
+	Probes []string
+	Rows   []row
+	Total  int
+	Query  string
+	State  string
+	Sort   string
+	Now    time.Time
+}
+
+// SortURL sorts by key, the other way round when already sorted by it.
+func (p page) SortURL(key string) string {
+	if p.Sort == key {
+		key = "-" + key
+	}
+	v := url.Values{"sort": {key}}
+	if p.Query != "" {
+		v.Set("q", p.Query)
+	}
+	if p.State != "" {
+		v.Set("state", p.State)
+	}
+	return "?" + v.Encode()
+}
+
+func (p page) Ago(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return p.Now.Sub(t).Truncate(time.Second).String() + " ago"
+}
+
+func (p page) Seconds(delay *float64) string {
+	if delay == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fs", *delay)
+}
+
+type handler struct {
+	source Source
+	token  string
+}
+
+// NewHandler serves the page, sorted by the sort param, one of app_group,
+// state or delay, and filtered by the q and state params. The page lists
+// endpoints, so it's only served to requests with the token, as bearer
+// token or as basic auth password for browsers.
+func NewHandler(source Source, token string) http.Handler {
+	return &handler{source: source, token: token}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="status"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	p := page{
+		Probes: probes,
+		Query:  q.Get("q"),
+		State:  q.Get("state"),
+		Sort:   q.Get("sort"),
+		Now:    time.Now(),
+	}
+	if p.Sort == "" {
+		p.Sort = SORT_APP_GROUP
+	}
+
+	rows := []row{}
+	for _, s := range h.source.Statuses() {
+		rows = append(rows, newRow(s))
+	}
+	p.Total = len(rows)
+	p.Rows = filterRows(rows, p.Query, p.State)
+	sortRows(p.Rows, p.Sort)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, p); err != nil {
+		log.Errorf("Failed to render status page, error: %v", err)
+	}
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+var pageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Barito blackbox exporter</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 20px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th a { color: inherit; }
+.ok { background: #dff0d8; }
+.failed { background: #f2dede; }
+.paused { background: #fcf8e3; }
+.pending { color: #999; }
+.error { font-family: monospace; max-width: 400px; word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Barito blackbox exporter</h1>
+<form method="get">
+<input type="hidden" name="sort" value="{{.Sort}}">
+<input type="search" name="q" value="{{.Query}}" placeholder="app group or endpoint">
+<select name="state">
+<option value="" {{if eq .State ""}}selected{{end}}>all</option>
+<option value="failed" {{if eq .State "failed"}}selected{{end}}>failed</option>
+<option value="paused" {{if eq .State "paused"}}selected{{end}}>paused</option>
+</select>
+<button type="submit">Filter</button>
+{{len .Rows}} of {{.Total}} app groups, at {{.Now.Format "2006-01-02 15:04:05 MST"}}
+</form>
+<table>
+<tr>
+<th><a href="{{.SortURL "app_group"}}">App group</a></th>
+{{range .Probes}}<th>{{.}}</th>{{end}}
+<th><a href="{{.SortURL "state"}}">State</a></th>
+<th><a href="{{.SortURL "delay"}}">Delay</a></th>
+<th>Last error</th>
+<th>Endpoints</th>
+</tr>
+{{range .Rows}}
+<tr>
+<td>{{.ClusterName}}{{if .Name}}<br><small>{{.Name}}</small>{{end}}</td>
+{{range .Outcomes}}<td class="{{.State}}" title="{{.Error}}">{{.State}}<br><small>{{$.Ago .LastRun}}</small></td>{{end}}
+<td class="{{.State}}">{{.State}}</td>
+<td>{{$.Seconds .Delay}}</td>
+<td class="error">{{.LastError}}</td>
+<td>{{range .Endpoints}}{{.}}<br>{{end}}</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,187 @@
+package statuspage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BaritoLog/barito-blackbox-exporter/exporter"
+	"github.com/BaritoLog/barito-blackbox-exporter/o11y"
+)
+
+type fakeSource []exporter.AppGroupStatus
+
+func (f fakeSource) Statuses() []exporter.AppGroupStatus {
+	return f
+}
+
+func delay(d float64) *float64 {
+	return &d
+}
+
+func statuses() fakeSource {
+	lastRun := time.Now().Add(-time.Minute)
+	return fakeSource{
+		{ClusterName: "lama", Agents: []exporter.AgentStatus{
+			{Probe: o11y.PROBE_PUSH, Runs: 1, LastRun: lastRun, Endpoints: []string{"router-01"}},
+			{Probe: o11y.PROBE_ELASTICSEARCH, Runs: 1, LastRun: lastRun, Delay: delay(120), Endpoints: []string{"http://es-01:9200"}},
+			{Probe: o11y.PROBE_KIBANA, Runs: 1, LastRun: lastRun},
+		}},
+		{ClusterName: "unta", Agents: []exporter.AgentStatus{
+			{Probe: o11y.PROBE_PUSH, Runs: 1, LastRun: lastRun, LastError: "Got response status 502 <html>"},
+			{Probe: o11y.PROBE_ELASTICSEARCH, Runs: 1, LastRun: lastRun, Delay: delay(30)},
+			{Probe: o11y.PROBE_KIBANA, Paused: true},
+		}},
+		{ClusterName: "kuda", Agents: []exporter.AgentStatus{
+			{Probe: o11y.PROBE_PUSH},
+		}},
+	}
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	w := get(NewHandler(statuses(), "secret"), "/status")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Should serve the page, got: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	for _, s := range []string{"3 of 3 app groups", "http://es-01:9200", "router-01", "120s", `class="paused"`, `class="failed"`, "1m0s ago", "never"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Page should contain %q", s)
+		}
+	}
+	if !strings.Contains(body, "Got response status 502 &lt;html&gt;") {
+		t.Errorf("Page should escape errors")
+	}
+	if strings.Index(body, "kuda") > strings.Index(body, "lama") || strings.Index(body, "lama") > strings.Index(body, "unta") {
+		t.Errorf("Page should be sorted by app group by default")
+	}
+
+	if w := get(NewHandler(statuses(), "secret"), "/status?sort=-app_group"); strings.Index(w.Body.String(), "unta") > strings.Index(w.Body.String(), "lama") {
+		t.Errorf("Page should be sorted by app group descending")
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	NewHandler(statuses(), "secret").ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Should only serve GET, got: %d", w.Code)
+	}
+}
+
+func TestHandler_auth(t *testing.T) {
+	cases := []struct {
+		token    string
+		user     string
+		password string
+		bearer   string
+		expected int
+	}{
+		{token: "secret", expected: http.StatusUnauthorized},
+		{token: "secret", bearer: "wrong", expected: http.StatusUnauthorized},
+		{token: "secret", bearer: "secret", expected: http.StatusOK},
+		{token: "secret", user: "admin", password: "secret", expected: http.StatusOK},
+		{token: "secret", user: "admin", password: "wrong", expected: http.StatusUnauthorized},
+		{token: "", expected: http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/status", nil)
+		if c.bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+c.bearer)
+		}
+		if c.user != "" {
+			req.SetBasicAuth(c.user, c.password)
+		}
+		w := httptest.NewRecorder()
+		NewHandler(statuses(), c.token).ServeHTTP(w, req)
+		if w.Code != c.expected {
+			t.Errorf("Should return %d for %+v, got: %d", c.expected, c, w.Code)
+		}
+	}
+}
+
+func TestHandler_filter(t *testing.T) {
+	cases := []struct {
+		target string
+		want   []string
+	}{
+		{"/status?q=ES-01", []string{"lama"}},
+		{"/status?q=unta", []string{"unta"}},
+		{"/status?state=failed", []string{"unta"}},
+		{"/status?state=paused&q=lama", []string{}},
+	}
+
+	for _, c := range cases {
+		w := get(NewHandler(statuses(), "secret"), c.target)
+		for _, s := range statuses() {
+			shown := strings.Contains(w.Body.String(), "<td>"+s.ClusterName)
+			wanted := false
+			for _, name := range c.want {
+				wanted = wanted || name == s.ClusterName
+			}
+			if shown != wanted {
+				t.Errorf("%s should show %v, got %s shown: %v", c.target, c.want, s.ClusterName, shown)
+			}
+		}
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	cases := []struct {
+		key  string
+		want []string
+	}{
+		{SORT_APP_GROUP, []string{"kuda", "lama", "unta"}},
+		{"-" + SORT_APP_GROUP, []string{"unta", "lama", "kuda"}},
+		{SORT_STATE, []string{"unta", "kuda", "lama"}},
+		{"-" + SORT_STATE, []string{"lama", "kuda", "unta"}},
+		{SORT_DELAY, []string{"unta", "lama", "kuda"}},
+		{"-" + SORT_DELAY, []string{"lama", "unta", "kuda"}},
+	}
+
+	for _, c := range cases {
+		rows := []row{}
+		for _, s := range statuses() {
+			rows = append(rows, newRow(s))
+		}
+		sortRows(rows, c.key)
+
+		got := []string{}
+		for _, r := range rows {
+			got = append(got, r.ClusterName)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("Sorting by %s should give %v, got: %v", c.key, c.want, got)
+		}
+	}
+}
+
+func TestNewRow(t *testing.T) {
+	r := newRow(statuses()[1])
+	states := []string{}
+	for _, o := range r.Outcomes {
+		states = append(states, o.State)
+	}
+	if strings.Join(states, ",") != "failed,ok,paused" {
+		t.Errorf("Should give the state of every probe, got: %v", states)
+	}
+	if r.State() != STATE_FAILED || r.LastError != "Got response status 502 <html>" || *r.Delay != 30 {
+		t.Errorf("Should summarise the app group, got: %+v", r)
+	}
+
+	if r := newRow(statuses()[2]); r.State() != STATE_PENDING || r.Delay != nil {
+		t.Errorf("Should be pending before the first run, got: %+v", r)
+	}
+}
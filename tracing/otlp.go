@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer queues ended spans and sends them in batches to the
+// /v1/traces endpoint of an OTLP/HTTP collector. Spans are dropped when the
+// queue is full, tracing must never hold probes back.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// NewTracer exports to endpoint, the base URL of the collector, every
+// flushInterval or as soon as a full batch is queued.
+func NewTracer(endpoint, serviceName string, queueSize int, flushInterval, timeout time.Duration) (*Tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid tracing endpoint %q", endpoint)
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(strings.TrimSuffix(u.Path, "/") + "/v1/traces"),
+		otlptracehttp.WithTimeout(timeout),
+	}
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	// the exporter client isn't traced, exporting spans must not make more
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Errorf("Failed to export spans to %q, error: %v", endpoint, err)
+	}))
+	return newTracer(exporter, serviceName,
+		sdktrace.WithMaxQueueSize(queueSize),
+		sdktrace.WithMaxExportBatchSize(batchSize(queueSize)),
+		sdktrace.WithBatchTimeout(flushInterval),
+	), nil
+}
+
+func newTracer(exporter sdktrace.SpanExporter, serviceName string, options ...sdktrace.BatchSpanProcessorOption) *Tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, options...),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName))),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer(serviceName)}
+}
+
+// batchSize keeps the default export batch size, unless the queue is
+// smaller.
+func batchSize(queueSize int) int {
+	if queueSize < sdktrace.DefaultMaxExportBatchSize {
+		return queueSize
+	}
+	return sdktrace.DefaultMaxExportBatchSize
+}
+
+// Run returns once ctx is done, after exporting the spans still queued, or
+// once shutdownTimeout has passed.
+func (t *Tracer) Run(ctx context.Context, shutdownTimeout time.Duration) {
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("Failed to export the last spans, error: %v", err)
+	}
+}
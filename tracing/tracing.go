@@ -0,0 +1,122 @@
+// Package tracing records the spans of probe cycles with OpenTelemetry and
+// exports them to an OTLP/HTTP collector, so a slow step of a failing probe
+// can be told apart without reading logs. Trace context is propagated in
+// the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var propagator = propagation.TraceContext{}
+
+// Span is a timed step of a trace. A nil Span, returned while tracing is
+// disabled, can be used all the same.
+type Span struct {
+	span trace.Span
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// End records the span, failed when err isn't nil.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetStatus(codes.Ok, "")
+	}
+	s.span.End()
+}
+
+var (
+	mu     sync.RWMutex
+	tracer *Tracer
+)
+
+// Configure sets the tracer spans are recorded to, nil disables tracing.
+func Configure(t *Tracer) {
+	mu.Lock()
+	defer mu.Unlock()
+	tracer = t
+}
+
+func current() *Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return tracer
+}
+
+// Start starts a span, child of the span of ctx if any, and returns ctx
+// carrying it.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindInternal)
+}
+
+func start(ctx context.Context, name string, kind trace.SpanKind) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// NewTransport returns a RoundTripper recording a client span per request,
+// up to the response headers, child of the span of the request context. It
+// sends the span traceparent so the server side can link its own spans.
+// base defaults to http.DefaultTransport.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := start(req.Context(), "HTTP "+req.Method, trace.SpanKindClient)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	// the query may hold credentials
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+
+	span.SetAttribute("http.status_code", fmt.Sprintf("%d", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.End(fmt.Errorf("Got response status %d", resp.StatusCode))
+	} else {
+		span.End(nil)
+	}
+	return resp, nil
+}
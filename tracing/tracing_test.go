@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func attributes(s tracetest.SpanStub) map[string]string {
+	result := map[string]string{}
+	for _, a := range s.Attributes {
+		result[string(a.Key)] = a.Value.AsString()
+	}
+	return result
+}
+
+func TestTracer(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := newTracer(exporter, "prober")
+	Configure(tracer)
+	defer Configure(nil)
+
+	ctx, tick := Start(context.Background(), "push")
+	tick.SetAttribute("app_group", "cluster-a")
+	c := &http.Client{Transport: NewTransport(nil)}
+	req, _ := http.NewRequest("GET", srv.URL+"/produce_batch?token=secret", nil)
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	resp.Body.Close()
+	tick.End(nil)
+
+	if err := tracer.provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Should export 2 spans, got: %d", len(spans))
+	}
+
+	client, parent := spans[0], spans[1]
+	if parent.Name != "push" || parent.Parent.IsValid() || parent.SpanKind != trace.SpanKindInternal || parent.Status.Code != codes.Ok {
+		t.Errorf("Should export the root span, got: %+v", parent)
+	}
+	if name, ok := parent.Resource.Set().Value("service.name"); !ok || name.AsString() != "prober" {
+		t.Errorf("Should set service name, got: %v", name)
+	}
+	if client.Name != "HTTP GET" || client.SpanKind != trace.SpanKindClient || client.Status.Code != codes.Error {
+		t.Errorf("Should export the failed client span, got: %+v", client)
+	}
+	if client.SpanContext.TraceID() != parent.SpanContext.TraceID() || client.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("Should export the client span as child of the push span, got: %+v", client.Parent)
+	}
+	if expected := "00-" + client.SpanContext.TraceID().String() + "-" + client.SpanContext.SpanID().String() + "-01"; traceparent != expected {
+		t.Errorf("Should send traceparent %q, got: %q", expected, traceparent)
+	}
+
+	attrs := attributes(client)
+	if attrs["http.url"] != srv.URL+"/produce_batch" || attrs["http.status_code"] != "503" {
+		t.Errorf("Should record the URL without query and the status, got: %v", attrs)
+	}
+}
+
+func TestSpan_failed(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := newTracer(exporter, "prober")
+	Configure(tracer)
+	defer Configure(nil)
+
+	_, span := Start(context.Background(), "tick")
+	span.End(errors.New("err"))
+	tracer.provider.ForceFlush(context.Background())
+
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Status.Code != codes.Error || spans[0].Status.Description != "err" {
+		t.Errorf("Should export the span as failed, got: %+v", spans)
+	}
+}
+
+func TestTracer_exportOnShutdown(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer collector.Close()
+
+	tracer, err := NewTracer(collector.URL+"/otlp/", "prober", 10, time.Hour, time.Second)
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	Configure(tracer)
+	defer Configure(nil)
+
+	_, span := Start(context.Background(), "tick")
+	span.End(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tracer.Run(ctx, time.Second)
+
+	select {
+	case r := <-requests:
+		if r.URL.Path != "/otlp/v1/traces" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-protobuf") {
+			t.Errorf("Should post OTLP to /otlp/v1/traces, got: %s %q", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+	default:
+		t.Errorf("Should export the queued spans when ctx is done")
+	}
+
+	if _, err := NewTracer("collector:4318", "prober", 10, time.Hour, time.Second); err == nil {
+		t.Errorf("Should reject an endpoint without scheme")
+	}
+}
+
+func TestTracer_disabled(t *testing.T) {
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	ctx, span := Start(context.Background(), "tick")
+	if span != nil || trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatalf("Should not start span, got: %+v", span)
+	}
+	span.SetAttribute("app_group", "cluster-a")
+	span.End(nil)
+
+	c := &http.Client{Transport: NewTransport(nil)}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Should not return error, got: %v", err)
+	}
+	resp.Body.Close()
+	if traceparent != "" {
+		t.Errorf("Should not send traceparent, got: %q", traceparent)
+	}
+}